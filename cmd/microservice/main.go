@@ -4,17 +4,22 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
+	// freeze calendars use IANA timezones, embedded for images without zoneinfo
+	_ "time/tzdata"
 
 	"github.com/gorilla/mux"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
 	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
 	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/handlers"
 	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/validator"
 	"github.com/microlib/simple"
 )
 
-func startHttpServer(con connectors.Clients) (*http.Server, error) {
+func startHttpServer(con connectors.Clients, reg *handlers.Registry) (*http.Server, error) {
 	srv := &http.Server{Addr: ":9000"}
 	r := mux.NewRouter()
 
@@ -22,6 +27,34 @@ func startHttpServer(con connectors.Clients) (*http.Server, error) {
 		handlers.WebhookHandler(w, r, con)
 	}).Methods("POST", "OPTIONS")
 
+	r.HandleFunc("/api/v1/service/{tenant}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.TenantWebhookHandler(w, r, con, reg)
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/callback/{deliveryID}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.CallbackHandler(w, r, con, reg)
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/admin/approvals", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ApprovalsHandler(w, r, con)
+	}).Methods("GET", "OPTIONS")
+
+	r.HandleFunc("/api/v1/admin/approvals/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ApproveHandler(w, r, con, reg)
+	}).Methods("POST", "DELETE", "OPTIONS")
+
+	r.HandleFunc("/api/v1/admin/deferrals", func(w http.ResponseWriter, r *http.Request) {
+		handlers.DeferralsHandler(w, r, con, reg)
+	}).Methods("GET", "OPTIONS")
+
+	r.HandleFunc("/api/v1/admin/deferrals/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.DeferralsHandler(w, r, con, reg)
+	}).Methods("POST", "DELETE", "OPTIONS")
+
+	r.HandleFunc("/api/v1/admin/audit", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuditHandler(w, r, con)
+	}).Methods("GET", "OPTIONS")
+
 	r.HandleFunc("/api/v1/isalive", func(w http.ResponseWriter, r *http.Request) {
 		handlers.IsAlive(w, r, con)
 	}).Methods("GET", "OPTIONS")
@@ -39,19 +72,46 @@ func startHttpServer(con connectors.Clients) (*http.Server, error) {
 func main() {
 	var logger *simple.Logger
 
+	checkConfig := flag.Bool("check-config", false, "validate the configuration and exit")
+	flag.Parse()
+
 	if os.Getenv("LOG_LEVEL") == "" {
 		logger = &simple.Logger{Level: "info"}
 	} else {
 		logger = &simple.Logger{Level: os.Getenv("LOG_LEVEL")}
 	}
 
-	err := validator.ValidateEnvars(logger)
-	if err != nil {
+	var problems []error
+	if err := validator.ValidateEnvars(logger); err != nil {
+		problems = append(problems, err)
+	}
+	tenants := &config.Config{}
+	if path := os.Getenv("TENANT_CONFIG"); path != "" {
+		cfg, err := config.Load(path)
+		if err != nil {
+			logger.Error(err.Error())
+			problems = append(problems, err)
+		} else if tenants, err = validator.ValidateTenants(cfg, logger); err != nil && *checkConfig {
+			// outside of check mode invalid tenants are disabled and the rest are served
+			problems = append(problems, err)
+		}
+	}
+	if *checkConfig {
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("configuration OK")
+		os.Exit(0)
+	}
+	if len(problems) > 0 {
 		os.Exit(-1)
 	}
 
 	conn := connectors.NewClientConnectors(logger)
-	srv, err := startHttpServer(conn)
+	srv, err := startHttpServer(conn, handlers.NewRegistry(tenants))
 	if err != nil {
 		os.Exit(-1)
 	}
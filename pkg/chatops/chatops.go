@@ -0,0 +1,60 @@
+package chatops
+
+import (
+	"strings"
+)
+
+// supported commands, /ok-to-test trusts a fork pull request and re-runs it
+const (
+	RETEST   string = "retest"
+	DEPLOY   string = "deploy"
+	HOLD     string = "hold"
+	UNHOLD   string = "unhold"
+	OKTOTEST string = "ok-to-test"
+)
+
+// Command - a slash command found in a comment, Args holds the words after the command
+type Command struct {
+	Name string
+	Args []string
+}
+
+// Parse - returns the supported commands in the comment body
+// a command is a line starting with a slash, unknown commands and quoted lines are ignored
+func Parse(body string) []Command {
+	var commands []Command
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(strings.TrimSpace(line))
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(fields[0], "/"))
+		switch name {
+		case RETEST, DEPLOY, HOLD, UNHOLD, OKTOTEST:
+			commands = append(commands, Command{Name: name, Args: fields[1:]})
+		}
+	}
+	return commands
+}
+
+// Allowed - reports whether the comment author may run commands
+// users and author associations (OWNER, MEMBER, COLLABORATOR ...) are matched directly,
+// isMember is only called for teams when neither matched
+func Allowed(users []string, associations []string, teams []string, user string, association string, isMember func(team string) bool) bool {
+	for _, u := range users {
+		if strings.EqualFold(u, user) {
+			return true
+		}
+	}
+	for _, a := range associations {
+		if strings.EqualFold(a, association) {
+			return true
+		}
+	}
+	for _, t := range teams {
+		if isMember(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package chatops
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestChatOps(t *testing.T) {
+
+	t.Run("Parse : should pass", func(t *testing.T) {
+		commands := Parse("Looks good\r\n/retest\n  /deploy uat now\n> /hold\n/approve\n/UNHOLD\n/ok-to-test")
+		if len(commands) != 4 || commands[0].Name != RETEST || commands[1].Name != DEPLOY || commands[1].Args[0] != "uat" || commands[2].Name != UNHOLD || commands[3].Name != OKTOTEST {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect commands - got (%v)", "Parse", commands))
+		}
+	})
+
+	t.Run("Parse : should pass (no commands)", func(t *testing.T) {
+		if commands := Parse("just a comment about /retest"); len(commands) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect commands - got (%v) wanted none", "Parse", commands))
+		}
+	})
+
+	t.Run("Allowed : should pass", func(t *testing.T) {
+		never := func(string) bool { return false }
+		always := func(string) bool { return true }
+		if !Allowed([]string{"lmz"}, nil, nil, "LMZ", "NONE", never) {
+			t.Errorf(fmt.Sprintf("Handler %s did not allow listed user", "Allowed"))
+		}
+		if !Allowed(nil, []string{"OWNER", "MEMBER"}, nil, "someone", "MEMBER", never) {
+			t.Errorf(fmt.Sprintf("Handler %s did not allow listed association", "Allowed"))
+		}
+		if !Allowed(nil, nil, []string{"org/ci"}, "someone", "NONE", always) {
+			t.Errorf(fmt.Sprintf("Handler %s did not allow team member", "Allowed"))
+		}
+		if Allowed([]string{"lmz"}, []string{"OWNER"}, []string{"org/ci"}, "someone", "CONTRIBUTOR", never) {
+			t.Errorf(fmt.Sprintf("Handler %s allowed an unlisted user", "Allowed"))
+		}
+	})
+}
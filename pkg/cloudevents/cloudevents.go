@@ -0,0 +1,87 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SPECVERSION - the CloudEvents specification version
+const SPECVERSION string = "1.0"
+
+// TYPEPREFIX - the prefix of the event types (dev.gitwebhook.pr.opened)
+const TYPEPREFIX string = "dev.gitwebhook"
+
+// content modes of the http binding
+const (
+	STRUCTURED string = "structured"
+	BINARY     string = "binary"
+)
+
+// STRUCTUREDCONTENTTYPE - the content type of a structured mode request
+const STRUCTUREDCONTENTTYPE string = "application/cloudevents+json"
+
+// Event - a CloudEvent, Data is encoded as json
+type Event struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            string      `json:"time,omitempty"`
+	DataContentType string      `json:"datacontenttype,omitempty"`
+	Data            interface{} `json:"data,omitempty"`
+}
+
+// New - returns an event with the type built from the webhook event type and action
+func New(id string, source string, eventType string, action string, subject string, data interface{}) *Event {
+	return &Event{
+		SpecVersion:     SPECVERSION,
+		ID:              id,
+		Source:          source,
+		Type:            Type(eventType, action),
+		Subject:         subject,
+		Time:            time.Now().UTC().Format(time.RFC3339),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+}
+
+// Type - the CloudEvents type of a webhook event and action, pull requests are shortened to pr
+// (pull_request opened is dev.gitwebhook.pr.opened, pull_request_review approved dev.gitwebhook.pr.review.approved)
+func Type(eventType string, action string) string {
+	t := strings.Replace(eventType, "pull_request", "pr", 1)
+	t = strings.Replace(t, "_", ".", -1)
+	if action == "" {
+		return TYPEPREFIX + "." + t
+	}
+	return TYPEPREFIX + "." + t + "." + action
+}
+
+// Encode - returns the body and headers of the event in the content mode
+// structured sends the whole event as json, binary sends the data as the body and the attributes as ce- headers
+func Encode(mode string, e *Event) ([]byte, map[string]string, error) {
+	switch mode {
+	case STRUCTURED:
+		body, err := json.Marshal(e)
+		return body, map[string]string{"Content-Type": STRUCTUREDCONTENTTYPE}, err
+	case BINARY:
+		body, err := json.Marshal(e.Data)
+		headers := map[string]string{
+			"Content-Type":   e.DataContentType,
+			"ce-specversion": e.SpecVersion,
+			"ce-id":          e.ID,
+			"ce-source":      e.Source,
+			"ce-type":        e.Type,
+		}
+		if e.Subject != "" {
+			headers["ce-subject"] = e.Subject
+		}
+		if e.Time != "" {
+			headers["ce-time"] = e.Time
+		}
+		return body, headers, err
+	}
+	return nil, nil, fmt.Errorf("cloudevents mode %q should be structured or binary", mode)
+}
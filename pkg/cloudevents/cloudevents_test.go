@@ -0,0 +1,51 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestCloudEvents(t *testing.T) {
+
+	data := map[string]string{"hash": "6183473b"}
+
+	t.Run("Type : should pass", func(t *testing.T) {
+		tests := map[string][2]string{
+			"dev.gitwebhook.pr.opened":           {"pull_request", "opened"},
+			"dev.gitwebhook.pr.review.approved":  {"pull_request_review", "approved"},
+			"dev.gitwebhook.release.prereleased": {"release", "prereleased"},
+			"dev.gitwebhook.push.tag":            {"push", "tag"},
+			"dev.gitwebhook.ping":                {"ping", ""},
+		}
+		for want, in := range tests {
+			if got := Type(in[0], in[1]); got != want {
+				t.Errorf(fmt.Sprintf("Handler %s returned incorrect type - got (%s) wanted (%s)", "Type", got, want))
+			}
+		}
+	})
+
+	t.Run("Encode : should pass (structured)", func(t *testing.T) {
+		body, headers, err := Encode(STRUCTURED, New("abc-pr-opened", "https://github.com/org/app.git", "pull_request", "opened", "", data))
+		var e map[string]interface{}
+		json.Unmarshal(body, &e)
+		if err != nil || headers["Content-Type"] != STRUCTUREDCONTENTTYPE || e["specversion"] != "1.0" || e["type"] != "dev.gitwebhook.pr.opened" || e["id"] != "abc-pr-opened" ||
+			e["source"] != "https://github.com/org/app.git" || e["data"].(map[string]interface{})["hash"] != "6183473b" || e["time"] == "" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect event - got (%s %v %v)", "Encode", body, headers, err))
+		}
+	})
+
+	t.Run("Encode : should pass (binary)", func(t *testing.T) {
+		body, headers, err := Encode(BINARY, New("abc-released", "https://github.com/org/app.git", "release", "released", "v1.0.0", data))
+		if err != nil || string(body) != `{"hash":"6183473b"}` || headers["Content-Type"] != "application/json" || headers["ce-type"] != "dev.gitwebhook.release.released" ||
+			headers["ce-subject"] != "v1.0.0" || headers["ce-specversion"] != "1.0" || headers["ce-id"] != "abc-released" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect event - got (%s %v %v)", "Encode", body, headers, err))
+		}
+	})
+
+	t.Run("Encode : should fail (unknown mode)", func(t *testing.T) {
+		if _, _, err := Encode("batched", New("id", "source", "push", "tag", "", data)); err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned no error - got (%v) wanted (%v)", "Encode", err, "error"))
+		}
+	})
+}
@@ -0,0 +1,592 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/glob"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/semver"
+)
+
+// DEFAULTTENANT - name of the tenant built from the legacy envars
+const DEFAULTTENANT string = "default"
+
+// PROPENEDACTIONS - default actions of the legacy pull request route, new commits (synchronize),
+// reopened pull requests and drafts marked ready for review all re-run the pipeline
+const PROPENEDACTIONS string = "opened,reopened,synchronize,ready_for_review"
+
+// SKIPMARKERS - default skip ci markers, matched case insensitively
+const SKIPMARKERS string = "[skip ci],[ci skip],skip-checks: true"
+
+// Route - a routing rule, events of the given type with one of the actions are posted to the url
+// SkipDraft ignores pull request events while the pull request is a draft, Labels
+// limits the route to pull requests carrying one of the labels and Environment
+// to tags (releases and tag pushes) of that environment
+// IncludePaths and ExcludePaths (globs, ** matches any number of directories) limit push
+// and pull request routes to changes of the included and not excluded files
+// SkipMarkers drops pushes and pull requests whose head commit message, title or body carries one
+// of the markers (nil uses SKIPMARKERS, an empty list disables them)
+// Template replaces the posted binding json with a rendered payload, Passthrough forwards the webhook
+// body unchanged with the ForwardHeaders (nil uses PASSTHROUGHHEADERS), "*" in Actions matches any action
+// CloudEvents (structured or binary) posts the binding as the data of a CloudEvent
+// Sink publishes the event to a message broker (the url) instead of posting it
+// and Tekton creates a PipelineRun or TaskRun through the Kubernetes api (the url is not used)
+// Debounce (seconds) collapses events of the same repository and ref received within the window
+// into one delivery of the latest event
+type Route struct {
+	Name           string    `json:"name"`
+	Event          string    `json:"event"`
+	Actions        []string  `json:"actions"`
+	URL            string    `json:"url"`
+	SkipDraft      bool      `json:"skipdraft"`
+	Labels         []string  `json:"labels"`
+	Environment    string    `json:"environment"`
+	IncludePaths   []string  `json:"includepaths"`
+	ExcludePaths   []string  `json:"excludepaths"`
+	SkipMarkers    []string  `json:"skipmarkers"`
+	Template       *Template `json:"template"`
+	Passthrough    bool      `json:"passthrough"`
+	ForwardHeaders []string  `json:"forwardheaders"`
+	CloudEvents    string    `json:"cloudevents"`
+	Sink           *Sink     `json:"sink"`
+	Tekton         *Tekton   `json:"tekton"`
+	Approval       *Approval `json:"approval"`
+	Freeze         *Freeze   `json:"freeze"`
+	Debounce       int       `json:"debounce"`
+}
+
+// PASSTHROUGHHEADERS - request headers forwarded by passthrough routes, the provider events,
+// deliveries and signatures so that the receiver can verify the unchanged body
+const PASSTHROUGHHEADERS string = "Content-Type,User-Agent,X-GitHub-Event,X-GitHub-Delivery,X-GitHub-Hook-ID,X-Hub-Signature,X-Hub-Signature-256," +
+	"X-Gitea-Event,X-Gitea-Delivery,X-Gitea-Signature,X-Gitlab-Event,X-Gitlab-Event-UUID,X-Gitlab-Token"
+
+// Template - a text/template rendering of the outbound request (see payload.Data for the fields)
+// Body is the template, or it is read from File, ContentType defaults to application/json
+// and the Headers values are templates too
+type Template struct {
+	Body        string            `json:"body"`
+	File        string            `json:"file"`
+	ContentType string            `json:"contenttype"`
+	Headers     map[string]string `json:"headers"`
+}
+
+// sink types, the brokers and the build systems a route can trigger
+const (
+	NATS         string = "nats"
+	KAFKA        string = "kafka"
+	AMQP         string = "amqp"
+	RABBITMQHTTP string = "rabbitmq-http"
+	JENKINS      string = "jenkins"
+	ARGO         string = "argo"
+	GITHUB       string = "github"
+)
+
+// Sink - a message broker the route publishes to, the route url is the broker: nats://[user:password@]host:4222 (no tls),
+// kafka://[user:password@]host:9092[,host:9092] or the Kafka REST proxy (kafka), amqp://[user:password@]host:5672[/vhost] (amqp, no tls) or the RabbitMQ management
+// http api (rabbitmq-http), credentials are taken from the url
+// Subject is a template (see payload.Data) of the NATS subject, Kafka topic or AMQP routing key
+// Key is a template of the Kafka record key (default the repository full name), Stream the NATS JetStream stream
+// that must store the message (the publish then waits for the stream acknowledgement),
+// Exchange (default amq.default) and VHost (default the amqp url path or /) are the AMQP exchange the message is published to
+// The build system sinks trigger a run instead, the url is the Jenkins server, the Argo server or the GitHub api
+// (default https://api.github.com): Job is the Jenkins job (folder/job), Template the Argo WorkflowTemplate
+// submitted in Namespace, Workflow the GitHub workflow (file name or id) dispatched on Ref (template, default
+// the event branch or tag) or, when empty, a repository_dispatch of the Subject event type to Repository
+// (template, default the event repository); Params (templates) are the build parameters, workflow parameters,
+// workflow inputs or client payload; Token is the Jenkins remote build token or the Argo and GitHub bearer token
+type Sink struct {
+	Type       string            `json:"type"`
+	Subject    string            `json:"subject"`
+	Key        string            `json:"key"`
+	Stream     string            `json:"stream"`
+	Exchange   string            `json:"exchange"`
+	VHost      string            `json:"vhost"`
+	Job        string            `json:"job"`
+	Template   string            `json:"template"`
+	Namespace  string            `json:"namespace"`
+	Workflow   string            `json:"workflow"`
+	Repository string            `json:"repository"`
+	Ref        string            `json:"ref"`
+	Params     map[string]string `json:"params"`
+	Token      string            `json:"token"`
+}
+
+// Tekton - a run created through the Kubernetes api in Namespace, Kind is PipelineRun (default) or TaskRun
+// and APIVersion defaults to tekton.dev/v1beta1; the run references the Pipeline (or Task) by name
+// or is rendered from Template (json, see payload.Data), Params maps run parameters to binding fields
+// ({"revision": "hash", "git-url": "url"}) and ServiceAccount sets the service account of the run
+// Kubeconfig is a json kubeconfig (kubectl config view --minify --flatten -o json) with a token user,
+// the in-cluster service account is used when it is empty
+type Tekton struct {
+	Kind           string            `json:"kind"`
+	APIVersion     string            `json:"apiversion"`
+	Namespace      string            `json:"namespace"`
+	Pipeline       string            `json:"pipeline"`
+	Template       *Template         `json:"template"`
+	Params         map[string]string `json:"params"`
+	ServiceAccount string            `json:"serviceaccount"`
+	Kubeconfig     string            `json:"kubeconfig"`
+}
+
+// freeze policies, deferred events are forwarded when the window ends
+const (
+	DEFER  string = "defer"
+	REJECT string = "reject"
+)
+
+// Freeze - deployment freeze calendar of a route, windows are evaluated in Timezone (IANA name, default UTC)
+// events arriving during a window are deferred or rejected according to Policy (default defer)
+// unless they carry the OverrideToken (emergency hotfixes)
+type Freeze struct {
+	Timezone      string   `json:"timezone"`
+	Policy        string   `json:"policy"`
+	OverrideToken string   `json:"overridetoken"`
+	Windows       []Window `json:"windows"`
+}
+
+// Window - a recurring window on Days (mon..sun) from Start to End (15:04, the whole day when both are empty,
+// an End before Start crosses midnight) or a one-off window from From to Until (2006-01-02 or 2006-01-02T15:04)
+type Window struct {
+	Name  string   `json:"name"`
+	Days  []string `json:"days"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+	From  string   `json:"from"`
+	Until string   `json:"until"`
+}
+
+// APPROVALMARKER - default approval marker, matches "Approved LMZ 01/02/2021 12:53" in the release notes
+const APPROVALMARKER string = `(?i)\bapproved\s+(?:by\s+)?@?([\w.-]+)`
+
+// Approval - release approval policy of a route, the release notes must carry the approval marker
+// (a regular expression whose first group is the approver) naming one of the approvers,
+// or the release must be published by a member of one of the teams (org/team)
+// other releases are held until they are approved through the admin api
+type Approval struct {
+	Approvers []string `json:"approvers"`
+	Teams     []string `json:"teams"`
+	Marker    string   `json:"marker"`
+}
+
+// Environment - maps tags to a deployment environment, either by a regular expression
+// on the tag or by a semver pre-release identifier (v1.0.1-UAT), Prerelease defaults to the name
+type Environment struct {
+	Name       string `json:"name"`
+	Pattern    string `json:"pattern"`
+	Prerelease string `json:"prerelease"`
+}
+
+// fork pull request policies, OKTOTEST forwards fork pull requests once they are trusted
+const (
+	ALLOW    string = "allow"
+	DENY     string = "deny"
+	OKTOTEST string = "ok-to-test"
+)
+
+// Policy - who may trigger the routes of a tenant, the lists hold logins or globs ("*[bot]")
+// a deny entry wins over an allow entry and an empty allow list allows everyone
+// Senders applies to every event, Owners and Visibility (public, private, internal) to the repository,
+// Authors, Associations (OWNER, MEMBER, CONTRIBUTOR ...) and Forks (allow, deny or ok-to-test, the default)
+// to pull requests; a fork pull request is trusted once it carries the OkToTestLabel (default ok-to-test)
+// or a chatops user commented /ok-to-test
+type Policy struct {
+	AllowSenders  []string `json:"allowsenders"`
+	DenySenders   []string `json:"denysenders"`
+	AllowAuthors  []string `json:"allowauthors"`
+	DenyAuthors   []string `json:"denyauthors"`
+	Associations  []string `json:"associations"`
+	AllowOwners   []string `json:"allowowners"`
+	DenyOwners    []string `json:"denyowners"`
+	Visibility    []string `json:"visibility"`
+	Forks         string   `json:"forks"`
+	OkToTestLabel string   `json:"oktotestlabel"`
+}
+
+// Forge - api access used to report back to the git provider, see forge.New for apiurl
+// Checks switches github from commit statuses to check runs (needs a github app token)
+type Forge struct {
+	Provider string `json:"provider"`
+	APIURL   string `json:"apiurl"`
+	Token    string `json:"token"`
+	Checks   bool   `json:"checks"`
+}
+
+// ChatOps - pull request comment commands (/retest, /deploy, /hold, /unhold)
+// only the listed users, author associations or team members (org/team) may run them,
+// Deploy maps the /deploy argument to the name of the route to fire
+type ChatOps struct {
+	Users        []string          `json:"users"`
+	Associations []string          `json:"associations"`
+	Teams        []string          `json:"teams"`
+	Deploy       map[string]string `json:"deploy"`
+}
+
+// notification conditions
+const (
+	DELIVERYFAILED   string = "delivery_failed"
+	RELEASEFORWARDED string = "release_forwarded"
+	POLICYBLOCKED    string = "policy_blocked"
+	APPROVALEXPIRED  string = "approval_expired"
+)
+
+// NOTIFYON - default conditions of a notifier
+const NOTIFYON string = DELIVERYFAILED + "," + POLICYBLOCKED + "," + APPROVALEXPIRED
+
+// Notifier - a chat or email notification sent On the conditions (nil uses NOTIFYON)
+// Type is slack or teams (incoming webhook url), webhook (the notification is posted as json to the url)
+// or email (url smtp://[user:password@]host:587 to the To addresses From the sender)
+// Environments limits release_forwarded to releases of those environments (production),
+// Template (see notify.Notification) replaces the default message
+type Notifier struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	URL          string   `json:"url"`
+	On           []string `json:"on"`
+	Environments []string `json:"environments"`
+	Template     string   `json:"template"`
+	From         string   `json:"from"`
+	To           []string `json:"to"`
+}
+
+// Tenant - an isolated set of routes with its own secret and limits
+// RateLimit is in requests per second (0 uses the default limit), MaxInFlight caps concurrent deliveries
+// and Timeout (seconds) bounds each outbound request
+// CallbackToken is the bearer token pipelines present on the callback endpoint
+type Tenant struct {
+	Name          string        `json:"name"`
+	Secret        string        `json:"secret"`
+	Providers     []string      `json:"providers"`
+	Routes        []Route       `json:"routes"`
+	Forges        []Forge       `json:"forges"`
+	CallbackToken string        `json:"callbacktoken"`
+	ChatOps       *ChatOps      `json:"chatops"`
+	Environments  []Environment `json:"environments"`
+	Policy        *Policy       `json:"policy"`
+	Notifiers     []Notifier    `json:"notifiers"`
+	RateLimit     float64       `json:"ratelimit"`
+	Burst         int           `json:"burst"`
+	MaxInFlight   int           `json:"maxinflight"`
+	Timeout       int           `json:"timeout"`
+}
+
+// Config - the top level tenant configuration file
+type Config struct {
+	Tenants []Tenant `json:"tenants"`
+}
+
+// Load - reads and parses the json tenant configuration file
+func Load(path string) (*Config, error) {
+	var cfg *Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read tenant config %v", err)
+	}
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse tenant config %v", err)
+	}
+	return cfg, nil
+}
+
+// freezes - the FREEZE_CONFIG calendars by path, each is read once (by the validator at startup)
+var freezes = struct {
+	sync.Mutex
+	loaded map[string]*Freeze
+}{loaded: make(map[string]*Freeze)}
+
+// freezeFromEnv - private function, the calendar of the FREEZE_CONFIG path (nil when not set)
+// a calendar that cannot be read freezes the routes (the validator reports it at startup)
+func freezeFromEnv(path string) *Freeze {
+	if path == "" {
+		return nil
+	}
+	freezes.Lock()
+	defer freezes.Unlock()
+	if freeze, ok := freezes.loaded[path]; ok {
+		return freeze
+	}
+	var freeze *Freeze
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &freeze)
+	}
+	if err != nil || freeze == nil {
+		freeze = &Freeze{Policy: REJECT, Windows: []Window{{Name: "invalid FREEZE_CONFIG", Days: []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}}}}
+	}
+	freezes.loaded[path] = freeze
+	return freeze
+}
+
+// FromEnv - builds the default tenant from the legacy envars
+// the secret is left empty so that the legacy endpoint keeps its current behaviour
+func FromEnv() *Tenant {
+	t := &Tenant{Name: DEFAULTTENANT, CallbackToken: os.Getenv("CALLBACK_TOKEN")}
+	t.Providers = list(os.Getenv("PROVIDERS"))
+	actions := list(os.Getenv("PR_OPENED_ACTIONS"))
+	if len(actions) == 0 {
+		actions = list(PROPENEDACTIONS)
+	}
+	debounce, _ := strconv.Atoi(os.Getenv("PR_OPENED_DEBOUNCE"))
+	legacy := []Route{
+		{Name: "pr-opened", Event: "pull_request", Actions: actions, URL: os.Getenv("PR_OPENED_URL"), SkipDraft: os.Getenv("SKIP_DRAFT_PRS") == "true",
+			Debounce: debounce},
+		{Name: "pr-merged", Event: "pull_request", Actions: []string{"merged"}, URL: os.Getenv("PR_MERGED_URL")},
+		{Name: "prereleased", Event: "release", Actions: []string{"prereleased"}, URL: os.Getenv("PRERELEASED_URL")},
+		{Name: "released", Event: "release", Actions: []string{"released"}, URL: os.Getenv("RELEASED_URL")},
+		{Name: "tag-pushed", Event: "push", Actions: []string{"tag"}, URL: os.Getenv("TAG_PUSHED_URL")},
+		{Name: "branch-deleted", Event: "delete", Actions: []string{"branch"}, URL: os.Getenv("BRANCH_DELETED_URL")},
+	}
+	var markers []string
+	if m := os.Getenv("SKIP_CI_MARKERS"); m == "none" {
+		markers = []string{}
+	} else {
+		markers = list(m)
+	}
+	for _, r := range legacy {
+		r.SkipMarkers = markers
+		r.CloudEvents = os.Getenv("CLOUDEVENTS_MODE")
+		if r.URL != "" {
+			t.Routes = append(t.Routes, r)
+		}
+	}
+	for _, e := range list(os.Getenv("ENVIRONMENTS")) {
+		if kv := strings.SplitN(e, "=", 2); len(kv) == 2 {
+			t.Environments = append(t.Environments, Environment{Name: kv[0]})
+			t.Routes = append(t.Routes, Route{Name: "deploy-" + kv[0], Event: "release", Actions: []string{"prereleased", "released"}, URL: kv[1], Environment: kv[0]})
+		}
+	}
+	var approval *Approval
+	if os.Getenv("RELEASE_APPROVERS") != "" || os.Getenv("RELEASE_APPROVER_TEAMS") != "" {
+		approval = &Approval{Approvers: list(os.Getenv("RELEASE_APPROVERS")), Teams: list(os.Getenv("RELEASE_APPROVER_TEAMS"))}
+	}
+	freeze := freezeFromEnv(os.Getenv("FREEZE_CONFIG"))
+	for x := range t.Routes {
+		// the production routes
+		if t.Routes[x].Name == "released" || t.Routes[x].Name == "deploy-prod" {
+			t.Routes[x].Approval = approval
+			t.Routes[x].Freeze = freeze
+		}
+	}
+	if os.Getenv("CHATOPS_USERS") != "" || os.Getenv("CHATOPS_ASSOCIATIONS") != "" || os.Getenv("CHATOPS_TEAMS") != "" {
+		t.ChatOps = &ChatOps{
+			Users:        list(os.Getenv("CHATOPS_USERS")),
+			Associations: list(os.Getenv("CHATOPS_ASSOCIATIONS")),
+			Teams:        list(os.Getenv("CHATOPS_TEAMS")),
+			Deploy:       make(map[string]string),
+		}
+		for _, d := range list(os.Getenv("CHATOPS_DEPLOY")) {
+			if kv := strings.SplitN(d, "=", 2); len(kv) == 2 {
+				t.ChatOps.Deploy[kv[0]] = kv[1]
+			}
+		}
+	}
+	if policy := policyFromEnv(); policy != nil {
+		t.Policy = policy
+	}
+	for _, kind := range []string{"slack", "teams"} {
+		if u := os.Getenv("NOTIFY_" + strings.ToUpper(kind) + "_URL"); u != "" {
+			t.Notifiers = append(t.Notifiers, Notifier{Name: kind, Type: kind, URL: u, On: list(os.Getenv("NOTIFY_ON"))})
+		}
+	}
+	if p := os.Getenv("FORGE_PROVIDER"); p != "" {
+		t.Forges = append(t.Forges, Forge{Provider: p, APIURL: os.Getenv("FORGE_API_URL"), Token: os.Getenv("FORGE_TOKEN"), Checks: os.Getenv("FORGE_CHECKS") == "true"})
+	}
+	return t
+}
+
+// policyFromEnv - private function, the legacy policy envars, nil when none is set
+func policyFromEnv() *Policy {
+	p := &Policy{
+		AllowSenders: list(os.Getenv("ALLOW_SENDERS")),
+		DenySenders:  list(os.Getenv("DENY_SENDERS")),
+		AllowAuthors: list(os.Getenv("ALLOW_AUTHORS")),
+		DenyAuthors:  list(os.Getenv("DENY_AUTHORS")),
+		Associations: list(os.Getenv("ALLOW_ASSOCIATIONS")),
+		AllowOwners:  list(os.Getenv("ALLOW_OWNERS")),
+		DenyOwners:   list(os.Getenv("DENY_OWNERS")),
+		Visibility:   list(os.Getenv("ALLOW_VISIBILITY")),
+		Forks:        os.Getenv("FORK_PRS"),
+	}
+	if len(p.AllowSenders)+len(p.DenySenders)+len(p.AllowAuthors)+len(p.DenyAuthors)+len(p.Associations)+
+		len(p.AllowOwners)+len(p.DenyOwners)+len(p.Visibility) == 0 && p.Forks == "" {
+		return nil
+	}
+	return p
+}
+
+// list - private utility function, splits a comma separated envar value
+func list(value string) []string {
+	var items []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			items = append(items, v)
+		}
+	}
+	return items
+}
+
+// Notifies - reports whether the notifier is sent on the condition, for release_forwarded
+// environment is the environment of the release
+func (n *Notifier) Notifies(condition string, environment string) bool {
+	on := n.On
+	if len(on) == 0 {
+		on = list(NOTIFYON)
+	}
+	found := false
+	for _, c := range on {
+		found = found || c == condition
+	}
+	if !found || condition != RELEASEFORWARDED || len(n.Environments) == 0 {
+		return found
+	}
+	for _, e := range n.Environments {
+		if e == environment {
+			return true
+		}
+	}
+	return false
+}
+
+// Route - returns the named route or nil
+func (t *Tenant) Route(name string) *Route {
+	for x := range t.Routes {
+		if t.Routes[x].Name == name {
+			return &t.Routes[x]
+		}
+	}
+	return nil
+}
+
+// Lookup - returns the named tenant or nil
+func (c *Config) Lookup(name string) *Tenant {
+	for x := range c.Tenants {
+		if c.Tenants[x].Name == name {
+			return &c.Tenants[x]
+		}
+	}
+	return nil
+}
+
+// AllowsProvider - an empty provider list or an unknown provider is allowed
+func (t *Tenant) AllowsProvider(provider string) bool {
+	if provider == "" || len(t.Providers) == 0 {
+		return true
+	}
+	for _, p := range t.Providers {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// Forge - returns the forge for the provider, when the provider could not be
+// detected (no event headers) the first forge is used
+func (t *Tenant) Forge(provider string) *Forge {
+	for x := range t.Forges {
+		if t.Forges[x].Provider == provider || (provider == "" && x == 0) {
+			return &t.Forges[x]
+		}
+	}
+	return nil
+}
+
+// Matches - reports whether the route handles the event and action
+func (r *Route) Matches(event, action string) bool {
+	if r.Event != event {
+		return false
+	}
+	for _, a := range r.Actions {
+		if a == action || a == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers - the headers a passthrough route forwards
+func (r *Route) Headers() []string {
+	if r.ForwardHeaders == nil {
+		return list(PASSTHROUGHHEADERS)
+	}
+	return r.ForwardHeaders
+}
+
+// MatchesLabels - reports whether one of the labels is one of the route labels
+// a route without labels matches any (or no) label
+func (r *Route) MatchesLabels(labels []string) bool {
+	if len(r.Labels) == 0 {
+		return true
+	}
+	for _, l := range labels {
+		for _, want := range r.Labels {
+			if l == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasPaths - reports whether the route has path filters
+func (r *Route) HasPaths() bool {
+	return len(r.IncludePaths) > 0 || len(r.ExcludePaths) > 0
+}
+
+// MatchesPaths - reports whether one of the changed files is included and not excluded
+// a route without path filters matches any change
+func (r *Route) MatchesPaths(files []string) bool {
+	if !r.HasPaths() {
+		return true
+	}
+	for _, f := range files {
+		if (len(r.IncludePaths) == 0 || glob.Any(r.IncludePaths, f)) && !glob.Any(r.ExcludePaths, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// SkipMarker - returns the first skip marker found in one of the texts, empty when none
+func (r *Route) SkipMarker(texts ...string) string {
+	markers := r.SkipMarkers
+	if markers == nil {
+		markers = list(SKIPMARKERS)
+	}
+	for _, t := range texts {
+		t = strings.ToLower(t)
+		for _, m := range markers {
+			if strings.Contains(t, strings.ToLower(m)) {
+				return m
+			}
+		}
+	}
+	return ""
+}
+
+// EnvironmentFor - returns the name of the first environment the tag belongs to, empty when none
+// version is the parsed tag (nil when the tag is not a semantic version)
+func (t *Tenant) EnvironmentFor(tag string, version *semver.Version) string {
+	for _, e := range t.Environments {
+		if e.Pattern != "" {
+			if ok, _ := regexp.MatchString(e.Pattern, tag); ok {
+				return e.Name
+			}
+			continue
+		}
+		id := e.Prerelease
+		if id == "" {
+			id = e.Name
+		}
+		if version != nil && version.HasPrerelease(id) {
+			return e.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/semver"
+)
+
+func TestConfig(t *testing.T) {
+
+	t.Run("Load : should pass", func(t *testing.T) {
+		cfg, err := Load("../../tests/tenants.json")
+		if err != nil {
+			t.Fatalf(fmt.Sprintf("Handler %s returned with error - got (%v) wanted (%v)", "Load", err, nil))
+		}
+		tenant := cfg.Lookup("team-a")
+		if tenant == nil || len(tenant.Routes) != 2 {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect tenant - got (%v) wanted (%s)", "Lookup", tenant, "team-a"))
+		}
+		if !tenant.Routes[0].Matches("pull_request", "opened") || tenant.Routes[0].Matches("pull_request", "merged") {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect match for route %s", "Matches", tenant.Routes[0].Name))
+		}
+		if tenant.AllowsProvider("gitlab") || !tenant.AllowsProvider("gitea") {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect result for tenant %s", "AllowsProvider", tenant.Name))
+		}
+	})
+
+	t.Run("Load : should fail", func(t *testing.T) {
+		_, err := Load("../../tests/nothere.json")
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned with no error - got (%v) wanted (%v)", "Load", err, "error"))
+		}
+		_, err = Load("../../tests/git-payload.txt")
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned with no error - got (%v) wanted (%v)", "Load", err, "error"))
+		}
+	})
+
+	t.Run("FromEnv : should pass", func(t *testing.T) {
+		os.Setenv("PROVIDERS", "github, gitea")
+		os.Setenv("PR_OPENED_URL", "http://localhost")
+		os.Setenv("PR_MERGED_URL", "")
+		os.Setenv("PRERELEASED_URL", "")
+		os.Setenv("RELEASED_URL", "http://localhost")
+		tenant := FromEnv()
+		if len(tenant.Routes) != 2 || len(tenant.Providers) != 2 || tenant.Secret != "" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect tenant - got (%v)", "FromEnv", tenant))
+		}
+		if r := tenant.Route("pr-opened"); !r.Matches("pull_request", "synchronize") || r.SkipDraft {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect default actions - got (%v)", "FromEnv", r))
+		}
+	})
+
+	t.Run("FromEnv : should pass (pull request actions and draft policy)", func(t *testing.T) {
+		os.Setenv("PR_OPENED_ACTIONS", "opened, ready_for_review")
+		os.Setenv("SKIP_DRAFT_PRS", "true")
+		r := FromEnv().Route("pr-opened")
+		os.Setenv("PR_OPENED_ACTIONS", "")
+		os.Setenv("SKIP_DRAFT_PRS", "")
+		if r.Matches("pull_request", "synchronize") || !r.Matches("pull_request", "ready_for_review") || !r.SkipDraft {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect route - got (%v)", "FromEnv", r))
+		}
+	})
+
+	t.Run("FromEnv : should pass (freeze calendar read once)", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "freeze.json")
+		ioutil.WriteFile(path, []byte(`{"policy":"defer","windows":[{"name":"weekend","days":["sat","sun"]}]}`), 0600)
+		os.Setenv("RELEASED_URL", "http://el-prod:8080")
+		os.Setenv("FREEZE_CONFIG", path)
+		defer os.Setenv("RELEASED_URL", "")
+		defer os.Setenv("FREEZE_CONFIG", "")
+		first := FromEnv().Route("released").Freeze
+		os.Remove(path)
+		if second := FromEnv().Route("released").Freeze; first == nil || second != first || first.Policy != "defer" {
+			t.Errorf(fmt.Sprintf("Handler %s re-read the freeze calendar - got (%v %v)", "FromEnv", first, second))
+		}
+	})
+
+	t.Run("EnvironmentFor : should pass (pattern and pre-release identifier)", func(t *testing.T) {
+		tenant := &Tenant{Environments: []Environment{{Name: "prod", Pattern: "-PROD$"}, {Name: "uat"}, {Name: "staging", Prerelease: "rc"}}}
+		tests := map[string]string{"v1.0.1-PROD": "prod", "v1.0.1-UAT": "uat", "v2.0.0-rc.1": "staging", "v1.0.1": "", "nightly": ""}
+		for tag, want := range tests {
+			version, _ := semver.Parse(tag)
+			if got := tenant.EnvironmentFor(tag, version); got != want {
+				t.Errorf(fmt.Sprintf("Handler %s returned incorrect environment for %s - got (%s) wanted (%s)", "EnvironmentFor", tag, got, want))
+			}
+		}
+	})
+
+	t.Run("MatchesPaths : should pass (include and exclude)", func(t *testing.T) {
+		r := &Route{IncludePaths: []string{"services/api"}, ExcludePaths: []string{"**/*.md"}}
+		if !r.MatchesPaths([]string{"README.md", "services/api/main.go"}) || r.MatchesPaths([]string{"services/api/README.md"}) || r.MatchesPaths(nil) {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect result for %v", "MatchesPaths", r))
+		}
+		if r = (&Route{}); !r.MatchesPaths(nil) {
+			t.Errorf(fmt.Sprintf("Handler %s did not match a route without path filters", "MatchesPaths"))
+		}
+	})
+
+	t.Run("SkipMarker : should pass (default, custom and disabled markers)", func(t *testing.T) {
+		if m := (&Route{}).SkipMarker("docs", "Fix typo [CI SKIP]"); m != "[ci skip]" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect marker - got (%s) wanted (%s)", "SkipMarker", m, "[ci skip]"))
+		}
+		if m := (&Route{SkipMarkers: []string{"[no-deploy]"}}).SkipMarker("[skip ci] [no-deploy]"); m != "[no-deploy]" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect marker - got (%s) wanted (%s)", "SkipMarker", m, "[no-deploy]"))
+		}
+		if m := (&Route{SkipMarkers: []string{}}).SkipMarker("[skip ci]"); m != "" {
+			t.Errorf(fmt.Sprintf("Handler %s returned a disabled marker - got (%s)", "SkipMarker", m))
+		}
+	})
+}
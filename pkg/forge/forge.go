@@ -0,0 +1,155 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+)
+
+// commit status states, providers with other names map them internally
+// running is reported as pending where the provider has no such state
+const (
+	PENDING string = "pending"
+	RUNNING string = "running"
+	SUCCESS string = "success"
+	FAILURE string = "failure"
+	ERROR   string = "error"
+)
+
+// ErrNotSupported - returned for calls the provider api does not offer
+var ErrNotSupported = errors.New("not supported by this forge provider")
+
+// StatusError - the provider api answered with a non 2xx status code
+type StatusError struct {
+	Method string
+	URL    string
+	Code   int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s returned %d", e.Method, e.URL, e.Code)
+}
+
+// isNotFound - private utility function, reports whether the api answered 404
+func isNotFound(err error) bool {
+	var status *StatusError
+	return errors.As(err, &status) && status.Code == http.StatusNotFound
+}
+
+// Status - a commit status as shown on the pull request
+type Status struct {
+	State       string `json:"state"`
+	Context     string `json:"context"`
+	Description string `json:"description"`
+	TargetURL   string `json:"target_url,omitempty"`
+}
+
+// CheckRun - a github check run, only the fields that are set are sent
+type CheckRun struct {
+	ID         int64        `json:"id,omitempty"`
+	Name       string       `json:"name,omitempty"`
+	HeadSha    string       `json:"head_sha,omitempty"`
+	Status     string       `json:"status,omitempty"`
+	Conclusion string       `json:"conclusion,omitempty"`
+	ExternalID string       `json:"external_id,omitempty"`
+	DetailsURL string       `json:"details_url,omitempty"`
+	Output     *CheckOutput `json:"output,omitempty"`
+}
+
+// CheckOutput - the title and summary shown on the check run
+type CheckOutput struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+}
+
+// PullRequest - the provider independent fields of a pull (merge) request
+type PullRequest struct {
+	Number  int
+	Title   string
+	Body    string
+	Author  string
+	HeadRef string
+	HeadSha string
+	Draft   bool
+	Merged  bool
+	// Fork is set when the head branch lives in another repository,
+	// Association is the author association of the author (github only)
+	Fork        bool
+	Association string
+}
+
+// Client - the provider specific forge api, repo is the full name (owner/name)
+// All calls go through connectors.Clients so that they can be faked in tests
+type Client interface {
+	SetStatus(ctx context.Context, repo string, sha string, status Status) error
+	CreateComment(ctx context.Context, repo string, number int, body string) error
+	CreateCheckRun(ctx context.Context, repo string, run CheckRun) (int64, error)
+	UpdateCheckRun(ctx context.Context, repo string, id int64, run CheckRun) error
+	GetPullRequest(ctx context.Context, repo string, number int) (*PullRequest, error)
+	IsTeamMember(ctx context.Context, team string, user string) (bool, error)
+	AddReaction(ctx context.Context, repo string, commentID int64, reaction string) error
+	ResolveTag(ctx context.Context, repo string, tag string) (string, error)
+	ChangedFiles(ctx context.Context, repo string, number int) ([]string, error)
+}
+
+// MAXFILEPAGES - changed files are read up to this many pages (github lists at most 3000 files)
+const MAXFILEPAGES int = 30
+
+// MAXTAGDEPTH - annotated tags pointing at other tags are peeled up to this many times
+const MAXTAGDEPTH int = 5
+
+// New - returns the api client for the provider
+// apiURL is the api root (https://api.github.com, https://gitea.example.com/api/v1, https://gitlab.com/api/v4)
+func New(provider string, apiURL string, token string, con connectors.Clients) (Client, error) {
+	switch provider {
+	case "github":
+		if apiURL == "" {
+			apiURL = "https://api.github.com"
+		}
+		return &github{provider: provider, base: apiURL, auth: "Bearer " + token, con: con}, nil
+	case "gitea":
+		return &github{provider: provider, base: apiURL, auth: "token " + token, con: con}, nil
+	case "gitlab":
+		return &gitlab{base: apiURL, token: token, con: con}, nil
+	}
+	return nil, fmt.Errorf("forge provider %q is not supported", provider)
+}
+
+// doRequest - private utility function, sends the json body and decodes the json response into out (when not nil)
+func doRequest(ctx context.Context, con connectors.Clients, method string, url string, headers map[string]string, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		body, _ = json.Marshal(in)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	con.Debug("Function doRequest %s %s", method, url)
+	resp, err := con.Do(req)
+	if err != nil {
+		con.Error("Function doRequest http request %v", err)
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		con.Error("Function doRequest response code %d %s", resp.StatusCode, string(data))
+		return &StatusError{Method: method, URL: url, Code: resp.StatusCode}
+	}
+	if out != nil && len(data) > 0 {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+// fakeClients - records the requests and answers with the given status code
+type fakeClients struct {
+	code     int
+	response string
+	// pages are returned in turn (then an empty list) instead of response
+	pages    []string
+	requests []*http.Request
+	bodies   []string
+}
+
+func (f *fakeClients) Error(string, ...interface{}) {}
+func (f *fakeClients) Info(string, ...interface{})  {}
+func (f *fakeClients) Debug(string, ...interface{}) {}
+func (f *fakeClients) Trace(string, ...interface{}) {}
+
+func (f *fakeClients) Do(req *http.Request) (*http.Response, error) {
+	body, _ := ioutil.ReadAll(req.Body)
+	f.requests = append(f.requests, req)
+	f.bodies = append(f.bodies, string(body))
+	response := f.response
+	if f.pages != nil {
+		response = "[]"
+		if len(f.requests) <= len(f.pages) {
+			response = f.pages[len(f.requests)-1]
+		}
+	}
+	return &http.Response{
+		StatusCode: f.code,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(response)),
+		Header:     make(http.Header),
+	}, nil
+}
+
+func TestForge(t *testing.T) {
+	status := Status{State: PENDING, Context: "tekton/pr-opened", Description: "Pipeline triggered"}
+
+	t.Run("SetStatus : should pass (github)", func(t *testing.T) {
+		con := &fakeClients{code: 201}
+		client, _ := New("github", "", "abc", con)
+		err := client.SetStatus(context.Background(), "owner/repo", "123abc", status)
+		if err != nil {
+			t.Fatalf(fmt.Sprintf("Handler %s returned with error - got (%v) wanted (%v)", "SetStatus", err, nil))
+		}
+		req := con.requests[0]
+		var sent Status
+		json.Unmarshal([]byte(con.bodies[0]), &sent)
+		if req.URL.String() != "https://api.github.com/repos/owner/repo/statuses/123abc" || req.Header.Get("Authorization") != "Bearer abc" || sent != status {
+			t.Errorf(fmt.Sprintf("Handler %s sent incorrect request - got (%s %v %s)", "SetStatus", req.URL, req.Header, con.bodies[0]))
+		}
+	})
+
+	t.Run("SetStatus : should pass (gitea)", func(t *testing.T) {
+		con := &fakeClients{code: 201}
+		client, _ := New("gitea", "https://gitea.local/api/v1", "abc", con)
+		client.SetStatus(context.Background(), "owner/repo", "123abc", status)
+		req := con.requests[0]
+		if req.URL.String() != "https://gitea.local/api/v1/repos/owner/repo/statuses/123abc" || req.Header.Get("Authorization") != "token abc" {
+			t.Errorf(fmt.Sprintf("Handler %s sent incorrect request - got (%s %v)", "SetStatus", req.URL, req.Header))
+		}
+	})
+
+	t.Run("SetStatus : should pass (gitlab)", func(t *testing.T) {
+		con := &fakeClients{code: 201}
+		client, _ := New("gitlab", "https://gitlab.local/api/v4", "abc", con)
+		client.SetStatus(context.Background(), "group/repo", "123abc", Status{State: ERROR, Context: "tekton/pr"})
+		req := con.requests[0]
+		if req.URL.Path != "/api/v4/projects/group/repo/statuses/123abc" || req.URL.RawPath != "/api/v4/projects/group%2Frepo/statuses/123abc" || req.URL.Query().Get("state") != "failed" || req.Header.Get("PRIVATE-TOKEN") != "abc" {
+			t.Errorf(fmt.Sprintf("Handler %s sent incorrect request - got (%s %v)", "SetStatus", req.URL, req.Header))
+		}
+	})
+
+	t.Run("SetStatus : should fail (api error)", func(t *testing.T) {
+		con := &fakeClients{code: 422}
+		client, _ := New("github", "", "abc", con)
+		err := client.SetStatus(context.Background(), "owner/repo", "123abc", status)
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned with no error - got (%v) wanted (%v)", "SetStatus", err, "error"))
+		}
+	})
+
+	t.Run("New : should fail (unsupported provider)", func(t *testing.T) {
+		_, err := New("bitbucket", "", "abc", &fakeClients{})
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned with no error - got (%v) wanted (%v)", "New", err, "error"))
+		}
+	})
+
+	t.Run("CreateComment : should pass (github and gitlab)", func(t *testing.T) {
+		con := &fakeClients{code: 201}
+		client, _ := New("github", "", "abc", con)
+		client.CreateComment(context.Background(), "owner/repo", 7, "done")
+		client, _ = New("gitlab", "https://gitlab.local/api/v4", "abc", con)
+		client.CreateComment(context.Background(), "group/repo", 7, "done")
+		if con.requests[0].URL.Path != "/repos/owner/repo/issues/7/comments" || con.requests[1].URL.Path != "/api/v4/projects/group/repo/merge_requests/7/notes" || con.bodies[0] != "{\"body\":\"done\"}" {
+			t.Errorf(fmt.Sprintf("Handler %s sent incorrect requests - got (%s %s)", "CreateComment", con.requests[0].URL, con.requests[1].URL))
+		}
+	})
+
+	t.Run("GetPullRequest : should pass (github and gitlab)", func(t *testing.T) {
+		con := &fakeClients{code: 200, response: `{"number":3,"title":"t","draft":true,"user":{"login":"dev"},"head":{"ref":"b","sha":"abc"}}`}
+		client, _ := New("github", "", "abc", con)
+		pr, err := client.GetPullRequest(context.Background(), "owner/repo", 3)
+		if err != nil || pr.HeadSha != "abc" || pr.Author != "dev" || !pr.Draft {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect pull request - got (%v %v)", "GetPullRequest", pr, err))
+		}
+		con = &fakeClients{code: 200, response: `{"iid":3,"title":"t","state":"merged","sha":"def","source_branch":"b","author":{"username":"dev"}}`}
+		client, _ = New("gitlab", "https://gitlab.local/api/v4", "abc", con)
+		pr, err = client.GetPullRequest(context.Background(), "group/repo", 3)
+		if err != nil || pr.HeadSha != "def" || !pr.Merged {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect merge request - got (%v %v)", "GetPullRequest", pr, err))
+		}
+	})
+
+	t.Run("IsTeamMember : should pass (github and gitea)", func(t *testing.T) {
+		con := &fakeClients{code: 200, response: `{"state":"active"}`}
+		client, _ := New("github", "", "abc", con)
+		ok, _ := client.IsTeamMember(context.Background(), "org/ci", "dev")
+		if !ok || con.requests[0].URL.Path != "/orgs/org/teams/ci/memberships/dev" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect membership - got (%t %s)", "IsTeamMember", ok, con.requests[0].URL))
+		}
+		con = &fakeClients{code: 200, response: `{"data":[{"id":7,"name":"ci"}]}`}
+		client, _ = New("gitea", "https://gitea.local/api/v1", "abc", con)
+		ok, _ = client.IsTeamMember(context.Background(), "org/ci", "dev")
+		if !ok || con.requests[1].URL.Path != "/api/v1/teams/7/members/dev" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect membership - got (%t)", "IsTeamMember", ok))
+		}
+		if _, err := client.IsTeamMember(context.Background(), "ci", "dev"); err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned with no error for a team without org", "IsTeamMember"))
+		}
+	})
+
+	t.Run("IsTeamMember : should fail (only 404 means not a member)", func(t *testing.T) {
+		con := &fakeClients{code: 404, response: `{"message":"Not Found"}`}
+		client, _ := New("github", "", "abc", con)
+		if ok, err := client.IsTeamMember(context.Background(), "org/ci", "dev"); ok || err != nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect membership - got (%t %v)", "IsTeamMember", ok, err))
+		}
+		con = &fakeClients{code: 403, response: `{"message":"Resource not accessible by integration"}`}
+		client, _ = New("github", "", "abc", con)
+		if ok, err := client.IsTeamMember(context.Background(), "org/ci", "dev"); ok || err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s hid the api error - got (%t %v)", "IsTeamMember", ok, err))
+		}
+		con = &fakeClients{code: 200, response: `{"data":[]}`}
+		client, _ = New("gitea", "https://gitea.local/api/v1", "abc", con)
+		client.IsTeamMember(context.Background(), "org/release managers&x=1", "dev")
+		if q := con.requests[0].URL.Query(); q.Get("q") != "release managers&x=1" || q.Get("x") != "" {
+			t.Errorf(fmt.Sprintf("Handler %s did not escape the team search - got (%s)", "IsTeamMember", con.requests[0].URL))
+		}
+	})
+
+	t.Run("AddReaction : should fail (gitlab)", func(t *testing.T) {
+		client, _ := New("gitlab", "https://gitlab.local/api/v4", "abc", &fakeClients{})
+		if err := client.AddReaction(context.Background(), "group/repo", 1, "+1"); err != ErrNotSupported {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect error - got (%v) wanted (%v)", "AddReaction", err, ErrNotSupported))
+		}
+	})
+
+	t.Run("ResolveTag : should pass (github, gitea and gitlab)", func(t *testing.T) {
+		con := &fakeClients{code: 200, response: `{"ref":"refs/tags/v1.0.1","object":{"sha":"abc123","type":"commit"}}`}
+		client, _ := New("github", "", "abc", con)
+		sha, err := client.ResolveTag(context.Background(), "owner/repo", "v1.0.1")
+		if err != nil || sha != "abc123" || len(con.requests) != 1 || con.requests[0].URL.Path != "/repos/owner/repo/git/ref/tags/v1.0.1" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect sha - got (%s %v)", "ResolveTag", sha, err))
+		}
+		// an annotated tag is peeled to the commit it tags
+		con = &fakeClients{code: 200, pages: []string{`{"object":{"sha":"tag111","type":"tag"}}`, `{"sha":"tag111","object":{"sha":"abc456","type":"commit"}}`}}
+		client, _ = New("github", "", "abc", con)
+		sha, err = client.ResolveTag(context.Background(), "owner/repo", "v1.0.1")
+		if err != nil || sha != "abc456" || len(con.requests) != 2 || con.requests[1].URL.Path != "/repos/owner/repo/git/tags/tag111" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect annotated sha - got (%s %v)", "ResolveTag", sha, err))
+		}
+		con = &fakeClients{code: 200, response: `{"object":{"sha":"tree789","type":"tree"}}`}
+		client, _ = New("github", "", "abc", con)
+		if sha, err = client.ResolveTag(context.Background(), "owner/repo", "v1.0.1"); err == nil || sha != "" {
+			t.Errorf(fmt.Sprintf("Handler %s resolved a tag of a tree - got (%s)", "ResolveTag", sha))
+		}
+		con = &fakeClients{code: 200, response: `{"name":"v1.0.1","commit":{"sha":"def456"}}`}
+		client, _ = New("gitea", "https://gitea.local/api/v1", "abc", con)
+		sha, _ = client.ResolveTag(context.Background(), "owner/repo", "v1.0.1")
+		if sha != "def456" || con.requests[0].URL.Path != "/api/v1/repos/owner/repo/tags/v1.0.1" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect sha - got (%s)", "ResolveTag", sha))
+		}
+		con = &fakeClients{code: 200, response: `{"name":"v1.0.1","commit":{"id":"789abc"}}`}
+		client, _ = New("gitlab", "https://gitlab.local/api/v4", "abc", con)
+		sha, _ = client.ResolveTag(context.Background(), "group/repo", "v1.0.1")
+		if sha != "789abc" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect sha - got (%s)", "ResolveTag", sha))
+		}
+	})
+
+	t.Run("ChangedFiles : should pass (github pages, gitea and gitlab)", func(t *testing.T) {
+		con := &fakeClients{code: 200, pages: []string{`[{"filename":"services/api/main.go"},{"filename":"docs/api.md","previous_filename":"docs/old.md"}]`, `[{"filename":"go.mod"}]`}}
+		client, _ := New("github", "", "abc", con)
+		files, err := client.ChangedFiles(context.Background(), "owner/repo", 7)
+		if err != nil || len(files) != 4 || files[2] != "docs/old.md" || len(con.requests) != 3 || con.requests[1].URL.RawQuery != "per_page=100&page=2" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect files - got (%v %v %d)", "ChangedFiles", files, err, len(con.requests)))
+		}
+		con = &fakeClients{code: 200, pages: []string{`[{"filename":"README.md"}]`}}
+		client, _ = New("gitea", "https://gitea.local/api/v1", "abc", con)
+		files, _ = client.ChangedFiles(context.Background(), "owner/repo", 7)
+		if len(files) != 1 || con.requests[0].URL.Path != "/api/v1/repos/owner/repo/pulls/7/files" || con.requests[0].URL.Query().Get("limit") != "100" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect files - got (%v)", "ChangedFiles", files))
+		}
+		con = &fakeClients{code: 200, pages: []string{`[{"old_path":"a.go","new_path":"b.go"},{"old_path":"c.go","new_path":"c.go"}]`, `[{"old_path":"d.go","new_path":"d.go"}]`}}
+		client, _ = New("gitlab", "https://gitlab.local/api/v4", "abc", con)
+		files, _ = client.ChangedFiles(context.Background(), "group/repo", 7)
+		if len(files) != 4 || files[1] != "a.go" || len(con.requests) != 3 || con.requests[1].URL.EscapedPath() != "/api/v4/projects/group%2Frepo/merge_requests/7/diffs" ||
+			con.requests[1].URL.RawQuery != "per_page=100&page=2" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect files - got (%v)", "ChangedFiles", files))
+		}
+	})
+
+	t.Run("ChangedFiles : should fail (api error)", func(t *testing.T) {
+		con := &fakeClients{code: 404, response: `{"message":"Not Found"}`}
+		client, _ := New("github", "", "abc", con)
+		if _, err := client.ChangedFiles(context.Background(), "owner/repo", 7); err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned no error - got (%v) wanted (%v)", "ChangedFiles", err, "error"))
+		}
+	})
+}
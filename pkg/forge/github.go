@@ -0,0 +1,226 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+	"strings"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+)
+
+// githubPullRequest - the fields of the pull request api response that are used
+type githubPullRequest struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	Draft  bool   `json:"draft"`
+	Merged bool   `json:"merged"`
+	User   struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Head struct {
+		Ref  string `json:"ref"`
+		Sha  string `json:"sha"`
+		Repo struct {
+			FullName string `json:"full_name"`
+		} `json:"repo"`
+	} `json:"head"`
+	Base struct {
+		Repo struct {
+			FullName string `json:"full_name"`
+		} `json:"repo"`
+	} `json:"base"`
+	AuthorAssociation string `json:"author_association"`
+}
+
+// github - github api client, gitea mirrors the same paths and payloads
+// so it is served by this client with a different auth scheme and no checks api
+type github struct {
+	provider string
+	base     string
+	auth     string
+	con      connectors.Clients
+}
+
+func (g *github) headers() map[string]string {
+	return map[string]string{"Authorization": g.auth}
+}
+
+// SetStatus - POST /repos/{owner}/{repo}/statuses/{sha}
+func (g *github) SetStatus(ctx context.Context, repo string, sha string, status Status) error {
+	url := fmt.Sprintf("%s/repos/%s/statuses/%s", g.base, repo, sha)
+	if status.State == RUNNING {
+		status.State = PENDING
+	}
+	return doRequest(ctx, g.con, "POST", url, g.headers(), status, nil)
+}
+
+// CreateComment - POST /repos/{owner}/{repo}/issues/{number}/comments
+func (g *github) CreateComment(ctx context.Context, repo string, number int, body string) error {
+	url := fmt.Sprintf("%s/repos/%s/issues/%d/comments", g.base, repo, number)
+	return doRequest(ctx, g.con, "POST", url, g.headers(), map[string]string{"body": body}, nil)
+}
+
+// CreateCheckRun - POST /repos/{owner}/{repo}/check-runs, returns the check run id
+func (g *github) CreateCheckRun(ctx context.Context, repo string, run CheckRun) (int64, error) {
+	var created CheckRun
+	if g.provider != "github" {
+		return 0, ErrNotSupported
+	}
+	url := fmt.Sprintf("%s/repos/%s/check-runs", g.base, repo)
+	err := doRequest(ctx, g.con, "POST", url, g.headers(), run, &created)
+	return created.ID, err
+}
+
+// UpdateCheckRun - PATCH /repos/{owner}/{repo}/check-runs/{id}
+func (g *github) UpdateCheckRun(ctx context.Context, repo string, id int64, run CheckRun) error {
+	if g.provider != "github" {
+		return ErrNotSupported
+	}
+	url := fmt.Sprintf("%s/repos/%s/check-runs/%d", g.base, repo, id)
+	return doRequest(ctx, g.con, "PATCH", url, g.headers(), run, nil)
+}
+
+// GetPullRequest - GET /repos/{owner}/{repo}/pulls/{number}
+func (g *github) GetPullRequest(ctx context.Context, repo string, number int) (*PullRequest, error) {
+	var pr githubPullRequest
+	url := fmt.Sprintf("%s/repos/%s/pulls/%d", g.base, repo, number)
+	if err := doRequest(ctx, g.con, "GET", url, g.headers(), nil, &pr); err != nil {
+		return nil, err
+	}
+	return &PullRequest{
+		Number:  pr.Number,
+		Title:   pr.Title,
+		Body:    pr.Body,
+		Author:  pr.User.Login,
+		HeadRef: pr.Head.Ref,
+		HeadSha: pr.Head.Sha,
+		Draft:   pr.Draft,
+		Merged:  pr.Merged,
+		// a deleted fork (no head repo) is treated as a fork
+		Fork:        pr.Head.Repo.FullName != pr.Base.Repo.FullName,
+		Association: pr.AuthorAssociation,
+	}, nil
+}
+
+// IsTeamMember - team is org/team-slug
+// github: GET /orgs/{org}/teams/{slug}/memberships/{user}
+// gitea: GET /orgs/{org}/teams/search?q={slug} then GET /teams/{id}/members/{user}
+func (g *github) IsTeamMember(ctx context.Context, team string, user string) (bool, error) {
+	parts := strings.SplitN(team, "/", 2)
+	if len(parts) != 2 {
+		return false, fmt.Errorf("team %q should be of the form org/team", team)
+	}
+	if g.provider == "github" {
+		var membership struct {
+			State string `json:"state"`
+		}
+		url := fmt.Sprintf("%s/orgs/%s/teams/%s/memberships/%s", g.base, neturl.PathEscape(parts[0]), neturl.PathEscape(parts[1]), neturl.PathEscape(user))
+		// a 404 is returned for non members, any other error is reported
+		if err := doRequest(ctx, g.con, "GET", url, g.headers(), nil, &membership); err != nil {
+			if isNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return membership.State == "active", nil
+	}
+	var search struct {
+		Data []struct {
+			ID   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	url := fmt.Sprintf("%s/orgs/%s/teams/search?q=%s", g.base, neturl.PathEscape(parts[0]), neturl.QueryEscape(parts[1]))
+	if err := doRequest(ctx, g.con, "GET", url, g.headers(), nil, &search); err != nil {
+		return false, err
+	}
+	for _, t := range search.Data {
+		if strings.EqualFold(t.Name, parts[1]) {
+			url = fmt.Sprintf("%s/teams/%d/members/%s", g.base, t.ID, neturl.PathEscape(user))
+			err := doRequest(ctx, g.con, "GET", url, g.headers(), nil, nil)
+			if isNotFound(err) {
+				return false, nil
+			}
+			return err == nil, err
+		}
+	}
+	return false, nil
+}
+
+// AddReaction - POST /repos/{owner}/{repo}/issues/comments/{id}/reactions
+func (g *github) AddReaction(ctx context.Context, repo string, commentID int64, reaction string) error {
+	url := fmt.Sprintf("%s/repos/%s/issues/comments/%d/reactions", g.base, repo, commentID)
+	return doRequest(ctx, g.con, "POST", url, g.headers(), map[string]string{"content": reaction}, nil)
+}
+
+// ChangedFiles - returns the files changed by the pull request, renamed files are listed with their previous name
+// github: GET /repos/{owner}/{repo}/pulls/{number}/files?per_page=100&page={page}
+// gitea: GET /repos/{owner}/{repo}/pulls/{index}/files?limit=100&page={page} (the server may cap the limit)
+func (g *github) ChangedFiles(ctx context.Context, repo string, number int) ([]string, error) {
+	var files []string
+	size := "per_page"
+	if g.provider != "github" {
+		size = "limit"
+	}
+	for page := 1; page <= MAXFILEPAGES; page++ {
+		var list []struct {
+			Filename         string `json:"filename"`
+			PreviousFilename string `json:"previous_filename"`
+		}
+		url := fmt.Sprintf("%s/repos/%s/pulls/%d/files?%s=100&page=%d", g.base, repo, number, size, page)
+		if err := doRequest(ctx, g.con, "GET", url, g.headers(), nil, &list); err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			break
+		}
+		for _, f := range list {
+			files = append(files, f.Filename)
+			if f.PreviousFilename != "" {
+				files = append(files, f.PreviousFilename)
+			}
+		}
+	}
+	return files, nil
+}
+
+// ResolveTag - returns the commit sha the tag points to (annotated tags are dereferenced)
+// github: GET /repos/{owner}/{repo}/git/ref/tags/{tag}, then GET /repos/{owner}/{repo}/git/tags/{sha} while the object is a tag
+// (commits/{tag} would also resolve a branch of the same name)
+// gitea: GET /repos/{owner}/{repo}/tags/{tag}
+func (g *github) ResolveTag(ctx context.Context, repo string, tag string) (string, error) {
+	if g.provider != "github" {
+		var commit struct {
+			Commit struct {
+				Sha string `json:"sha"`
+			} `json:"commit"`
+		}
+		url := fmt.Sprintf("%s/repos/%s/tags/%s", g.base, repo, neturl.PathEscape(tag))
+		if err := doRequest(ctx, g.con, "GET", url, g.headers(), nil, &commit); err != nil {
+			return "", err
+		}
+		return commit.Commit.Sha, nil
+	}
+	var ref struct {
+		Object struct {
+			Sha  string `json:"sha"`
+			Type string `json:"type"`
+		} `json:"object"`
+	}
+	url := fmt.Sprintf("%s/repos/%s/git/ref/tags/%s", g.base, repo, neturl.PathEscape(tag))
+	if err := doRequest(ctx, g.con, "GET", url, g.headers(), nil, &ref); err != nil {
+		return "", err
+	}
+	for depth := 0; ref.Object.Type == "tag" && depth < MAXTAGDEPTH; depth++ {
+		url = fmt.Sprintf("%s/repos/%s/git/tags/%s", g.base, repo, ref.Object.Sha)
+		if err := doRequest(ctx, g.con, "GET", url, g.headers(), nil, &ref); err != nil {
+			return "", err
+		}
+	}
+	if ref.Object.Type != "commit" {
+		return "", fmt.Errorf("tag %s points to a %s, not a commit", tag, ref.Object.Type)
+	}
+	return ref.Object.Sha, nil
+}
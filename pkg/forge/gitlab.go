@@ -0,0 +1,158 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+)
+
+// gitlab - gitlab api client, projects are addressed by their url encoded full path
+type gitlab struct {
+	base  string
+	token string
+	con   connectors.Clients
+}
+
+func (g *gitlab) headers() map[string]string {
+	return map[string]string{"PRIVATE-TOKEN": g.token}
+}
+
+func (g *gitlab) project(repo string) string {
+	return fmt.Sprintf("%s/projects/%s", g.base, url.PathEscape(repo))
+}
+
+// gitlabState - private utility function, gitlab has no error state
+func gitlabState(state string) string {
+	switch state {
+	case ERROR, FAILURE:
+		return "failed"
+	}
+	return state
+}
+
+// SetStatus - POST /projects/{id}/statuses/{sha}
+func (g *gitlab) SetStatus(ctx context.Context, repo string, sha string, status Status) error {
+	q := url.Values{}
+	q.Set("state", gitlabState(status.State))
+	q.Set("name", status.Context)
+	q.Set("description", status.Description)
+	if status.TargetURL != "" {
+		q.Set("target_url", status.TargetURL)
+	}
+	u := fmt.Sprintf("%s/statuses/%s?%s", g.project(repo), sha, q.Encode())
+	return doRequest(ctx, g.con, "POST", u, g.headers(), nil, nil)
+}
+
+// CreateComment - POST /projects/{id}/merge_requests/{iid}/notes
+func (g *gitlab) CreateComment(ctx context.Context, repo string, number int, body string) error {
+	u := fmt.Sprintf("%s/merge_requests/%d/notes", g.project(repo), number)
+	return doRequest(ctx, g.con, "POST", u, g.headers(), map[string]string{"body": body}, nil)
+}
+
+// CreateCheckRun - gitlab has no checks api, commit statuses are used instead
+func (g *gitlab) CreateCheckRun(ctx context.Context, repo string, run CheckRun) (int64, error) {
+	return 0, ErrNotSupported
+}
+
+// UpdateCheckRun - gitlab has no checks api, commit statuses are used instead
+func (g *gitlab) UpdateCheckRun(ctx context.Context, repo string, id int64, run CheckRun) error {
+	return ErrNotSupported
+}
+
+// GetPullRequest - GET /projects/{id}/merge_requests/{iid}
+func (g *gitlab) GetPullRequest(ctx context.Context, repo string, number int) (*PullRequest, error) {
+	var mr struct {
+		IID          int    `json:"iid"`
+		Title        string `json:"title"`
+		Description  string `json:"description"`
+		Draft        bool   `json:"draft"`
+		State        string `json:"state"`
+		SHA          string `json:"sha"`
+		SourceBranch string `json:"source_branch"`
+		Source       int    `json:"source_project_id"`
+		Target       int    `json:"target_project_id"`
+		Author       struct {
+			Username string `json:"username"`
+		} `json:"author"`
+	}
+	u := fmt.Sprintf("%s/merge_requests/%d", g.project(repo), number)
+	if err := doRequest(ctx, g.con, "GET", u, g.headers(), nil, &mr); err != nil {
+		return nil, err
+	}
+	return &PullRequest{
+		Number:  mr.IID,
+		Title:   mr.Title,
+		Body:    mr.Description,
+		Author:  mr.Author.Username,
+		HeadRef: mr.SourceBranch,
+		HeadSha: mr.SHA,
+		Draft:   mr.Draft,
+		Merged:  mr.State == "merged",
+		Fork:    mr.Source != mr.Target,
+	}, nil
+}
+
+// IsTeamMember - team is the group path, GET /groups/{id}/members/all?query={user}
+func (g *gitlab) IsTeamMember(ctx context.Context, team string, user string) (bool, error) {
+	var members []struct {
+		Username string `json:"username"`
+		State    string `json:"state"`
+	}
+	u := fmt.Sprintf("%s/groups/%s/members/all?query=%s", g.base, url.PathEscape(team), url.QueryEscape(user))
+	if err := doRequest(ctx, g.con, "GET", u, g.headers(), nil, &members); err != nil {
+		return false, err
+	}
+	for _, m := range members {
+		if m.Username == user && m.State == "active" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AddReaction - gitlab award emoji on notes needs the merge request iid, replies are used instead
+func (g *gitlab) AddReaction(ctx context.Context, repo string, commentID int64, reaction string) error {
+	return ErrNotSupported
+}
+
+// ChangedFiles - GET /projects/{id}/merge_requests/{iid}/diffs?per_page=100&page={page}, renamed files are listed
+// with their old path (the changes endpoint is deprecated and truncates large merge requests)
+func (g *gitlab) ChangedFiles(ctx context.Context, repo string, number int) ([]string, error) {
+	var files []string
+	for page := 1; page <= MAXFILEPAGES; page++ {
+		var diffs []struct {
+			OldPath string `json:"old_path"`
+			NewPath string `json:"new_path"`
+		}
+		u := fmt.Sprintf("%s/merge_requests/%d/diffs?per_page=100&page=%d", g.project(repo), number, page)
+		if err := doRequest(ctx, g.con, "GET", u, g.headers(), nil, &diffs); err != nil {
+			return nil, err
+		}
+		if len(diffs) == 0 {
+			break
+		}
+		for _, d := range diffs {
+			files = append(files, d.NewPath)
+			if d.OldPath != d.NewPath {
+				files = append(files, d.OldPath)
+			}
+		}
+	}
+	return files, nil
+}
+
+// ResolveTag - GET /projects/{id}/repository/tags/{tag}, returns the commit the tag points to
+func (g *gitlab) ResolveTag(ctx context.Context, repo string, tag string) (string, error) {
+	var t struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	u := fmt.Sprintf("%s/repository/tags/%s", g.project(repo), url.PathEscape(tag))
+	if err := doRequest(ctx, g.con, "GET", u, g.headers(), nil, &t); err != nil {
+		return "", err
+	}
+	return t.Commit.ID, nil
+}
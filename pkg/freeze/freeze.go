@@ -0,0 +1,184 @@
+package freeze
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+)
+
+// MAXCHAIN - adjoining windows (a weekend followed by a holiday) are followed up to this many times
+// to find the end of the freeze
+const MAXCHAIN int = 32
+
+var days = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Calendar - a parsed freeze configuration
+type Calendar struct {
+	location *time.Location
+	windows  []window
+}
+
+// window - start and end of recurring windows are minutes from midnight
+type window struct {
+	name        string
+	days        map[time.Weekday]bool
+	start, end  int
+	from, until time.Time
+}
+
+// Parse - checks and parses the freeze configuration
+func Parse(f *config.Freeze) (*Calendar, error) {
+	location := time.UTC
+	if f.Timezone != "" {
+		l, err := time.LoadLocation(f.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("timezone %v", err)
+		}
+		location = l
+	}
+	if f.Policy != "" && f.Policy != config.DEFER && f.Policy != config.REJECT {
+		return nil, fmt.Errorf("policy %q should be defer or reject", f.Policy)
+	}
+	c := &Calendar{location: location}
+	for _, w := range f.Windows {
+		parsed, err := parseWindow(w, location)
+		if err != nil {
+			return nil, fmt.Errorf("window %s %v", w.Name, err)
+		}
+		c.windows = append(c.windows, parsed)
+	}
+	return c, nil
+}
+
+// parseWindow - private utility function, a window is either recurring (days) or one-off (from, until)
+func parseWindow(w config.Window, location *time.Location) (window, error) {
+	var err error
+	parsed := window{name: w.Name}
+	if len(w.Days) > 0 {
+		if w.From != "" || w.Until != "" {
+			return parsed, fmt.Errorf("has both days and from/until")
+		}
+		parsed.days = make(map[time.Weekday]bool)
+		for _, d := range w.Days {
+			key := strings.ToLower(d)
+			if len(key) > 3 {
+				key = key[:3]
+			}
+			day, ok := days[key]
+			if !ok {
+				return parsed, fmt.Errorf("unknown day %q", d)
+			}
+			parsed.days[day] = true
+		}
+		if parsed.start, err = clock(w.Start, 0); err != nil {
+			return parsed, err
+		}
+		if parsed.end, err = clock(w.End, 24*60); err != nil {
+			return parsed, err
+		}
+		return parsed, nil
+	}
+	if parsed.from, err = date(w.From, location, false); err != nil {
+		return parsed, err
+	}
+	if parsed.until, err = date(w.Until, location, true); err != nil {
+		return parsed, err
+	}
+	if !parsed.until.After(parsed.from) {
+		return parsed, fmt.Errorf("until is not after from")
+	}
+	return parsed, nil
+}
+
+// clock - private utility function, parses 15:04 into minutes from midnight
+func clock(value string, empty int) (int, error) {
+	if value == "" {
+		return empty, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("time %q should be of the form 15:04", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// date - private utility function, parses a date or date and time in the location
+// a date only until includes the whole day
+func date(value string, location *time.Location, until bool) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02T15:04", value, location); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, location)
+	if err != nil {
+		return t, fmt.Errorf("date %q should be of the form 2006-01-02 or 2006-01-02T15:04", value)
+	}
+	if until {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// Active - returns the name of the window now falls in and the time the freeze ends
+// adjoining windows are treated as one freeze, ok is false outside all windows
+func (c *Calendar) Active(now time.Time) (name string, end time.Time, ok bool) {
+	now = now.In(c.location)
+	name, end, ok = c.active(now)
+	if !ok {
+		return "", time.Time{}, false
+	}
+	for x := 0; x < MAXCHAIN; x++ {
+		_, next, more := c.active(end)
+		if !more || !next.After(end) {
+			break
+		}
+		end = next
+	}
+	return name, end, true
+}
+
+// active - private function, the first window containing t and its end (the latest end when several contain t)
+func (c *Calendar) active(t time.Time) (string, time.Time, bool) {
+	var name string
+	var end time.Time
+	for _, w := range c.windows {
+		if e, ok := w.contains(t, c.location); ok {
+			if name == "" {
+				name = w.name
+			}
+			if e.After(end) {
+				end = e
+			}
+		}
+	}
+	return name, end, name != "" || !end.IsZero()
+}
+
+// contains - private function, reports whether t is inside the window and when that occurrence ends
+// recurring windows are checked for the occurrence starting on the day of t and the day before
+// (windows that cross midnight)
+func (w window) contains(t time.Time, location *time.Location) (time.Time, bool) {
+	if w.days == nil {
+		return w.until, !t.Before(w.from) && t.Before(w.until)
+	}
+	for back := 0; back <= 1; back++ {
+		day := t.AddDate(0, 0, -back)
+		if !w.days[day.Weekday()] {
+			continue
+		}
+		// time.Date normalises the minutes, so wall clock times are kept across daylight saving changes
+		start := time.Date(day.Year(), day.Month(), day.Day(), 0, w.start, 0, 0, location)
+		end := time.Date(day.Year(), day.Month(), day.Day(), 0, w.end, 0, 0, location)
+		if w.end <= w.start {
+			end = time.Date(day.Year(), day.Month(), day.Day()+1, 0, w.end, 0, 0, location)
+		}
+		if !t.Before(start) && t.Before(end) {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,70 @@
+package freeze
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+)
+
+func TestCalendar(t *testing.T) {
+
+	rome, _ := time.LoadLocation("Europe/Rome")
+	at := func(value string) time.Time {
+		t, _ := time.ParseInLocation("2006-01-02T15:04", value, rome)
+		return t
+	}
+	c, err := Parse(&config.Freeze{
+		Timezone: "Europe/Rome",
+		Windows: []config.Window{
+			{Name: "friday evening", Days: []string{"fri"}, Start: "18:00"},
+			{Name: "weekend", Days: []string{"Saturday", "sun"}},
+			{Name: "nightly", Days: []string{"tue"}, Start: "22:00", End: "06:00"},
+			{Name: "christmas", From: "2021-12-24", Until: "2021-12-26"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Should not fail : found error %v", err)
+	}
+
+	t.Run("Active : should pass", func(t *testing.T) {
+		tests := []struct {
+			now, name, end string
+		}{
+			{"2021-02-06T10:00", "weekend", "2021-02-08T00:00"},
+			{"2021-02-05T20:00", "friday evening", "2021-02-08T00:00"},
+			{"2021-02-10T02:00", "nightly", "2021-02-10T06:00"},
+			{"2021-12-24T12:00", "christmas", "2021-12-27T00:00"},
+		}
+		for _, tt := range tests {
+			name, end, ok := c.Active(at(tt.now))
+			if !ok || name != tt.name || !end.Equal(at(tt.end)) {
+				t.Errorf(fmt.Sprintf("Handler %s returned incorrect window for %s - got (%s %v %t) wanted (%s %s)", "Active", tt.now, name, end, ok, tt.name, tt.end))
+			}
+		}
+	})
+
+	t.Run("Active : should pass (outside the windows)", func(t *testing.T) {
+		for _, now := range []string{"2021-02-10T12:00", "2021-02-05T17:59", "2021-02-10T06:00"} {
+			if name, _, ok := c.Active(at(now)); ok {
+				t.Errorf(fmt.Sprintf("Handler %s returned a window for %s - got (%s)", "Active", now, name))
+			}
+		}
+	})
+
+	t.Run("Parse : should fail", func(t *testing.T) {
+		tests := []*config.Freeze{
+			{Timezone: "Mars/Olympus"},
+			{Policy: "queue"},
+			{Windows: []config.Window{{Days: []string{"someday"}}}},
+			{Windows: []config.Window{{Days: []string{"mon"}, Start: "25:00"}}},
+			{Windows: []config.Window{{From: "2021-12-26", Until: "2021-12-24"}}},
+		}
+		for _, f := range tests {
+			if _, err := Parse(f); err == nil {
+				t.Errorf(fmt.Sprintf("Handler %s returned with no error - got (%v)", "Parse", f))
+			}
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package glob
+
+import (
+	"path"
+	"strings"
+)
+
+// Match - reports whether the slash separated file name matches the pattern
+// segments are matched with path.Match (*, ? and [...] do not cross a slash) and ** matches
+// any number of segments; a pattern that matches a parent directory matches every file below it
+// so "services/api" and "services/api/**" are the same filter
+func Match(pattern string, name string) bool {
+	p := split(pattern)
+	n := split(name)
+	for i := len(n); i > 0; i-- {
+		if matchSegments(p, n[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Any - reports whether the file name matches one of the patterns
+func Any(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if Match(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid - returns path.ErrBadPattern when a segment of the pattern is malformed
+func Valid(pattern string) error {
+	for _, s := range split(pattern) {
+		if _, err := path.Match(s, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// split - private utility function, the non empty segments of a path ("./" and leading slashes are ignored)
+func split(name string) []string {
+	var segments []string
+	for _, s := range strings.Split(name, "/") {
+		if s != "" && s != "." {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// matchSegments - private function, matches the pattern segments against all the name segments
+func matchSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
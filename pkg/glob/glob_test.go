@@ -0,0 +1,50 @@
+package glob
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+
+	t.Run("Match : should pass", func(t *testing.T) {
+		tests := []struct {
+			pattern string
+			name    string
+			want    bool
+		}{
+			{"services/api/**", "services/api/cmd/main.go", true},
+			{"services/api", "services/api/main.go", true},
+			{"services/api/", "services/api/main.go", true},
+			{"services/api", "services/api-gateway/main.go", false},
+			{"services/*/Dockerfile", "services/web/Dockerfile", true},
+			{"services/*/Dockerfile", "services/web/build/Dockerfile", false},
+			{"**/*.md", "README.md", true},
+			{"**/*.md", "docs/guide/setup.md", true},
+			{"*.md", "docs/setup.md", false},
+			{"docs/**/*.png", "docs/img/a/b.png", true},
+			{"./go.mod", "go.mod", true},
+			{"go.mod", "services/go.mod", false},
+		}
+		for _, tt := range tests {
+			if got := Match(tt.pattern, tt.name); got != tt.want {
+				t.Errorf(fmt.Sprintf("Handler %s %q %q - got (%v) wanted (%v)", "Match", tt.pattern, tt.name, got, tt.want))
+			}
+		}
+	})
+
+	t.Run("Any : should pass", func(t *testing.T) {
+		if !Any([]string{"docs/**", "**/*.md"}, "CHANGELOG.md") || Any(nil, "CHANGELOG.md") {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect result", "Any"))
+		}
+	})
+
+	t.Run("Valid : should fail (malformed pattern)", func(t *testing.T) {
+		if err := Valid("services/[api/**"); err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned no error - got (%v) wanted (%v)", "Valid", err, "error"))
+		}
+		if err := Valid("services/{api,web}/**"); err != nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned an error - got (%v) wanted (%v)", "Valid", err, nil))
+		}
+	})
+}
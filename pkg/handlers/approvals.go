@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
+)
+
+// approvals - events held back by a route approval policy
+var approvals = store.NewQueue(DELIVERYTTL)
+
+// checkApproval - private function, applies the route approval policy to the release
+// returns why the release is (or is not) approved
+func checkApproval(con connectors.Clients, tenant *config.Tenant, event *schema.Event, route *config.Route) (string, bool) {
+	policy := route.Approval
+	if policy == nil {
+		return "", true
+	}
+	git := event.Git
+	marker := policy.Marker
+	if marker == "" {
+		marker = config.APPROVALMARKER
+	}
+	re, err := regexp.Compile(marker)
+	if err != nil {
+		return fmt.Sprintf("invalid approval marker %v", err), false
+	}
+	for _, m := range re.FindAllStringSubmatch(git.Release.Body, -1) {
+		for _, approver := range policy.Approvers {
+			if len(m) > 1 && strings.EqualFold(m[1], approver) {
+				return "approved by " + approver + " in the release notes", true
+			}
+		}
+	}
+
+	author := git.Release.Author.Login
+	if author == "" {
+		author = git.Sender.Login
+	}
+	if len(policy.Teams) > 0 && author != "" {
+		if _, client := forgeFor(tenant, event.Provider, con); client != nil {
+			ctx, cancel := tenantContext(tenant)
+			defer cancel()
+			for _, team := range policy.Teams {
+				ok, err := client.IsTeamMember(ctx, team, author)
+				if err != nil {
+					con.Error("checkApproval could not check team %s membership for %s %v", team, author, err)
+					continue
+				}
+				if ok {
+					return "published by " + author + " of team " + team, true
+				}
+			}
+		}
+	}
+	return "no approval from an allowed approver or team for " + author, false
+}
+
+// holdForApproval - private function, queues the event for the route until it is approved,
+// undo puts back the release state when the event is rejected or its approval expires (nil when nothing to undo)
+func holdForApproval(con connectors.Clients, tenant *config.Tenant, event *schema.Event, route *config.Route, mapping *schema.MapBinding, reason string, undo func()) *store.Pending {
+	binding := *mapping
+	pending := &store.Pending{
+		ID:      event.DeliveryID + "-" + route.Name,
+		Tenant:  tenant.Name,
+		Route:   route.Name,
+		Repo:    event.Git.Repository.FullName,
+		Tag:     mapping.TagVersion,
+		Author:  mapping.ActorName,
+		Reason:  reason,
+		Event:   event,
+		Binding: &binding,
+		Undo:    undo,
+	}
+	approvals.Put(pending)
+	time.AfterFunc(DELIVERYTTL, func() {
+		expireApproval(con, tenant, pending.ID)
+	})
+	con.Info("WebhookHandler %s held for approval on route %s (%s)", pending.ID, route.Name, reason)
+	return pending
+}
+
+// expireApproval - private function, drops the event once it waited DELIVERYTTL for approval,
+// the expiry is audited and notified (approval_expired) and the release state is put back so that a redelivery is routed
+func expireApproval(con connectors.Clients, tenant *config.Tenant, id string) {
+	pending := approvals.Expire(id)
+	if pending == nil {
+		return
+	}
+	auditLog(con, store.AuditEntry{Tenant: pending.Tenant, Route: pending.Route, ID: id, Actor: pending.Author, Action: "expire",
+		Detail: "not approved within " + DELIVERYTTL.String() + " (" + pending.Reason + ")"})
+	undoPending(pending)
+	n := newNotification(tenant, config.APPROVALEXPIRED, pending.Event, pending.Binding)
+	n.Route, n.DeliveryID, n.Reason = pending.Route, id, "not approved within "+DELIVERYTTL.String()
+	sendNotification(con, tenant, n)
+}
+
+// undoPending - private utility function, puts back the release state of a rejected or expired event
+func undoPending(pending *store.Pending) {
+	if pending.Undo != nil {
+		pending.Undo()
+	}
+}
+
+// adminAuthorized - private utility function, the admin api is disabled unless ADMIN_TOKEN is set
+func adminAuthorized(w http.ResponseWriter, r *http.Request, con connectors.Clients) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		response(w, http.StatusForbidden, "Admin api is disabled (ADMIN_TOKEN is not set)")
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		con.Error("Admin api invalid token from %s", r.RemoteAddr)
+		response(w, http.StatusUnauthorized, "Invalid admin token")
+		return false
+	}
+	return true
+}
+
+// ApprovalsHandler - lists the events waiting for approval, optionally of one tenant (?tenant=)
+func ApprovalsHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	if !adminAuthorized(w, r, con) {
+		return
+	}
+	list := approvals.List(r.URL.Query().Get("tenant"))
+	if list == nil {
+		list = []*store.Pending{}
+	}
+	writeJSON(w, list)
+}
+
+// ApproveHandler - POST forwards the pending event to its route, DELETE rejects it
+// the body may name the approver ({"approver":"lmz"}) for the audit trail and carry
+// a freeze override token ({"override":"..."}) when the route is frozen, without it a frozen
+// route answers 423 and the event stays queued, the approval is audited once the event was sent
+func ApproveHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients, reg *Registry) {
+	var req struct {
+		Approver string `json:"approver"`
+		Override string `json:"override"`
+	}
+	if !adminAuthorized(w, r, con) {
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	json.Unmarshal(body, &req)
+
+	id := mux.Vars(r)["id"]
+	pending := approvals.Take(id)
+	if pending == nil {
+		response(w, http.StatusNotFound, "No pending approval "+id)
+		return
+	}
+	entry := store.AuditEntry{Tenant: pending.Tenant, Route: pending.Route, ID: id, Actor: req.Approver}
+	if r.Method == http.MethodDelete {
+		entry.Action, entry.Detail = "reject", "approval rejected"
+		auditLog(con, entry)
+		// a redelivery of the release is routed (and held for approval) again
+		undoPending(pending)
+		response(w, http.StatusOK, "Rejected "+id)
+		return
+	}
+
+	tenant := tenantFor(reg, pending.Tenant)
+	var route *config.Route
+	if tenant != nil {
+		route = tenant.Route(pending.Route)
+	}
+	if route == nil {
+		response(w, http.StatusNotFound, "Route "+pending.Route+" of tenant "+pending.Tenant+" no longer exists")
+		return
+	}
+	// a frozen route keeps the event queued for approval (the release is already marked as routed,
+	// a redelivery would not route it again) unless the freeze override token is given
+	window, end, ok := frozen(route)
+	if ok && !overrides(route, req.Override) {
+		approvals.Put(pending)
+		response(w, http.StatusLocked, fmt.Sprintf("Route %s is frozen (%s) until %s, %s is kept for approval", route.Name, window, end.Format(time.RFC3339), id))
+		return
+	}
+	if _, err := deliver(con, tenant, pending.Event, route, pending.Binding); err != nil {
+		// keep it queued so that the approval can be retried
+		approvals.Put(pending)
+		response(w, http.StatusBadGateway, fmt.Sprintf("Request failed %v", err))
+		return
+	}
+	if ok {
+		auditLog(con, store.AuditEntry{Tenant: pending.Tenant, Route: pending.Route, ID: id, Actor: req.Approver, Action: "override", Detail: "freeze " + window + " overridden"})
+	}
+	entry.Action, entry.Detail = "approve", "approved ("+pending.Reason+")"
+	auditLog(con, entry)
+	response(w, http.StatusOK, "Approved "+id+", request sent successfully")
+}
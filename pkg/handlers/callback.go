@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/forge"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
+)
+
+const (
+	DELIVERYTTL time.Duration = 72 * time.Hour
+	// MAXDELIVERIES - deliveries kept per tenant
+	MAXDELIVERIES  int = 10000
+	MAXDESCRIPTION int = 140
+)
+
+// deliveries - forwarded events waiting for pipeline callbacks, each tenant has its own MAXDELIVERIES
+// so that a flood from one tenant does not evict the deliveries of the others
+var deliveries = store.NewDeliveries(DELIVERYTTL, MAXDELIVERIES)
+
+// recordDelivery - private function, keeps the forwarded binding so that callbacks
+// and check run re-runs can find it
+func recordDelivery(tenant *config.Tenant, event *schema.Event, route *config.Route, binding *schema.MapBinding, body []byte, headers map[string]string) *store.Delivery {
+	number := event.Git.PullRequest.Number
+	if number == 0 {
+		number = event.Git.Number
+	}
+	delivery := &store.Delivery{
+		ID:        binding.DeliveryID,
+		WebhookID: event.DeliveryID,
+		Tenant:    tenant.Name,
+		Provider:  event.Provider,
+		Event:     event.Type,
+		Repo:      event.Git.Repository.FullName,
+		Sha:       binding.RepoHash,
+		PRNumber:  number,
+		Route:     route.Name,
+		URL:       route.URL,
+		Binding:   binding,
+		Body:      body,
+		Headers:   headers,
+	}
+	deliveries.Put(delivery)
+	return delivery
+}
+
+// tenantFor - private utility function, resolves the tenant a delivery was made for
+func tenantFor(reg *Registry, name string) *config.Tenant {
+	if name == config.DEFAULTTENANT {
+		return config.FromEnv()
+	}
+	if ts := reg.lookup(name); ts != nil {
+		return ts.tenant
+	}
+	return nil
+}
+
+// CallbackHandler - pipelines report progress (running) or their result for a delivery
+// the commit status or check run is updated and, when asked for, a comment is posted on the pull request
+func CallbackHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients, reg *Registry) {
+	var cb *schema.Callback
+
+	id := mux.Vars(r)["deliveryID"]
+	delivery := deliveries.Get(id)
+	if delivery == nil {
+		con.Info("CallbackHandler unknown delivery %s", id)
+		response(w, http.StatusNotFound, "Unknown delivery "+id)
+		return
+	}
+	tenant := tenantFor(reg, delivery.Tenant)
+	if tenant == nil {
+		response(w, http.StatusNotFound, "Unknown tenant "+delivery.Tenant)
+		return
+	}
+	// delivery ids are not secret (pipelines and forge statuses show them), callbacks need the tenant token
+	if tenant.CallbackToken == "" {
+		con.Error("CallbackHandler callbacks are disabled for tenant %s (no callback token)", tenant.Name)
+		response(w, http.StatusForbidden, "Callbacks are disabled (no callback token is set)")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+tenant.CallbackToken)) != 1 {
+		con.Error("CallbackHandler invalid token for delivery %s", id)
+		response(w, http.StatusUnauthorized, "Invalid callback token")
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &cb)
+	}
+	if err != nil || cb == nil {
+		con.Error("CallbackHandler could not read callback %v", err)
+		response(w, http.StatusBadRequest, fmt.Sprintf("CallbackHandler could not read callback %v", err))
+		return
+	}
+
+	switch cb.Status {
+	case forge.RUNNING, forge.SUCCESS, forge.FAILURE, forge.ERROR:
+	default:
+		response(w, http.StatusBadRequest, "Status must be one of running, success, failure or error")
+		return
+	}
+
+	con.Info("CallbackHandler delivery %s (webhook delivery %s) reported %s", id, delivery.WebhookID, cb.Status)
+	f, client := forgeFor(tenant, delivery.Provider, con)
+	if client == nil {
+		response(w, http.StatusOK, "Callback received, no forge configured for "+delivery.Provider)
+		return
+	}
+
+	ctx, cancel := tenantContext(tenant)
+	defer cancel()
+	description := cb.Title
+	if description == "" {
+		description = cb.Summary
+	}
+	if description == "" {
+		description = "Pipeline " + cb.Status
+	}
+	if len(description) > MAXDESCRIPTION {
+		description = description[:MAXDESCRIPTION-3] + "..."
+	}
+	summary := cb.Summary
+	if summary == "" {
+		summary = description
+	}
+	if err = reportStatus(ctx, client, f.Checks, delivery, cb.Status, description, summary, cb.LogURL); err != nil {
+		response(w, http.StatusBadGateway, fmt.Sprintf("Could not report status %v", err))
+		return
+	}
+	if cb.Comment && cb.Status != forge.RUNNING && delivery.PRNumber > 0 {
+		if err = client.CreateComment(ctx, delivery.Repo, delivery.PRNumber, callbackComment(delivery, cb)); err != nil {
+			response(w, http.StatusBadGateway, fmt.Sprintf("Could not create comment %v", err))
+			return
+		}
+	}
+	response(w, http.StatusOK, fmt.Sprintf("Callback for delivery %s (webhook delivery %s) processed", id, delivery.WebhookID))
+}
+
+// callbackComment - private utility function, the markdown posted on the pull request
+func callbackComment(delivery *store.Delivery, cb *schema.Callback) string {
+	comment := fmt.Sprintf("**%s%s** finished with **%s** for %s", STATUSCONTEXT, delivery.Route, cb.Status, delivery.Sha)
+	if cb.Summary != "" {
+		comment += "\n\n" + cb.Summary
+	}
+	if cb.LogURL != "" {
+		comment += "\n\n[Pipeline logs](" + cb.LogURL + ")"
+	}
+	return comment + "\n\nWebhook delivery: " + delivery.WebhookID
+}
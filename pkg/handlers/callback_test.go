@@ -0,0 +1,111 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/forge"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/microlib/simple"
+)
+
+func TestCallbackHandler(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var statuses []forge.Status
+	var comments []string
+
+	os.Setenv("PR_OPENED_URL", "http://el-pr-opened:8080")
+	os.Setenv("FORGE_PROVIDER", "github")
+	os.Setenv("FORGE_TOKEN", "abc")
+	os.Setenv("CALLBACK_TOKEN", "pipeline-callback-token")
+	defer os.Setenv("FORGE_PROVIDER", "")
+	defer os.Setenv("CALLBACK_TOKEN", "")
+
+	var binding schema.MapBinding
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/comments"):
+			comments = append(comments, string(body))
+		case strings.Contains(r.URL.Path, "/statuses/"):
+			var st forge.Status
+			json.Unmarshal(body, &st)
+			statuses = append(statuses, st)
+		default:
+			json.Unmarshal(body, &binding)
+		}
+		return NewTestResponse(201, "{}")
+	})
+
+	// forward a pull request first so that there is a delivery to call back on
+	requestPayload, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+	req, _ := http.NewRequest("POST", "/api/v1/service", bytes.NewBuffer(requestPayload))
+	req.Header.Set("X-GitHub-Event", "pull_request")
+	req.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	WebhookHandler(httptest.NewRecorder(), req, conn)
+	if binding.DeliveryID != "72d3162e-cc78-11e3-81ab-4c9367dc0958-pr-opened" {
+		t.Fatalf(fmt.Sprintf("Handler %s sent incorrect delivery id - got (%s)", "WebhookHandler", binding.DeliveryID))
+	}
+
+	tests := []struct {
+		name     string
+		delivery string
+		token    string
+		payload  string
+		status   int
+	}{
+		{"should fail (unknown delivery)", "nothere", "pipeline-callback-token", `{"status":"success"}`, 404},
+		{"should fail (bad token)", binding.DeliveryID, "wrong", `{"status":"success"}`, 401},
+		{"should fail (bad status)", binding.DeliveryID, "pipeline-callback-token", `{"status":"done"}`, 400},
+		{"should fail (bad json)", binding.DeliveryID, "pipeline-callback-token", `{ bad json`, 400},
+		{"should pass", binding.DeliveryID, "pipeline-callback-token", `{"status":"failure","logurl":"https://tekton/logs/1","summary":"unit tests failed","comment":true}`, 200},
+	}
+
+	for _, tc := range tests {
+		t.Run("CallbackHandler : "+tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/callback/"+tc.delivery, bytes.NewBufferString(tc.payload))
+			req = mux.SetURLVars(req, map[string]string{"deliveryID": tc.delivery})
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				CallbackHandler(w, r, conn, nil)
+			})
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.status {
+				t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "CallbackHandler", rr.Code, tc.status))
+			}
+		})
+	}
+
+	t.Run("CallbackHandler : should fail (no callback token set)", func(t *testing.T) {
+		os.Setenv("CALLBACK_TOKEN", "")
+		defer os.Setenv("CALLBACK_TOKEN", "pipeline-callback-token")
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/callback/"+binding.DeliveryID, bytes.NewBufferString(`{"status":"success"}`))
+		req = mux.SetURLVars(req, map[string]string{"deliveryID": binding.DeliveryID})
+		req.Header.Set("Authorization", "Bearer ")
+		CallbackHandler(rr, req, conn, nil)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "CallbackHandler", rr.Code, http.StatusForbidden))
+		}
+	})
+
+	last := statuses[len(statuses)-1]
+	if last.State != forge.FAILURE || last.TargetURL != "https://tekton/logs/1" || last.Context != "tekton/pr-opened" {
+		t.Errorf(fmt.Sprintf("Handler %s set incorrect final status - got (%v)", "CallbackHandler", last))
+	}
+	if len(comments) != 1 || !strings.Contains(comments[0], "72d3162e-cc78-11e3-81ab-4c9367dc0958") {
+		t.Errorf(fmt.Sprintf("Handler %s posted incorrect comments - got (%v)", "CallbackHandler", comments))
+	}
+}
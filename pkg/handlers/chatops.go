@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/chatops"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/forge"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/policy"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
+)
+
+// HOLDTTL - /hold and /ok-to-test are forgotten this long after they were given, closing the pull request forgets them at once
+const HOLDTTL time.Duration = 30 * 24 * time.Hour
+
+// holds - pull requests paused with /hold, shared by all tenants (keys include the tenant)
+var holds = store.NewHolds(HOLDTTL)
+
+// heldBy - private utility function, returns the user holding a pull request event
+func heldBy(tenant *config.Tenant, event *schema.Event) (string, bool) {
+	if !isPullRequest(event.Type) {
+		return "", false
+	}
+	return holds.Held(store.HoldKey(tenant.Name, event.Git.Repository.FullName, event.Git.PullRequest.Number))
+}
+
+// forgetPullRequest - private function, drops the hold and the ok-to-test of a closed (or merged) pull request
+// so that neither outlives it, a reopened pull request starts without them
+func forgetPullRequest(tenant *config.Tenant, event *schema.Event) {
+	holds.Release(store.HoldKey(tenant.Name, event.Git.Repository.FullName, event.Git.PullRequest.Number))
+	trusted.Release(trustKey(tenant, event.Git))
+}
+
+// handleComment - private function, runs the chatops commands of a new pull request comment
+// the result is acknowledged with a reaction on success and a reply comment otherwise
+func handleComment(w http.ResponseWriter, con connectors.Clients, tenant *config.Tenant, event *schema.Event) {
+	git := event.Git
+	if event.Action != "created" || (git.Issue.PullRequest == nil && !git.IsPull) {
+		con.Info("NOP (not a new pull request comment)")
+		response(w, http.StatusOK, "Ignored, not a new pull request comment")
+		return
+	}
+	commands := chatops.Parse(git.Comment.Body)
+	if len(commands) == 0 {
+		response(w, http.StatusOK, "Ignored, no commands found")
+		return
+	}
+	if tenant.ChatOps == nil {
+		response(w, http.StatusOK, "Ignored, chatops is not enabled")
+		return
+	}
+	_, client := forgeFor(tenant, event.Provider, con)
+	if client == nil {
+		con.Error("handleComment chatops needs a forge for provider %s", event.Provider)
+		response(w, http.StatusOK, "Ignored, no forge configured for "+event.Provider)
+		return
+	}
+
+	ctx, cancel := tenantContext(tenant)
+	defer cancel()
+	repo := git.Repository.FullName
+	user := git.Comment.User.Login
+	cfg := tenant.ChatOps
+	allowed := chatops.Allowed(cfg.Users, cfg.Associations, cfg.Teams, user, git.Comment.AuthorAssociation, func(team string) bool {
+		ok, err := client.IsTeamMember(ctx, team, user)
+		if err != nil {
+			con.Error("handleComment could not check team %s membership for %s %v", team, user, err)
+		}
+		return ok
+	})
+	if !allowed {
+		con.Info("handleComment %s is not allowed to run commands on %s#%d", user, repo, git.Issue.Number)
+		acknowledge(ctx, con, client, repo, git.Issue.Number, git.Comment.ID, false, []string{"@" + user + " is not allowed to run commands"})
+		response(w, http.StatusOK, user+" is not allowed to run commands")
+		return
+	}
+
+	ok := true
+	var results []string
+	for _, c := range commands {
+		result, err := runCommand(ctx, con, tenant, event, client, c)
+		if err != nil {
+			ok = false
+			result = fmt.Sprintf("/%s failed: %v", c.Name, err)
+		}
+		con.Info("handleComment %s#%d %s", repo, git.Issue.Number, result)
+		results = append(results, result)
+	}
+	acknowledge(ctx, con, client, repo, git.Issue.Number, git.Comment.ID, ok, results)
+	response(w, http.StatusOK, strings.Join(results, "; "))
+}
+
+// runCommand - private function, executes a single command for the pull request
+func runCommand(ctx context.Context, con connectors.Clients, tenant *config.Tenant, event *schema.Event, client forge.Client, c chatops.Command) (string, error) {
+	repo := event.Git.Repository.FullName
+	number := event.Git.Issue.Number
+	key := store.HoldKey(tenant.Name, repo, number)
+
+	switch c.Name {
+	case chatops.HOLD:
+		holds.Hold(key, event.Git.Comment.User.Login)
+		return "/hold deliveries paused", nil
+	case chatops.UNHOLD:
+		if !holds.Release(key) {
+			return "/unhold nothing was held", nil
+		}
+		return "/unhold deliveries resumed", nil
+	}
+
+	if user, held := holds.Held(key); held {
+		return "", fmt.Errorf("pull request is held by %s", user)
+	}
+	pr, err := client.GetPullRequest(ctx, repo, number)
+	if err != nil {
+		return "", err
+	}
+	prEvent := pullRequestEvent(event, pr)
+	if c.Name == chatops.OKTOTEST {
+		trusted.Hold(trustKey(tenant, prEvent.Git), event.Git.Comment.User.Login)
+	}
+	if err = checkPolicy(tenant, prEvent); err == policy.ErrNotTrusted {
+		return "", errors.New("pull request is from a fork, use /ok-to-test")
+	} else if err != nil {
+		return "", err
+	}
+	mapping := newMapBinding(prEvent)
+
+	var routes []*config.Route
+	if c.Name == chatops.RETEST || c.Name == chatops.OKTOTEST {
+		for x := range tenant.Routes {
+			if tenant.Routes[x].Matches("pull_request", "opened") {
+				routes = append(routes, &tenant.Routes[x])
+			}
+		}
+	} else {
+		if len(c.Args) == 0 {
+			return "", errors.New("usage /deploy <environment>")
+		}
+		if route := tenant.Route(tenant.ChatOps.Deploy[c.Args[0]]); route != nil {
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) == 0 {
+		return "", errors.New("no route configured")
+	}
+	// commands go through the approval and freeze gates of the routes like webhooks do
+	var triggered, queued, rejected []string
+	for _, route := range routes {
+		if reason, ok := checkApproval(con, tenant, prEvent, route); !ok {
+			queued = append(queued, route.Name+" held for approval as "+holdForApproval(con, tenant, prEvent, route, mapping, reason, nil).ID)
+			continue
+		}
+		if msg, code := freezeGate(con, tenant, prEvent, route, mapping); code == http.StatusLocked {
+			rejected = append(rejected, msg)
+			continue
+		} else if code != 0 {
+			queued = append(queued, msg)
+			continue
+		}
+		if _, err = deliver(con, tenant, prEvent, route, mapping); err != nil {
+			return "", err
+		}
+		triggered = append(triggered, route.Name)
+	}
+	var results []string
+	if len(triggered) > 0 {
+		results = append(results, fmt.Sprintf("/%s triggered %s for %s", c.Name, strings.Join(triggered, ","), pr.HeadSha))
+	}
+	results = append(results, queued...)
+	if len(rejected) > 0 {
+		return "", errors.New(strings.Join(append(rejected, results...), "; "))
+	}
+	return strings.Join(results, "; "), nil
+}
+
+// pullRequestEvent - private utility function, the pull request opened event a command re-fires
+func pullRequestEvent(event *schema.Event, pr *forge.PullRequest) *schema.Event {
+	git := *event.Git
+	git.PullRequest.Number = pr.Number
+	git.PullRequest.Title = pr.Title
+	git.PullRequest.Body = pr.Body
+	git.PullRequest.Draft = pr.Draft
+	git.PullRequest.User.Login = pr.Author
+	git.PullRequest.Head.Ref = pr.HeadRef
+	git.PullRequest.Head.Sha = pr.HeadSha
+	git.PullRequest.Head.Repo.FullName = ""
+	git.PullRequest.Head.Repo.Fork = pr.Fork
+	git.PullRequest.AuthorAssociation = pr.Association
+	return &schema.Event{Provider: event.Provider, Type: "pull_request", Action: "opened", DeliveryID: event.DeliveryID, Git: &git}
+}
+
+// acknowledge - private function, reacts to the comment on success and replies otherwise
+// (or when the provider has no reactions)
+func acknowledge(ctx context.Context, con connectors.Clients, client forge.Client, repo string, number int, commentID int64, ok bool, results []string) {
+	if ok && client.AddReaction(ctx, repo, commentID, "+1") == nil {
+		return
+	}
+	if err := client.CreateComment(ctx, repo, number, strings.Join(results, "\n")); err != nil {
+		con.Error("acknowledge could not reply on %s#%d %v", repo, number, err)
+	}
+}
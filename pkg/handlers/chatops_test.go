@@ -0,0 +1,195 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
+	"github.com/microlib/simple"
+)
+
+func TestChatOps(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var bindings []string
+	var reactions, replies int
+	var head = "luigizuccarelli/golang-simple-echoservice"
+
+	os.Setenv("PR_OPENED_URL", "http://el-pr-opened:8080")
+	os.Setenv("PRERELEASED_URL", "http://el-uat:8080")
+	os.Setenv("FORGE_PROVIDER", "github")
+	os.Setenv("FORGE_TOKEN", "abc")
+	os.Setenv("CHATOPS_ASSOCIATIONS", "OWNER,MEMBER")
+	os.Setenv("CHATOPS_DEPLOY", "uat=prereleased")
+	defer os.Setenv("FORGE_PROVIDER", "")
+	defer os.Setenv("CHATOPS_ASSOCIATIONS", "")
+	defer os.Setenv("CHATOPS_DEPLOY", "")
+
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		code, resp := 201, "{}"
+		switch {
+		case r.URL.Path == "/repos/luigizuccarelli/golang-simple-echoservice/pulls/3":
+			code, resp = 200, `{"number":3,"title":"Update README.md","user":{"login":"dev"},"head":{"ref":"test-trigger","sha":"0a1b2c3d","repo":{"full_name":"`+head+`"}},"base":{"repo":{"full_name":"luigizuccarelli/golang-simple-echoservice"}}}`
+		case strings.HasSuffix(r.URL.Path, "/reactions"):
+			reactions++
+		case strings.HasSuffix(r.URL.Path, "/comments"):
+			replies++
+		case strings.Contains(r.URL.Path, "/statuses/"):
+		default:
+			var mb schema.MapBinding
+			json.Unmarshal(body, &mb)
+			bindings = append(bindings, r.URL.Host+" "+mb.RepoHash)
+		}
+		return NewTestResponse(code, resp)
+	})
+
+	comment := func(body string, association string) string {
+		var payload map[string]interface{}
+		data, _ := ioutil.ReadFile("../../tests/git-payload-issue-comment.json")
+		json.Unmarshal(data, &payload)
+		payload["comment"].(map[string]interface{})["body"] = body
+		payload["comment"].(map[string]interface{})["author_association"] = association
+		data, _ = json.Marshal(payload)
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/service", bytes.NewBuffer(data))
+		req.Header.Set("X-GitHub-Event", "issue_comment")
+		WebhookHandler(rr, req, conn)
+		resp, _ := ioutil.ReadAll(rr.Body)
+		return string(resp)
+	}
+
+	t.Run("WebhookHandler : should pass (/retest and /deploy uat)", func(t *testing.T) {
+		bindings, reactions, replies = nil, 0, 0
+		resp := comment("Looks good\n/retest\n/deploy uat", "OWNER")
+		if len(bindings) != 2 || bindings[0] != "el-pr-opened:8080 0a1b2c3d" || bindings[1] != "el-uat:8080 0a1b2c3d" || reactions != 1 || replies != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s ran commands incorrectly - got (%v %d %d %s)", "WebhookHandler", bindings, reactions, replies, resp))
+		}
+	})
+
+	t.Run("WebhookHandler : should fail (user not allowed)", func(t *testing.T) {
+		bindings, reactions, replies = nil, 0, 0
+		comment("/retest", "CONTRIBUTOR")
+		if len(bindings) != 0 || replies != 1 {
+			t.Errorf(fmt.Sprintf("Handler %s did not deny the command - got (%v %d)", "WebhookHandler", bindings, replies))
+		}
+	})
+
+	t.Run("WebhookHandler : should fail (unknown deploy target)", func(t *testing.T) {
+		bindings, reactions, replies = nil, 0, 0
+		comment("/deploy prod", "MEMBER")
+		if len(bindings) != 0 || reactions != 0 || replies != 1 {
+			t.Errorf(fmt.Sprintf("Handler %s did not reply with the failure - got (%v %d %d)", "WebhookHandler", bindings, reactions, replies))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (/deploy prod goes through approval and freeze)", func(t *testing.T) {
+		os.Setenv("RELEASED_URL", "http://el-prod:8080")
+		os.Setenv("CHATOPS_DEPLOY", "uat=prereleased,prod=released")
+		os.Setenv("RELEASE_APPROVERS", "lmz")
+		defer os.Setenv("RELEASED_URL", "")
+		defer os.Setenv("RELEASE_APPROVERS", "")
+		bindings, reactions, replies = nil, 0, 0
+		resp := comment("/deploy prod", "OWNER")
+		held := approvals.List("default")
+		if len(bindings) != 0 || len(held) != 1 || held[0].Route != "released" || !strings.Contains(resp, "held for approval") {
+			t.Errorf(fmt.Sprintf("Handler %s deployed without approval - got (%v %v %s)", "WebhookHandler", bindings, held, resp))
+		}
+		approvals.Take(held[0].ID)
+
+		os.Setenv("RELEASE_APPROVERS", "")
+		os.Setenv("FREEZE_CONFIG", "../../tests/freeze.json")
+		now = func() time.Time { return time.Date(2021, 2, 6, 10, 0, 0, 0, time.UTC) }
+		defer os.Setenv("FREEZE_CONFIG", "")
+		defer func() { now = time.Now }()
+		resp = comment("/deploy prod", "OWNER")
+		deferred := deferrals.List("default")
+		if len(bindings) != 0 || len(deferred) != 1 || deferred[0].Route != "released" || !strings.Contains(resp, "is frozen") {
+			t.Errorf(fmt.Sprintf("Handler %s deployed during the freeze - got (%v %v %s)", "WebhookHandler", bindings, deferred, resp))
+		}
+		deferrals.Take(deferred[0].ID)
+	})
+
+	t.Run("WebhookHandler : should pass (/hold skips pull request deliveries)", func(t *testing.T) {
+		bindings = nil
+		comment("/hold", "OWNER")
+		payload, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+		var pr map[string]interface{}
+		json.Unmarshal(payload, &pr)
+		pr["pull_request"].(map[string]interface{})["number"] = 3
+		payload, _ = json.Marshal(pr)
+		send := func() {
+			req, _ := http.NewRequest("POST", "/api/v1/service", bytes.NewBuffer(payload))
+			req.Header.Set("X-GitHub-Event", "pull_request")
+			WebhookHandler(httptest.NewRecorder(), req, conn)
+		}
+		send()
+		if len(bindings) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s delivered a held pull request - got (%v)", "WebhookHandler", bindings))
+		}
+		comment("/unhold", "OWNER")
+		send()
+		if len(bindings) != 1 {
+			t.Errorf(fmt.Sprintf("Handler %s did not deliver after /unhold - got (%v)", "WebhookHandler", bindings))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (fork pull requests need /ok-to-test)", func(t *testing.T) {
+		head = "someone/golang-simple-echoservice"
+		defer func() { head = "luigizuccarelli/golang-simple-echoservice" }()
+		bindings, reactions, replies = nil, 0, 0
+		resp := comment("/retest", "OWNER")
+		if len(bindings) != 0 || replies != 1 || !strings.Contains(resp, "ok-to-test") {
+			t.Errorf(fmt.Sprintf("Handler %s re-ran an untrusted fork - got (%v %d %s)", "WebhookHandler", bindings, replies, resp))
+		}
+		comment("/ok-to-test", "MEMBER")
+		comment("/retest", "OWNER")
+		if len(bindings) != 2 || bindings[0] != "el-pr-opened:8080 0a1b2c3d" {
+			t.Errorf(fmt.Sprintf("Handler %s did not run a trusted fork - got (%v)", "WebhookHandler", bindings))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (closing the pull request forgets /hold and /ok-to-test)", func(t *testing.T) {
+		key := store.HoldKey("default", "luigizuccarelli/golang-simple-echoservice", 3)
+		comment("/ok-to-test", "OWNER")
+		comment("/hold", "OWNER")
+		payload, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+		var pr map[string]interface{}
+		json.Unmarshal(payload, &pr)
+		pr["action"] = "closed"
+		pr["pull_request"].(map[string]interface{})["number"] = 3
+		pr["pull_request"].(map[string]interface{})["head"].(map[string]interface{})["sha"] = "0a1b2c3d"
+		payload, _ = json.Marshal(pr)
+		bindings = nil
+		req, _ := http.NewRequest("POST", "/api/v1/service", bytes.NewBuffer(payload))
+		req.Header.Set("X-GitHub-Event", "pull_request")
+		rr := httptest.NewRecorder()
+		WebhookHandler(rr, req, conn)
+		_, held := holds.Held(key)
+		_, ok := trusted.Held(store.TrustKey("default", "luigizuccarelli/golang-simple-echoservice", 3, "0a1b2c3d"))
+		if len(bindings) != 0 || !strings.Contains(rr.Body.String(), "held by") || held || ok {
+			t.Errorf(fmt.Sprintf("Handler %s did not forget the closed pull request - got (%v %t %t)", "WebhookHandler", bindings, held, ok))
+		}
+	})
+
+	t.Run("WebhookHandler : should fail (denied sender runs no commands)", func(t *testing.T) {
+		os.Setenv("DENY_SENDERS", "luigizuccarelli")
+		defer os.Setenv("DENY_SENDERS", "")
+		bindings, reactions, replies = nil, 0, 0
+		resp := comment("/retest", "OWNER")
+		if len(bindings) != 0 || reactions != 0 || replies != 0 || !strings.Contains(resp, "Denied by policy") {
+			t.Errorf(fmt.Sprintf("Handler %s ran the commands of a denied sender - got (%v %d %d %s)", "WebhookHandler", bindings, reactions, replies, resp))
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/forge"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/policy"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
+)
+
+// rerunDeliveries - private function, handles check_run and check_suite rerequested events
+// the original bindings are re-sent to the eventlisteners they were first delivered to,
+// check runs are found through their external id (the delivery id), check suites by head sha,
+// only pull request deliveries are re-run (releases on the same commit are not) and they go
+// through the hold, policy, approval and freeze gates of a new pull request event
+func rerunDeliveries(w http.ResponseWriter, con connectors.Clients, tenant *config.Tenant, event *schema.Event) {
+	var list []*store.Delivery
+	if event.Type == "check_run" {
+		if d := deliveries.Get(event.Git.CheckRun.ExternalID); d != nil && d.Tenant == tenant.Name {
+			list = append(list, d)
+		}
+	} else {
+		list = latestPerRoute(deliveries.FindBySha(tenant.Name, event.Git.Repository.FullName, event.Git.CheckSuite.HeadSha))
+	}
+	var reruns []*store.Delivery
+	for _, d := range list {
+		if d.Event == "pull_request" && d.PRNumber > 0 {
+			reruns = append(reruns, d)
+		}
+	}
+	if len(reruns) == 0 {
+		con.Info("rerunDeliveries no pull request delivery found for %s rerequest", event.Type)
+		response(w, http.StatusNotFound, "No delivery found to re-run (unknown or expired)")
+		return
+	}
+	_, client := forgeFor(tenant, event.Provider, con)
+	if client == nil {
+		con.Error("rerunDeliveries re-runs need a forge for provider %s", event.Provider)
+		response(w, http.StatusOK, "Ignored, no forge configured for "+event.Provider)
+		return
+	}
+
+	ctx, cancel := tenantContext(tenant)
+	defer cancel()
+	var sent, skipped []string
+	code := http.StatusOK
+	events := make(map[int]*schema.Event)
+	for _, delivery := range reruns {
+		prEvent := events[delivery.PRNumber]
+		if prEvent == nil {
+			pr, err := client.GetPullRequest(ctx, delivery.Repo, delivery.PRNumber)
+			if err != nil {
+				con.Error("rerunDeliveries could not read pull request %s#%d %v", delivery.Repo, delivery.PRNumber, err)
+				response(w, http.StatusBadGateway, err.Error())
+				return
+			}
+			prEvent = pullRequestEvent(event, pr)
+			events[delivery.PRNumber] = prEvent
+		}
+		msg, status, err := rerun(con, tenant, prEvent, delivery)
+		if err != nil {
+			response(w, http.StatusInternalServerError, fmt.Sprintf("Request failed %v", err))
+			return
+		}
+		if msg != "" {
+			skipped = append(skipped, msg)
+			if status > code {
+				code = status
+			}
+			continue
+		}
+		sent = append(sent, delivery.ID)
+	}
+	if len(sent) > 0 {
+		response(w, http.StatusOK, fmt.Sprintf("Re-run requested for %d delivery(s)", len(sent)))
+		return
+	}
+	response(w, code, strings.Join(skipped, "; "))
+}
+
+// rerun - private function, re-sends the delivery unless a gate stops it, the reason it was not sent is
+// returned with the status it is answered with (held or waiting for /ok-to-test 200, queued 202,
+// denied by policy 403 and rejected during a freeze 423)
+func rerun(con connectors.Clients, tenant *config.Tenant, event *schema.Event, delivery *store.Delivery) (string, int, error) {
+	if user, held := heldBy(tenant, event); held {
+		con.Info("rerunDeliveries pull request held by %s, %s not re-run", user, delivery.ID)
+		return "Pull request is held by " + user + ", use /unhold to resume", http.StatusOK, nil
+	}
+	if err := checkPolicy(tenant, event); err == policy.ErrNotTrusted {
+		return "Fork pull request is waiting for /ok-to-test", http.StatusOK, nil
+	} else if err != nil {
+		con.Info("rerunDeliveries %v, %s not re-run", err, delivery.ID)
+		return "Denied by policy, " + err.Error(), http.StatusForbidden, nil
+	}
+	route := tenant.Route(delivery.Route)
+	if route == nil {
+		return "Route " + delivery.Route + " no longer exists", http.StatusNotFound, nil
+	}
+	if reason, ok := checkApproval(con, tenant, event, route); !ok {
+		return "Held for approval " + holdForApproval(con, tenant, event, route, delivery.Binding, reason, nil).ID, http.StatusAccepted, nil
+	}
+	if msg, code := freezeGate(con, tenant, event, route, delivery.Binding); code != 0 {
+		return msg, code, nil
+	}
+
+	con.Info("rerunDeliveries re-sending delivery %s (webhook delivery %s) to %s", delivery.ID, delivery.WebhookID, delivery.URL)
+	// a re-run gets a fresh check run
+	delivery.CheckRun = 0
+	ctx, cancel := tenantContext(tenant)
+	err := send(ctx, con, delivery)
+	cancel()
+	if err != nil {
+		notifyForge(con, tenant, delivery, forge.ERROR, "Delivery to the eventlistener failed")
+		n := newNotification(tenant, config.DELIVERYFAILED, event, delivery.Binding)
+		n.Event, n.Route, n.DeliveryID, n.Sha, n.Reason = delivery.Event, delivery.Route, delivery.ID, delivery.Sha, err.Error()
+		sendNotification(con, tenant, n)
+		return "", 0, err
+	}
+	notifyForge(con, tenant, delivery, forge.PENDING, "Pipeline re-run triggered")
+	return "", 0, nil
+}
+
+// latestPerRoute - private utility function, keeps the newest delivery of each route (input is oldest first)
+func latestPerRoute(list []*store.Delivery) []*store.Delivery {
+	var latest []*store.Delivery
+	index := make(map[string]int)
+	for _, d := range list {
+		if x, ok := index[d.Route]; ok {
+			latest[x] = d
+			continue
+		}
+		index[d.Route] = len(latest)
+		latest = append(latest, d)
+	}
+	return latest
+}
@@ -0,0 +1,53 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/microlib/simple"
+)
+
+func TestCloudEvents(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var bodies []string
+	var headers []http.Header
+
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		bodies = append(bodies, string(body))
+		headers = append(headers, r.Header)
+		return nil
+	})
+	reg := NewRegistry(&config.Config{Tenants: []config.Tenant{{Name: "team-i", Routes: []config.Route{
+		{Name: "broker", Event: "pull_request", Actions: []string{"opened"}, URL: "http://broker-ingress/team-i/default", CloudEvents: "binary"},
+		{Name: "argo", Event: "pull_request", Actions: []string{"opened"}, URL: "http://webhook-eventsource:12000/pr", CloudEvents: "structured"},
+	}}}})
+
+	t.Run("TenantWebhookHandler : should pass (binary and structured modes)", func(t *testing.T) {
+		data, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+		PostTenant(conn, reg, "team-i", data, map[string]string{"X-GitHub-Event": "pull_request", "X-GitHub-Delivery": "ce-4501"})
+		if len(bodies) != 2 {
+			t.Fatalf(fmt.Sprintf("Handler %s posted incorrect events - got (%v)", "TenantWebhookHandler", bodies))
+		}
+		var binding map[string]interface{}
+		json.Unmarshal([]byte(bodies[0]), &binding)
+		h := headers[0]
+		if h.Get("ce-specversion") != "1.0" || h.Get("ce-type") != "dev.gitwebhook.pr.opened" || h.Get("ce-id") != "ce-4501-broker" ||
+			h.Get("ce-source") != binding["url"] || binding["deliveryid"] != "ce-4501-broker" || h.Get("Content-Type") != "application/json" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect binary event - got (%v %s)", "TenantWebhookHandler", h, bodies[0]))
+		}
+		var event map[string]interface{}
+		json.Unmarshal([]byte(bodies[1]), &event)
+		if headers[1].Get("Content-Type") != "application/cloudevents+json" || event["type"] != "dev.gitwebhook.pr.opened" || event["id"] != "ce-4501-argo" ||
+			event["data"].(map[string]interface{})["hash"] != binding["hash"] {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect structured event - got (%s)", "TenantWebhookHandler", bodies[1]))
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
+)
+
+// debouncer - the deferral id of the queued event of each tenant, route, repository and ref
+type debouncer struct {
+	mutex  sync.Mutex
+	latest map[string]string
+}
+
+// debounced - events waiting for the end of their route debounce window, they are kept
+// with the deferred events so that they can be listed and cancelled on the admin api
+var debounced = &debouncer{latest: make(map[string]string)}
+
+// swap - private function, records id as the queued event of the key and returns the one it replaces
+func (d *debouncer) swap(key string, id string) string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	previous := d.latest[key]
+	d.latest[key] = id
+	return previous
+}
+
+// done - private function, forgets the key unless a newer event was queued since
+func (d *debouncer) done(key string, id string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.latest[key] == id {
+		delete(d.latest, key)
+	}
+}
+
+// eventRef - private utility function, the branch, tag or pull request branch of the event
+func eventRef(event *schema.Event, binding *schema.MapBinding) string {
+	for _, ref := range []string{binding.Branch, binding.TagVersion, event.Git.PullRequest.Head.Ref} {
+		if ref != "" {
+			return ref
+		}
+	}
+	return ""
+}
+
+// debounceKey - private utility function, the events superseding each other on the route
+// pull requests are keyed by their number, forks often share branch names with other pull requests
+func debounceKey(tenant *config.Tenant, event *schema.Event, route *config.Route, ref string) string {
+	key := tenant.Name + "/" + route.Name + "/" + event.Git.Repository.FullName
+	if pr := event.Git.PullRequest; pr.Number != 0 && ref == pr.Head.Ref {
+		return key + "#" + strconv.Itoa(pr.Number)
+	}
+	return key + "@" + ref
+}
+
+// debounce - private function, queues the event until the route debounce window ends
+// a queued event of the same repository and ref (or pull request) is superseded (cancelled before it is sent) and the window restarts,
+// so a burst of pushes is delivered once with the latest commit; false is returned when the route does not debounce
+func debounce(con connectors.Clients, tenant *config.Tenant, event *schema.Event, route *config.Route, mapping *schema.MapBinding) (string, bool) {
+	ref := eventRef(event, mapping)
+	if route.Debounce <= 0 || ref == "" {
+		return "", false
+	}
+	id := event.DeliveryID + "-" + route.Name
+	key := debounceKey(tenant, event, route, ref)
+	window := time.Duration(route.Debounce) * time.Second
+	binding := *mapping
+	until := now().Add(window)
+	previous := debounced.swap(key, id)
+	if previous != "" && previous != id {
+		if superseded := deferrals.Take(previous); superseded != nil {
+			auditLog(con, store.AuditEntry{Tenant: tenant.Name, Route: route.Name, ID: previous, Action: "supersede", Actor: superseded.Author,
+				Detail: fmt.Sprintf("superseded by %s (%s)", id, binding.RepoHash)})
+		}
+	}
+	deferrals.Put(&store.Pending{
+		ID:      id,
+		Tenant:  tenant.Name,
+		Route:   route.Name,
+		Repo:    event.Git.Repository.FullName,
+		Tag:     mapping.TagVersion,
+		Author:  mapping.ActorName,
+		Reason:  fmt.Sprintf("debounce window of %s on %s", window, ref),
+		Event:   event,
+		Binding: &binding,
+		Until:   until,
+	})
+	time.AfterFunc(window, func() {
+		forwardDebounced(con, tenant, key, id)
+	})
+	con.Info("Function debounce %s queued on %s until %s", id, key, until.Format(time.RFC3339))
+	return fmt.Sprintf("%s debounced on %s for %s", id, ref, window), true
+}
+
+// forwardDebounced - private function, forwards the queued event once its window has ended,
+// nothing is sent when it was superseded or cancelled or its pull request was held in the meantime,
+// a failed delivery is retried with the backoff of the deferred events
+func forwardDebounced(con connectors.Clients, tenant *config.Tenant, key string, id string) {
+	debounced.done(key, id)
+	forwardDeferred(con, tenant, id)
+}
@@ -0,0 +1,129 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
+	"github.com/microlib/simple"
+)
+
+func TestDebounce(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var bindings []map[string]interface{}
+
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		var binding map[string]interface{}
+		json.Unmarshal(body, &binding)
+		bindings = append(bindings, binding)
+		return nil
+	})
+	// the window is long enough for the timers not to fire during the test, the forwards are called directly
+	reg := NewRegistry(&config.Config{Tenants: []config.Tenant{{Name: "team-d", Routes: []config.Route{
+		{Name: "pr-build", Event: "pull_request", Actions: []string{"opened", "synchronize"}, URL: "http://el-pr-build:8080", Debounce: 300},
+		{Name: "pr-merged", Event: "pull_request", Actions: []string{"merged"}, URL: "http://el-pr-merged:8080"},
+	}}}})
+	tenant := reg.lookup("team-d").tenant
+	post := func(id string, action string, ref string, sha string, number ...int) *httptest.ResponseRecorder {
+		var payload map[string]interface{}
+		data, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+		json.Unmarshal(data, &payload)
+		payload["action"] = action
+		head := payload["pull_request"].(map[string]interface{})["head"].(map[string]interface{})
+		head["ref"], head["sha"] = ref, sha
+		if len(number) > 0 {
+			payload["pull_request"].(map[string]interface{})["number"] = number[0]
+			head["repo"].(map[string]interface{})["full_name"] = fmt.Sprintf("fork-%d/golang-simple-echoservice", number[0])
+			trusted.Hold(store.TrustKey("team-d", "luigizuccarelli/golang-simple-echoservice", number[0], sha), "lmz")
+		}
+		data, _ = json.Marshal(payload)
+		return PostTenant(conn, reg, "team-d", data, map[string]string{"X-GitHub-Event": "pull_request", "X-GitHub-Delivery": id})
+	}
+	key := "team-d/pr-build/luigizuccarelli/golang-simple-echoservice#2"
+
+	t.Run("TenantWebhookHandler : should pass (pushes debounced)", func(t *testing.T) {
+		for x, sha := range []string{"1111111aaaa", "2222222bbbb", "3333333cccc"} {
+			action := "synchronize"
+			if x == 0 {
+				action = "opened"
+			}
+			rr := post(fmt.Sprintf("deb-500%d", x+1), action, "feature", sha)
+			if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), "deb-500"+fmt.Sprint(x+1)+"-pr-build debounced on feature for 5m0s") {
+				t.Errorf(fmt.Sprintf("Handler %s returned incorrect response - got (%d %s)", "TenantWebhookHandler", rr.Code, rr.Body.String()))
+			}
+		}
+		post("deb-5004", "opened", "other", "4444444dddd", 4)
+		queued := deferrals.List("team-d")
+		if len(bindings) != 0 || len(queued) != 2 || queued[0].ID != "deb-5003-pr-build" || queued[1].ID != "deb-5004-pr-build" {
+			t.Errorf(fmt.Sprintf("Handler %s queued incorrect events - got (%d %v)", "TenantWebhookHandler", len(bindings), queued))
+		}
+		superseded := 0
+		for _, entry := range audit.List("team-d") {
+			if entry.Action == "supersede" {
+				superseded++
+			}
+		}
+		if superseded != 2 {
+			t.Errorf(fmt.Sprintf("Handler %s audited incorrect supersedes - got (%d) wanted (%d)", "TenantWebhookHandler", superseded, 2))
+		}
+	})
+
+	t.Run("forwardDebounced : should pass (latest commit delivered once)", func(t *testing.T) {
+		forwardDebounced(conn, tenant, key, "deb-5001-pr-build")
+		if len(bindings) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s sent a superseded event - got (%v)", "forwardDebounced", bindings))
+		}
+		forwardDebounced(conn, tenant, key, "deb-5003-pr-build")
+		if len(bindings) != 1 || bindings[0]["hash"] != "3333333cccc" || bindings[0]["deliveryid"] != "deb-5003-pr-build" {
+			t.Errorf(fmt.Sprintf("Handler %s sent incorrect bindings - got (%v)", "forwardDebounced", bindings))
+		}
+		if queued := deferrals.List("team-d"); len(queued) != 1 {
+			t.Errorf(fmt.Sprintf("Handler %s left incorrect events - got (%v)", "forwardDebounced", queued))
+		}
+		deferrals.Take("deb-5004-pr-build")
+	})
+
+	t.Run("TenantWebhookHandler : should pass (fork pull requests sharing a branch name)", func(t *testing.T) {
+		post("deb-5006", "opened", "main", "6666666ffff", 6)
+		post("deb-5007", "opened", "main", "7777777aaaa", 7)
+		queued := deferrals.List("team-d")
+		if len(queued) != 2 || queued[0].ID != "deb-5006-pr-build" || queued[1].ID != "deb-5007-pr-build" {
+			t.Errorf(fmt.Sprintf("Handler %s superseded another pull request - got (%v)", "TenantWebhookHandler", queued))
+		}
+		for _, p := range queued {
+			deferrals.Take(p.ID)
+		}
+	})
+
+	t.Run("forwardDebounced : should pass (held while queued)", func(t *testing.T) {
+		bindings = nil
+		post("deb-5008", "synchronize", "feature", "8888888bbbb")
+		holds.Hold(store.HoldKey("team-d", "luigizuccarelli/golang-simple-echoservice", 2), "lmz")
+		defer holds.Release(store.HoldKey("team-d", "luigizuccarelli/golang-simple-echoservice", 2))
+		forwardDebounced(conn, tenant, key, "deb-5008-pr-build")
+		if len(bindings) != 0 || len(deferrals.List("team-d")) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s sent an event of a held pull request - got (%v)", "forwardDebounced", bindings))
+		}
+		entries := audit.List("team-d")
+		if last := entries[len(entries)-1]; last.ID != "deb-5008-pr-build" || last.Action != "drop" {
+			t.Errorf(fmt.Sprintf("Handler %s did not audit the dropped event - got (%v)", "forwardDebounced", last))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should pass (other routes not debounced)", func(t *testing.T) {
+		bindings = nil
+		if rr := post("deb-5005", "closed", "feature", "5555555eeee"); rr.Code == http.StatusAccepted || len(deferrals.List("team-d")) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s debounced a route without a window - got (%d %s)", "TenantWebhookHandler", rr.Code, rr.Body.String()))
+		}
+	})
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+)
+
+// detectProvider - private utility function, uses the event headers to identify the git provider
+// an empty string is returned when no known header is present
+// gitea also sends the github header so it is checked first
+func detectProvider(r *http.Request) string {
+	switch {
+	case r.Header.Get("X-Gitea-Event") != "" || r.Header.Get("X-Gogs-Event") != "":
+		return "gitea"
+	case r.Header.Get("X-Gitlab-Event") != "":
+		return "gitlab"
+	case r.Header.Get("X-GitHub-Event") != "":
+		return "github"
+	}
+	return ""
+}
+
+// newEvent - private utility function, normalises the event type and action used for routing
+func newEvent(r *http.Request, provider string, git *schema.GitSchema) *schema.Event {
+	event := &schema.Event{Provider: provider, DeliveryID: webhookDeliveryID(r), Git: git}
+	event.Type = eventType(r, git)
+	event.Action = normaliseAction(event.Type, git)
+	return event
+}
+
+// webhookDeliveryID - private utility function, returns the provider delivery id
+// a random id is generated when the provider did not send one
+func webhookDeliveryID(r *http.Request) string {
+	for _, h := range []string{"X-GitHub-Delivery", "X-Gitea-Delivery", "X-Gitlab-Event-UUID"} {
+		if v := r.Header.Get(h); v != "" {
+			return v
+		}
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// isPullRequest - private utility function, reports whether the event type carries a pull request
+func isPullRequest(eventType string) bool {
+	return eventType == "pull_request" || eventType == "pull_request_review"
+}
+
+// eventType - private utility function, the type is read from the headers
+// and inferred from the payload when no header was sent (form posts and older gitea instances)
+// gitea sends one event type per review state, these are folded into pull_request_review
+// and gitlab hooks are mapped to the github event types (see gitlabEventType)
+func eventType(r *http.Request, git *schema.GitSchema) string {
+	if v := r.Header.Get("X-Gitlab-Event"); v != "" {
+		return gitlabEventType(v, git)
+	}
+	for _, h := range []string{"X-Gitea-Event", "X-Gogs-Event", "X-GitHub-Event"} {
+		if v := r.Header.Get(h); v != "" {
+			if strings.HasPrefix(v, "pull_request_review_") {
+				return "pull_request_review"
+			}
+			return v
+		}
+	}
+	switch {
+	case git.Release.TagName != "":
+		return "release"
+	case strings.HasPrefix(git.Ref, "refs/"):
+		return "push"
+	case git.PullRequest.Number != 0 || git.PullRequest.Head.Sha != "":
+		return "pull_request"
+	}
+	return ""
+}
+
+// normaliseAction - private utility function, maps provider actions to the actions routes use
+// closed and merged pull requests become "merged", gitea "synchronized" becomes "synchronize",
+// approving reviews become "approved" (other reviews are not routed), published releases
+// become "prereleased" or "released" depending on the prerelease flag (drafts are not routed,
+// see releaseTransition for the duplicates),
+// create, delete and push events have no action, the ref type (tag or branch) is used
+// (deleting pushes are ignored, the delete event is routed instead)
+func normaliseAction(eventType string, git *schema.GitSchema) string {
+	switch eventType {
+	case "create", "delete":
+		return git.RefType
+	case "push":
+		switch {
+		case git.Deleted:
+			return ""
+		case strings.HasPrefix(git.Ref, "refs/tags/"):
+			return "tag"
+		case strings.HasPrefix(git.Ref, "refs/heads/"):
+			return "branch"
+		}
+		return ""
+	case "pull_request_review":
+		// gitea sends the state in the event type and review.type, github in review.state
+		if strings.EqualFold(git.Review.State, "approved") || git.Review.Type == "pull_request_review_approved" {
+			return "approved"
+		}
+		return ""
+	case "pull_request":
+		switch {
+		case git.Action == "closed" && git.PullRequest.Merged:
+			return "merged"
+		case git.Action == "synchronized":
+			return "synchronize"
+		}
+	case "release":
+		if git.Release.Draft {
+			// draft releases never deploy
+			return ""
+		}
+		switch git.Action {
+		case "published":
+			if git.Release.Prerelease {
+				return "prereleased"
+			}
+			return "released"
+		case "updated":
+			// gitea
+			return "edited"
+		}
+	}
+	return git.Action
+}
+
+// newMapBinding - private utility function, builds the eventlistener payload for the event
+func newMapBinding(event *schema.Event) *schema.MapBinding {
+	git := event.Git
+	switch event.Type {
+	case "pull_request", "pull_request_review":
+		mapping := &schema.MapBinding{
+			RepoUrl:   git.Repository.CloneURL,
+			RepoName:  git.Repository.Name,
+			RepoHash:  git.PullRequest.Head.Sha,
+			ActorName: git.PullRequest.User.Login,
+			Message:   git.PullRequest.Title,
+			Labels:    labelNames(git),
+		}
+		if event.Action == "merged" {
+			mapping.RepoHash = git.PullRequest.MergeCommitSha
+		}
+		return mapping
+	case "release":
+		// target_commitish is usually a branch, the hash is resolved from the tag (see resolveRelease)
+		mapping := &schema.MapBinding{
+			RepoUrl:    git.Repository.CloneURL,
+			RepoName:   git.Repository.Name,
+			RepoHash:   git.Release.TargetCommitish,
+			ActorName:  git.Release.Author.Login,
+			Message:    git.Release.Name + " " + git.Release.Body,
+			TagVersion: git.Release.TagName,
+		}
+		if !isSha(git.Release.TargetCommitish) {
+			mapping.Branch = git.Release.TargetCommitish
+		}
+		return mapping
+	case "push":
+		mapping := &schema.MapBinding{
+			RepoUrl:    git.Repository.CloneURL,
+			RepoName:   git.Repository.Name,
+			RepoHash:   git.After,
+			ActorName:  git.Sender.Login,
+			ActorEmail: git.HeadCommit.Author.Email,
+			Message:    git.HeadCommit.Message,
+		}
+		if event.Action == "tag" {
+			mapping.TagVersion = strings.TrimPrefix(git.Ref, "refs/tags/")
+		} else {
+			mapping.Branch = strings.TrimPrefix(git.Ref, "refs/heads/")
+		}
+		return mapping
+	case "create", "delete":
+		// github does not send the commit, gitea sends it on create
+		mapping := &schema.MapBinding{
+			RepoUrl:   git.Repository.CloneURL,
+			RepoName:  git.Repository.Name,
+			RepoHash:  git.Sha,
+			ActorName: git.Sender.Login,
+			Message:   event.Type + " " + git.RefType + " " + git.Ref,
+		}
+		if git.RefType == "tag" {
+			mapping.TagVersion = git.Ref
+		} else {
+			mapping.Branch = git.Ref
+		}
+		return mapping
+	}
+	return nil
+}
+
+// labelNames - private utility function, the names of the pull request labels
+func labelNames(git *schema.GitSchema) []string {
+	var names []string
+	for _, l := range git.PullRequest.Labels {
+		names = append(names, l.Name)
+	}
+	return names
+}
+
+// routeLabels - private utility function, the labels a route label filter is applied to
+// for labeled and unlabeled this is the label that changed, otherwise the pull request labels
+func routeLabels(event *schema.Event) []string {
+	if event.Action == "labeled" || event.Action == "unlabeled" {
+		return []string{event.Git.Label.Name}
+	}
+	return labelNames(event.Git)
+}
+
+// skipReason - private utility function, explains why the route skips the event, empty when it does not
+// pushes are checked on the head commit message and pull requests on their title and body
+func skipReason(route *config.Route, event *schema.Event) string {
+	git := event.Git
+	if event.Type == "push" {
+		if m := route.SkipMarker(git.HeadCommit.Message); m != "" {
+			return m + " found in the head commit message"
+		}
+	}
+	if isPullRequest(event.Type) {
+		if m := route.SkipMarker(git.PullRequest.Title); m != "" {
+			return m + " found in the pull request title"
+		}
+		if m := route.SkipMarker(git.PullRequest.Body); m != "" {
+			return m + " found in the pull request body"
+		}
+	}
+	return ""
+}
+
+// eventSubject - private utility function, what the event is about: the tag, the branch or the pull request number
+func eventSubject(event *schema.Event, binding *schema.MapBinding) string {
+	switch {
+	case binding.TagVersion != "":
+		return binding.TagVersion
+	case isPullRequest(event.Type):
+		return strconv.Itoa(event.Git.PullRequest.Number)
+	}
+	return binding.Branch
+}
+
+// isSha - private utility function, reports whether the ref is a full commit sha
+func isSha(ref string) bool {
+	if len(ref) != 40 && len(ref) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(ref)
+	return err == nil
+}
@@ -0,0 +1,504 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/microlib/simple"
+)
+
+func TestPullRequestActions(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var posted []schema.MapBinding
+
+	os.Setenv("PR_OPENED_URL", "http://el-pr-opened:8080")
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		var binding schema.MapBinding
+		json.Unmarshal(body, &binding)
+		posted = append(posted, binding)
+		return nil
+	})
+
+	// send - posts the pr created payload as the event type after applying the changes
+	send := func(header string, eventType string, change func(payload map[string]interface{}, pr map[string]interface{})) {
+		var payload map[string]interface{}
+		data, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+		json.Unmarshal(data, &payload)
+		change(payload, payload["pull_request"].(map[string]interface{}))
+		data, _ = json.Marshal(payload)
+		posted = nil
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/service", bytes.NewBuffer(data))
+		req.Header.Set(header, eventType)
+		WebhookHandler(rr, req, conn)
+	}
+	// post - sends a pull_request event with the action, draft flag and head sha replaced
+	post := func(header string, action string, draft bool, sha string) {
+		send(header, "pull_request", func(payload map[string]interface{}, pr map[string]interface{}) {
+			payload["action"] = action
+			pr["draft"] = draft
+			pr["head"].(map[string]interface{})["sha"] = sha
+		})
+	}
+
+	t.Run("WebhookHandler : should pass (synchronize sends the new head sha)", func(t *testing.T) {
+		post("X-GitHub-Event", "synchronize", false, "1111111111111111111111111111111111111111")
+		if len(posted) != 1 || posted[0].RepoHash != "1111111111111111111111111111111111111111" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect bindings - got (%v)", "WebhookHandler", posted))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (gitea synchronized, reopened and ready_for_review)", func(t *testing.T) {
+		for _, action := range []string{"synchronized", "reopened", "ready_for_review"} {
+			post("X-Gitea-Event", action, false, "2222222222222222222222222222222222222222")
+			if len(posted) != 1 {
+				t.Errorf(fmt.Sprintf("Handler %s posted incorrect bindings for %s - got (%d) wanted (%d)", "WebhookHandler", action, len(posted), 1))
+			}
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (draft skipped by policy)", func(t *testing.T) {
+		post("X-GitHub-Event", "opened", true, "3333333333333333333333333333333333333333")
+		if len(posted) != 1 {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect bindings - got (%d) wanted (%d)", "WebhookHandler", len(posted), 1))
+		}
+		os.Setenv("SKIP_DRAFT_PRS", "true")
+		post("X-GitHub-Event", "opened", true, "3333333333333333333333333333333333333333")
+		os.Setenv("SKIP_DRAFT_PRS", "")
+		if len(posted) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s posted a draft pull request - got (%d) wanted (%d)", "WebhookHandler", len(posted), 0))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (edited is not routed)", func(t *testing.T) {
+		post("X-GitHub-Event", "edited", false, "4444444444444444444444444444444444444444")
+		if len(posted) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect bindings - got (%d) wanted (%d)", "WebhookHandler", len(posted), 0))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should pass (label and review triggers)", func(t *testing.T) {
+		cfg, _ := config.Load(filepath.Join("..", "..", "tests", "tenants.json"))
+		tenant := cfg.Lookup("team-a")
+		tenant.Secret, tenant.RateLimit, tenant.Burst = "", 1000, 1000
+		tenant.Routes = []config.Route{
+			{Name: "e2e", Event: "pull_request", Actions: []string{"labeled", "synchronize"}, URL: "http://el-e2e:8080", Labels: []string{"run-e2e"}},
+			{Name: "approved", Event: "pull_request_review", Actions: []string{"approved"}, URL: "http://el-approved:8080"},
+		}
+		reg := NewRegistry(&config.Config{Tenants: []config.Tenant{*tenant}})
+		sendTenant := func(header string, eventType string, change func(payload map[string]interface{}, pr map[string]interface{})) {
+			var payload map[string]interface{}
+			data, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+			json.Unmarshal(data, &payload)
+			change(payload, payload["pull_request"].(map[string]interface{}))
+			data, _ = json.Marshal(payload)
+			posted = nil
+			PostTenant(conn, reg, "team-a", data, map[string]string{header: eventType})
+		}
+		label := func(name string) func(payload map[string]interface{}, pr map[string]interface{}) {
+			return func(payload map[string]interface{}, pr map[string]interface{}) {
+				payload["action"] = "labeled"
+				payload["label"] = map[string]interface{}{"name": name}
+				pr["labels"] = []interface{}{map[string]interface{}{"name": "bug"}, map[string]interface{}{"name": name}}
+			}
+		}
+
+		sendTenant("X-GitHub-Event", "pull_request", label("documentation"))
+		if len(posted) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s posted for a label not on the route - got (%d) wanted (%d)", "TenantWebhookHandler", len(posted), 0))
+		}
+		sendTenant("X-GitHub-Event", "pull_request", label("run-e2e"))
+		if len(posted) != 1 || len(posted[0].Labels) != 2 || posted[0].Labels[1] != "run-e2e" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect bindings - got (%v)", "TenantWebhookHandler", posted))
+		}
+		sendTenant("X-GitHub-Event", "pull_request", func(payload map[string]interface{}, pr map[string]interface{}) {
+			payload["action"] = "synchronize"
+		})
+		if len(posted) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s posted for a pull request without the label - got (%d) wanted (%d)", "TenantWebhookHandler", len(posted), 0))
+		}
+		sendTenant("X-GitHub-Event", "pull_request_review", func(payload map[string]interface{}, pr map[string]interface{}) {
+			payload["action"] = "submitted"
+			payload["review"] = map[string]interface{}{"state": "commented"}
+		})
+		if len(posted) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s posted for a comment review - got (%d) wanted (%d)", "TenantWebhookHandler", len(posted), 0))
+		}
+		sendTenant("X-GitHub-Event", "pull_request_review", func(payload map[string]interface{}, pr map[string]interface{}) {
+			payload["action"] = "submitted"
+			payload["review"] = map[string]interface{}{"state": "approved"}
+		})
+		if len(posted) != 1 || posted[0].RepoHash != "6183473b17fa69a8872c2b59c2d974a8f01db187" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect bindings for an approval - got (%v)", "TenantWebhookHandler", posted))
+		}
+		sendTenant("X-Gitea-Event", "pull_request_review_approved", func(payload map[string]interface{}, pr map[string]interface{}) {
+			payload["action"] = "reviewed"
+			payload["review"] = map[string]interface{}{"type": "pull_request_review_approved", "content": "lgtm"}
+		})
+		if len(posted) != 1 {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect bindings for a gitea approval - got (%d) wanted (%d)", "TenantWebhookHandler", len(posted), 1))
+		}
+	})
+}
+
+func TestRefEvents(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var posted []schema.MapBinding
+	var urls []string
+
+	os.Setenv("TAG_PUSHED_URL", "http://el-tag:8080")
+	os.Setenv("BRANCH_DELETED_URL", "http://el-cleanup:8080")
+	defer os.Setenv("TAG_PUSHED_URL", "")
+	defer os.Setenv("BRANCH_DELETED_URL", "")
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		var binding schema.MapBinding
+		json.Unmarshal(body, &binding)
+		posted = append(posted, binding)
+		urls = append(urls, r.URL.String())
+		return nil
+	})
+
+	// send - posts the push payload as the event type after applying the changes
+	send := func(eventType string, change func(payload map[string]interface{})) {
+		var payload map[string]interface{}
+		data, _ := ioutil.ReadFile("../../tests/git-payload-push-for-pr.json")
+		json.Unmarshal(data, &payload)
+		change(payload)
+		data, _ = json.Marshal(payload)
+		posted, urls = nil, nil
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/service", bytes.NewBuffer(data))
+		req.Header.Set("X-GitHub-Event", eventType)
+		WebhookHandler(rr, req, conn)
+	}
+
+	t.Run("WebhookHandler : should pass (skip marker in the head commit message)", func(t *testing.T) {
+		send("push", func(payload map[string]interface{}) {
+			payload["ref"] = "refs/tags/v1.2.4"
+			payload["head_commit"].(map[string]interface{})["message"] = "Bump version [ci skip]"
+		})
+		if len(posted) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s posted a skipped push - got (%v)", "WebhookHandler", urls))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (tag push)", func(t *testing.T) {
+		send("push", func(payload map[string]interface{}) {
+			payload["ref"] = "refs/tags/v1.2.3"
+		})
+		if len(posted) != 1 || urls[0] != "http://el-tag:8080" || posted[0].TagVersion != "v1.2.3" || posted[0].RepoHash != "6183473b17fa69a8872c2b59c2d974a8f01db187" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect bindings - got (%v %v)", "WebhookHandler", urls, posted))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (branch push and deleted tag push not routed)", func(t *testing.T) {
+		send("push", func(payload map[string]interface{}) {})
+		if len(posted) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s posted a branch push - got (%d) wanted (%d)", "WebhookHandler", len(posted), 0))
+		}
+		send("push", func(payload map[string]interface{}) {
+			payload["ref"] = "refs/tags/v1.2.3"
+			payload["deleted"] = true
+		})
+		if len(posted) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s posted a deleted tag - got (%d) wanted (%d)", "WebhookHandler", len(posted), 0))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (branch delete routed to cleanup)", func(t *testing.T) {
+		send("delete", func(payload map[string]interface{}) {
+			payload["ref"] = "feature/preview"
+			payload["ref_type"] = "branch"
+		})
+		if len(posted) != 1 || urls[0] != "http://el-cleanup:8080" || posted[0].Branch != "feature/preview" || posted[0].TagVersion != "" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect bindings - got (%v %v)", "WebhookHandler", urls, posted))
+		}
+		send("create", func(payload map[string]interface{}) {
+			payload["ref"] = "feature/preview"
+			payload["ref_type"] = "branch"
+		})
+		if len(posted) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s posted a branch create - got (%d) wanted (%d)", "WebhookHandler", len(posted), 0))
+		}
+	})
+}
+
+func TestReleaseLifecycle(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var urls []string
+
+	os.Setenv("PRERELEASED_URL", "http://el-uat:8080")
+	os.Setenv("RELEASED_URL", "http://el-prod:8080")
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		urls = append(urls, r.URL.String())
+		return nil
+	})
+
+	// send - posts the uat release payload with a release id not used by other tests
+	send := func(header string, action string, id int, prerelease bool, draft bool) {
+		var payload map[string]interface{}
+		data, _ := ioutil.ReadFile("../../tests/uat-release.json")
+		json.Unmarshal(data, &payload)
+		payload["action"] = action
+		release := payload["release"].(map[string]interface{})
+		release["id"], release["prerelease"], release["draft"] = id, prerelease, draft
+		data, _ = json.Marshal(payload)
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/service", bytes.NewBuffer(data))
+		req.Header.Set(header, "release")
+		WebhookHandler(rr, req, conn)
+	}
+
+	t.Run("WebhookHandler : should pass (github prerelease promoted once)", func(t *testing.T) {
+		urls = nil
+		send("X-GitHub-Event", "published", 3501, true, false)
+		send("X-GitHub-Event", "prereleased", 3501, true, false)
+		send("X-GitHub-Event", "released", 3501, false, false)
+		send("X-GitHub-Event", "edited", 3501, false, false)
+		send("X-GitHub-Event", "published", 3501, false, false)
+		if fmt.Sprint(urls) != "[http://el-uat:8080 http://el-prod:8080]" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect routes - got (%v)", "WebhookHandler", urls))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (gitea prerelease promoted by update)", func(t *testing.T) {
+		urls = nil
+		send("X-Gitea-Event", "published", 3502, true, false)
+		send("X-Gitea-Event", "updated", 3502, false, false)
+		send("X-Gitea-Event", "updated", 3502, false, false)
+		if fmt.Sprint(urls) != "[http://el-uat:8080 http://el-prod:8080]" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect routes - got (%v)", "WebhookHandler", urls))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (drafts never deploy)", func(t *testing.T) {
+		urls = nil
+		send("X-GitHub-Event", "published", 3503, false, true)
+		send("X-GitHub-Event", "released", 3503, false, true)
+		if len(urls) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s posted a draft release - got (%v)", "WebhookHandler", urls))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should pass (edited and deleted routes)", func(t *testing.T) {
+		tenant := config.Tenant{Name: "team-c", Routes: []config.Route{
+			{Name: "edited", Event: "release", Actions: []string{"edited"}, URL: "http://el-notes:8080"},
+			{Name: "deleted", Event: "release", Actions: []string{"deleted"}, URL: "http://el-cleanup:8080"},
+		}}
+		reg := NewRegistry(&config.Config{Tenants: []config.Tenant{tenant}})
+		urls = nil
+		for _, action := range []string{"edited", "deleted"} {
+			var payload map[string]interface{}
+			data, _ := ioutil.ReadFile("../../tests/prod-release.json")
+			json.Unmarshal(data, &payload)
+			payload["action"] = action
+			data, _ = json.Marshal(payload)
+			PostTenant(conn, reg, "team-c", data, map[string]string{"X-GitHub-Event": "release"})
+		}
+		if fmt.Sprint(urls) != "[http://el-notes:8080 http://el-cleanup:8080]" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect routes - got (%v)", "TenantWebhookHandler", urls))
+		}
+	})
+}
+
+func TestReleaseCommit(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var posted []schema.MapBinding
+	var code int
+	var annotated bool
+
+	os.Setenv("RELEASED_URL", "http://el-prod:8080")
+	os.Setenv("FORGE_PROVIDER", "github")
+	os.Setenv("FORGE_TOKEN", "abc")
+	defer os.Setenv("FORGE_PROVIDER", "")
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/git/ref/tags/v1.0.1-PROD") && annotated:
+			return NewTestResponse(code, `{"object":{"sha":"5e4f9a8b7c6d5e4f9a8b7c6d5e4f9a8b7c6d5e4f","type":"tag"}}`)
+		case strings.HasSuffix(r.URL.Path, "/git/ref/tags/v1.0.1-PROD"), strings.HasSuffix(r.URL.Path, "/git/tags/5e4f9a8b7c6d5e4f9a8b7c6d5e4f9a8b7c6d5e4f"):
+			return NewTestResponse(code, `{"object":{"sha":"9a8b7c6d5e4f9a8b7c6d5e4f9a8b7c6d5e4f9a8b","type":"commit"}}`)
+		}
+		var binding schema.MapBinding
+		json.Unmarshal(body, &binding)
+		posted = append(posted, binding)
+		return nil
+	})
+
+	send := func(id int) *httptest.ResponseRecorder {
+		var payload map[string]interface{}
+		data, _ := ioutil.ReadFile("../../tests/prod-release.json")
+		json.Unmarshal(data, &payload)
+		release := payload["release"].(map[string]interface{})
+		release["id"], release["target_commitish"] = id, "master"
+		data, _ = json.Marshal(payload)
+		posted = nil
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/service", bytes.NewBuffer(data))
+		req.Header.Set("X-GitHub-Event", "release")
+		WebhookHandler(rr, req, conn)
+		return rr
+	}
+
+	t.Run("WebhookHandler : should pass (tag resolved to its commit)", func(t *testing.T) {
+		code = 200
+		send(3601)
+		if len(posted) != 1 || posted[0].RepoHash != "9a8b7c6d5e4f9a8b7c6d5e4f9a8b7c6d5e4f9a8b" || posted[0].Branch != "master" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect bindings - got (%v)", "WebhookHandler", posted))
+		}
+	})
+
+	t.Run("WebhookHandler : should fail (tag not resolved)", func(t *testing.T) {
+		code = 404
+		rr := send(3602)
+		if rr.Code != http.StatusBadGateway || len(posted) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "WebhookHandler", rr.Code, http.StatusBadGateway))
+		}
+		// the redelivery is routed once the forge answers
+		code = 200
+		send(3602)
+		if len(posted) != 1 {
+			t.Errorf(fmt.Sprintf("Handler %s did not route the redelivery - got (%d) wanted (%d)", "WebhookHandler", len(posted), 1))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (annotated tag peeled to its commit)", func(t *testing.T) {
+		code, annotated = 200, true
+		defer func() { annotated = false }()
+		send(3603)
+		if len(posted) != 1 || posted[0].RepoHash != "9a8b7c6d5e4f9a8b7c6d5e4f9a8b7c6d5e4f9a8b" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect bindings - got (%v)", "WebhookHandler", posted))
+		}
+	})
+
+	t.Run("WebhookHandler : should fail (branch target without a forge)", func(t *testing.T) {
+		os.Setenv("FORGE_PROVIDER", "")
+		defer os.Setenv("FORGE_PROVIDER", "github")
+		rr := send(3604)
+		if rr.Code != http.StatusBadGateway || len(posted) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "WebhookHandler", rr.Code, http.StatusBadGateway))
+		}
+	})
+}
+
+func TestTagEnvironments(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var posted []schema.MapBinding
+	var urls []string
+
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		var binding schema.MapBinding
+		json.Unmarshal(body, &binding)
+		posted = append(posted, binding)
+		urls = append(urls, r.URL.String())
+		return nil
+	})
+	tenant := config.Tenant{
+		Name:         "team-d",
+		Environments: []config.Environment{{Name: "prod", Pattern: "-PROD$"}, {Name: "uat"}},
+		Routes: []config.Route{
+			{Name: "deploy-uat", Event: "release", Actions: []string{"prereleased", "released"}, URL: "http://el-uat:8080", Environment: "uat"},
+			{Name: "deploy-prod", Event: "release", Actions: []string{"prereleased", "released"}, URL: "http://el-prod:8080", Environment: "prod"},
+		},
+	}
+	reg := NewRegistry(&config.Config{Tenants: []config.Tenant{tenant}})
+
+	send := func(id int, tag string) {
+		var payload map[string]interface{}
+		data, _ := ioutil.ReadFile("../../tests/prod-release.json")
+		json.Unmarshal(data, &payload)
+		release := payload["release"].(map[string]interface{})
+		release["id"], release["tag_name"] = id, tag
+		data, _ = json.Marshal(payload)
+		posted, urls = nil, nil
+		PostTenant(conn, reg, "team-d", data, map[string]string{"X-GitHub-Event": "release"})
+	}
+
+	t.Run("TenantWebhookHandler : should pass (prod pattern)", func(t *testing.T) {
+		send(3701, "v1.0.1-PROD")
+		if len(posted) != 1 || urls[0] != "http://el-prod:8080" || posted[0].Environment != "prod" || posted[0].Semver == nil || posted[0].Semver.Version != "1.0.1-PROD" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect bindings - got (%v %v)", "TenantWebhookHandler", urls, posted))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should pass (uat pre-release identifier)", func(t *testing.T) {
+		send(3702, "v1.0.2-uat")
+		if len(posted) != 1 || urls[0] != "http://el-uat:8080" || posted[0].Environment != "uat" || posted[0].Semver.Patch != 2 {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect bindings - got (%v %v)", "TenantWebhookHandler", urls, posted))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should pass (no environment)", func(t *testing.T) {
+		send(3703, "v1.0.3")
+		if len(posted) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s posted a tag without environment - got (%v)", "TenantWebhookHandler", urls))
+		}
+	})
+}
+
+func TestSkipCI(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	posted := 0
+
+	os.Setenv("PR_OPENED_URL", "http://el-pr-opened:8080")
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		posted++
+		return nil
+	})
+
+	// send - posts the pr created payload with the title and body replaced, returns the response message
+	send := func(title string, body string) string {
+		var payload map[string]interface{}
+		data, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+		json.Unmarshal(data, &payload)
+		pr := payload["pull_request"].(map[string]interface{})
+		pr["number"], pr["title"], pr["body"] = 4201, title, body
+		data, _ = json.Marshal(payload)
+		posted = 0
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/service", bytes.NewBuffer(data))
+		req.Header.Set("X-GitHub-Event", "pull_request")
+		WebhookHandler(rr, req, conn)
+		var resp map[string]string
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp["message"]
+	}
+
+	t.Run("WebhookHandler : should pass (skip markers in title and body)", func(t *testing.T) {
+		if msg := send("Update docs [Skip CI]", ""); posted != 0 || msg != "Skipped, pr-opened skipped, [skip ci] found in the pull request title" {
+			t.Errorf(fmt.Sprintf("Handler %s did not skip the pull request - got (%d %s)", "WebhookHandler", posted, msg))
+		}
+		if msg := send("Update docs", "Typo only\n\nskip-checks: true"); posted != 0 || msg != "Skipped, pr-opened skipped, skip-checks: true found in the pull request body" {
+			t.Errorf(fmt.Sprintf("Handler %s did not skip the pull request - got (%d %s)", "WebhookHandler", posted, msg))
+		}
+		if send("Skip CI cache on retries", ""); posted != 1 {
+			t.Errorf(fmt.Sprintf("Handler %s skipped a pull request without marker - got (%d) wanted (%d)", "WebhookHandler", posted, 1))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (markers disabled)", func(t *testing.T) {
+		os.Setenv("SKIP_CI_MARKERS", "none")
+		defer os.Setenv("SKIP_CI_MARKERS", "")
+		if send("Update docs [skip ci]", ""); posted != 1 {
+			t.Errorf(fmt.Sprintf("Handler %s skipped with markers disabled - got (%d) wanted (%d)", "WebhookHandler", posted, 1))
+		}
+	})
+}
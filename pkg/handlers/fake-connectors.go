@@ -5,12 +5,16 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 
+	"github.com/gorilla/mux"
 	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/tekton"
 	"github.com/microlib/simple"
 )
 
@@ -92,3 +96,60 @@ func NewTestConnectors(filename string, code int, force string, logger *simple.L
 	conn := &FakeConnectors{Http: httpclient, Logger: logger, Force: force, Name: "FakeConnectors"}
 	return conn
 }
+
+// NewTestResponse - a response with the status code and body
+func NewTestResponse(code int, body string) *http.Response {
+	return &http.Response{StatusCode: code, Body: ioutil.NopCloser(bytes.NewBufferString(body)), Header: make(http.Header)}
+}
+
+// NewCaptureConnectors - test connectors handing every request and its body to capture, they answer
+// with the response capture returns or with 202 and an empty json object when it returns nil
+func NewCaptureConnectors(logger *simple.Logger, capture func(r *http.Request, body []byte) *http.Response) *FakeConnectors {
+	httpclient := NewHttpTestClient(func(r *http.Request) *http.Response {
+		var body []byte
+		if r.Body != nil {
+			body, _ = ioutil.ReadAll(r.Body)
+		}
+		if resp := capture(r, body); resp != nil {
+			return resp
+		}
+		return NewTestResponse(http.StatusAccepted, "{}")
+	})
+	return &FakeConnectors{Http: httpclient, Logger: logger, Name: "FakeConnectors"}
+}
+
+// PostTenant - posts the payload with the headers to the webhook of the tenant
+func PostTenant(con connectors.Clients, reg *Registry, tenant string, data []byte, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/api/v1/service/"+tenant, bytes.NewBuffer(data))
+	req = mux.SetURLVars(req, map[string]string{"tenant": tenant})
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	TenantWebhookHandler(rr, req, con, reg)
+	return rr
+}
+
+// FakeDynamic - records the objects created by tekton routes, names them from their generateName
+// and fails with Force
+type FakeDynamic struct {
+	Created    []map[string]interface{}
+	Namespaces []string
+	Resources  []tekton.Resource
+	Force      error
+}
+
+// Create - used for testing
+func (f *FakeDynamic) Create(ctx context.Context, resource tekton.Resource, namespace string, obj map[string]interface{}) (map[string]interface{}, error) {
+	if f.Force != nil {
+		return nil, f.Force
+	}
+	f.Created = append(f.Created, obj)
+	f.Namespaces = append(f.Namespaces, namespace)
+	f.Resources = append(f.Resources, resource)
+	metadata := obj["metadata"].(map[string]interface{})
+	if metadata["name"] == nil {
+		metadata["name"] = fmt.Sprintf("%s%05d", metadata["generateName"], len(f.Created))
+	}
+	return obj, nil
+}
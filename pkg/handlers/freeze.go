@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/freeze"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
+)
+
+// freeze settings
+const (
+	// DEFERRALTTL - deferred events are kept at most this long (the longest freeze)
+	DEFERRALTTL time.Duration = 90 * 24 * time.Hour
+	// DEFERRALRETRY - wait before forwarding a deferred event again when the eventlistener failed,
+	// doubled after each failed attempt
+	DEFERRALRETRY time.Duration = time.Minute
+	// MAXDEFERRALATTEMPTS - failed forwards after which a deferred event is dropped
+	MAXDEFERRALATTEMPTS int = 8
+	// MAXAUDIT - size of the audit trail
+	MAXAUDIT int = 1000
+)
+
+// deferrals - events deferred to the end of a freeze window
+var deferrals = store.NewQueue(DEFERRALTTL)
+
+// audit - freeze overrides, deferrals, rejections and approvals
+var audit = store.NewAudit(MAXAUDIT)
+
+// now - the clock freeze windows are evaluated with
+var now = time.Now
+
+// auditLog - private utility function, records and logs the decision
+func auditLog(con connectors.Clients, entry store.AuditEntry) {
+	audit.Add(entry)
+	con.Info("AUDIT %s %s route %s (%s) by %s: %s", entry.Action, entry.ID, entry.Route, entry.Tenant, entry.Actor, entry.Detail)
+}
+
+// frozen - private function, returns the active freeze window of the route and when the freeze ends
+// a calendar that cannot be parsed freezes the route
+func frozen(route *config.Route) (string, time.Time, bool) {
+	if route.Freeze == nil {
+		return "", time.Time{}, false
+	}
+	cal, err := freeze.Parse(route.Freeze)
+	if err != nil {
+		return fmt.Sprintf("invalid calendar (%v)", err), now().Add(DEFERRALTTL), true
+	}
+	return cal.Active(now())
+}
+
+// overrides - private utility function, reports whether the override token lifts the route freeze
+// the token is only accepted on the admin api, never from the webhook
+func overrides(route *config.Route, override string) bool {
+	token := route.Freeze.OverrideToken
+	return token != "" && override != "" && subtle.ConstantTimeCompare([]byte(override), []byte(token)) == 1
+}
+
+// freezeGate - private function, applies the route freeze calendar to the event
+// a non zero status is returned when the event was deferred (202) or rejected (423)
+func freezeGate(con connectors.Clients, tenant *config.Tenant, event *schema.Event, route *config.Route, mapping *schema.MapBinding) (string, int) {
+	window, end, ok := frozen(route)
+	if !ok {
+		return "", 0
+	}
+	id := event.DeliveryID + "-" + route.Name
+	entry := store.AuditEntry{Tenant: tenant.Name, Route: route.Name, ID: id, Actor: mapping.ActorName}
+	if route.Freeze.Policy == config.REJECT {
+		entry.Action, entry.Detail = "reject", "rejected during freeze "+window
+		auditLog(con, entry)
+		return fmt.Sprintf("Route %s is frozen (%s) until %s, %s rejected", route.Name, window, end.Format(time.RFC3339), id), http.StatusLocked
+	}
+
+	binding := *mapping
+	deferrals.Put(&store.Pending{
+		ID:      id,
+		Tenant:  tenant.Name,
+		Route:   route.Name,
+		Repo:    event.Git.Repository.FullName,
+		Tag:     mapping.TagVersion,
+		Author:  mapping.ActorName,
+		Reason:  "freeze " + window,
+		Event:   event,
+		Binding: &binding,
+		Until:   end,
+	})
+	scheduleDeferred(con, tenant, id, end)
+	entry.Action, entry.Detail = "defer", "deferred during freeze "+window+" until "+end.Format(time.RFC3339)
+	auditLog(con, entry)
+	return fmt.Sprintf("Route %s is frozen (%s), %s deferred until %s", route.Name, window, id, end.Format(time.RFC3339)), http.StatusAccepted
+}
+
+// scheduleDeferred - private function, forwards the deferred event once the freeze has ended
+func scheduleDeferred(con connectors.Clients, tenant *config.Tenant, id string, at time.Time) {
+	time.AfterFunc(at.Sub(now()), func() {
+		forwardDeferred(con, tenant, id)
+	})
+}
+
+// forwardDeferred - private function, forwards the deferred (or debounced) event unless it was cancelled
+// or its pull request is held,
+// a freeze that was extended defers it again and a failed delivery is retried with an exponential backoff,
+// failures are only reported (forge status and notification) once the event is dropped after MAXDEFERRALATTEMPTS
+func forwardDeferred(con connectors.Clients, tenant *config.Tenant, id string) {
+	pending := deferrals.Take(id)
+	if pending == nil {
+		if expired := deferrals.Expire(id); expired != nil {
+			auditLog(con, store.AuditEntry{Tenant: expired.Tenant, Route: expired.Route, ID: id, Actor: expired.Author, Action: "drop", Detail: "deferred longer than " + DEFERRALTTL.String()})
+		}
+		return
+	}
+	entry := store.AuditEntry{Tenant: pending.Tenant, Route: pending.Route, ID: id, Actor: pending.Author}
+	route := tenant.Route(pending.Route)
+	if route == nil {
+		entry.Action, entry.Detail = "drop", "route no longer exists"
+		auditLog(con, entry)
+		return
+	}
+	// a pull request held (/hold) while its event was queued is not sent
+	if user, held := heldBy(tenant, pending.Event); held {
+		entry.Action, entry.Detail = "drop", "pull request held by "+user
+		auditLog(con, entry)
+		return
+	}
+	if _, end, ok := frozen(route); ok {
+		pending.Until = end
+		deferrals.Put(pending)
+		scheduleDeferred(con, tenant, id, end)
+		return
+	}
+	delivery, err := attemptDelivery(con, tenant, pending.Event, route, pending.Binding)
+	if err == nil {
+		entry.Action, entry.Detail = "forward", "forwarded after the "+pending.Reason
+		auditLog(con, entry)
+		return
+	}
+	pending.Attempts++
+	if pending.Attempts >= MAXDEFERRALATTEMPTS {
+		con.Error("Function forwardDeferred %s failed %d times, dropped %v", id, pending.Attempts, err)
+		entry.Action, entry.Detail = "drop", fmt.Sprintf("delivery failed %d times, last error %v", pending.Attempts, err)
+		auditLog(con, entry)
+		if delivery != nil {
+			reportFailure(con, tenant, pending.Event, route, delivery, fmt.Sprintf("dropped after %d attempts, %v", pending.Attempts, err))
+		}
+		return
+	}
+	pending.Until = now().Add(retryDelay(pending.Attempts))
+	deferrals.Put(pending)
+	scheduleDeferred(con, tenant, id, pending.Until)
+	con.Error("Function forwardDeferred %s failed (attempt %d), retrying at %s %v", id, pending.Attempts, pending.Until.Format(time.RFC3339), err)
+}
+
+// retryDelay - private utility function, the wait after the failed attempt (DEFERRALRETRY doubled per attempt)
+func retryDelay(attempts int) time.Duration {
+	return DEFERRALRETRY << uint(attempts-1)
+}
+
+// DeferralsHandler - GET lists the deferred events (?tenant=), DELETE /{id} cancels one and POST /{id} sends it now,
+// a frozen route needs the freeze override token in the body ({"actor":"ops","override":"..."})
+func DeferralsHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients, reg *Registry) {
+	if !adminAuthorized(w, r, con) {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		list := deferrals.List(r.URL.Query().Get("tenant"))
+		if list == nil {
+			list = []*store.Pending{}
+		}
+		writeJSON(w, list)
+		return
+	}
+	pending := deferrals.Take(id)
+	if pending == nil {
+		response(w, http.StatusNotFound, "No deferred event "+id)
+		return
+	}
+	if r.Method == http.MethodPost {
+		sendDeferred(w, r, con, reg, pending)
+		return
+	}
+	auditLog(con, store.AuditEntry{Tenant: pending.Tenant, Route: pending.Route, ID: id, Action: "cancel", Actor: "admin", Detail: "deferred event cancelled"})
+	response(w, http.StatusOK, "Cancelled "+id)
+}
+
+// sendDeferred - private function, sends the deferred event before its time, the event stays queued
+// when the route is frozen and the override token is wrong or when the delivery fails
+func sendDeferred(w http.ResponseWriter, r *http.Request, con connectors.Clients, reg *Registry, pending *store.Pending) {
+	var req struct {
+		Actor    string `json:"actor"`
+		Override string `json:"override"`
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	json.Unmarshal(body, &req)
+	if req.Actor == "" {
+		req.Actor = "admin"
+	}
+
+	tenant := tenantFor(reg, pending.Tenant)
+	var route *config.Route
+	if tenant != nil {
+		route = tenant.Route(pending.Route)
+	}
+	if route == nil {
+		deferrals.Put(pending)
+		response(w, http.StatusNotFound, "Route "+pending.Route+" of tenant "+pending.Tenant+" no longer exists")
+		return
+	}
+	window, end, ok := frozen(route)
+	if ok && !overrides(route, req.Override) {
+		deferrals.Put(pending)
+		con.Error("Admin api invalid freeze override for %s from %s", pending.ID, r.RemoteAddr)
+		response(w, http.StatusForbidden, fmt.Sprintf("Route %s is frozen (%s) until %s, %s needs a valid override token", route.Name, window, end.Format(time.RFC3339), pending.ID))
+		return
+	}
+	if _, err := deliver(con, tenant, pending.Event, route, pending.Binding); err != nil {
+		deferrals.Put(pending)
+		response(w, http.StatusBadGateway, fmt.Sprintf("Request failed %v", err))
+		return
+	}
+	entry := store.AuditEntry{Tenant: pending.Tenant, Route: pending.Route, ID: pending.ID, Actor: req.Actor, Action: "forward", Detail: "sent before the end of the " + pending.Reason}
+	if ok {
+		entry.Action, entry.Detail = "override", "freeze "+window+" overridden"
+	}
+	auditLog(con, entry)
+	response(w, http.StatusOK, "Sent "+pending.ID+", request sent successfully")
+}
+
+// AuditHandler - lists the audit trail, optionally of one tenant (?tenant=)
+func AuditHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	if !adminAuthorized(w, r, con) {
+		return
+	}
+	writeJSON(w, audit.List(r.URL.Query().Get("tenant")))
+}
+
+// writeJSON - private utility function, writes the value as a 200 json response
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	data, _ := json.Marshal(value)
+	w.Header().Set(CONTENTTYPE, APPLICATIONJSON)
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", string(data))
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+)
+
+// gitlabSchema - private utility function, decodes a gitlab hook and normalises it to the fields routes use:
+// pushes and tag pushes keep their refs, merge requests become pull requests (the iid is the number and
+// object_attributes the pull request), notes on merge requests become issue comments and releases keep their tag
+// with the tagged commit as target; the project path_with_namespace is the repository full name
+func gitlabSchema(payload []byte) (*schema.GitSchema, error) {
+	var lab schema.GitLabSchema
+	if err := json.Unmarshal(payload, &lab); err != nil {
+		return nil, err
+	}
+	git := &schema.GitSchema{}
+	project := lab.Project
+	git.Repository.Name = path.Base(project.PathWithNamespace)
+	git.Repository.FullName = project.PathWithNamespace
+	git.Repository.CloneURL = project.GitHTTPURL
+	git.Repository.HTMLURL = project.WebURL
+	git.Repository.DefaultBranch = project.DefaultBranch
+	git.Repository.Owner.Login = path.Dir(project.PathWithNamespace)
+	git.Repository.Visibility = gitlabVisibility(project.VisibilityLevel)
+	git.Repository.Private = git.Repository.Visibility == "private"
+	git.Sender.Login = lab.User.Username
+
+	switch lab.ObjectKind {
+	case "push", "tag_push":
+		git.Ref, git.Before, git.After = lab.Ref, lab.Before, lab.After
+		git.Sender.Login = lab.UserUsername
+		git.Created = isZeroSha(lab.Before)
+		git.Deleted = isZeroSha(lab.After)
+		git.HeadCommit.ID = lab.After
+		for _, c := range lab.Commits {
+			git.Commits = append(git.Commits, schema.Commit{ID: c.ID, Message: c.Message, Added: c.Added, Modified: c.Modified, Removed: c.Removed})
+			if c.ID == lab.After {
+				git.HeadCommit.Message = c.Message
+				git.HeadCommit.Author.Name, git.HeadCommit.Author.Email = c.Author.Name, c.Author.Email
+			}
+		}
+		if git.HeadCommit.Author.Email == "" {
+			git.HeadCommit.Author.Email = lab.UserEmail
+		}
+	case "merge_request":
+		mr := lab.ObjectAttributes
+		pr := &git.PullRequest
+		git.Number, pr.Number = mr.IID, mr.IID
+		pr.Title, pr.Body, pr.HTMLURL = mr.Title, mr.Description, mr.URL
+		pr.Head.Sha, pr.Head.Ref, pr.Base.Ref = mr.LastCommit.ID, mr.SourceBranch, mr.TargetBranch
+		pr.Head.Repo.FullName, pr.Base.Repo.FullName = mr.Source.PathWithNamespace, mr.Target.PathWithNamespace
+		// merge request hooks name the user who acted, not the author
+		pr.User.Login = lab.User.Username
+		pr.Draft = mr.Draft || mr.WorkInProgress
+		pr.Merged, pr.MergeCommitSha = mr.State == "merged", mr.MergeCommitSha
+		pr.State = "open"
+		if mr.State != "opened" {
+			pr.State = "closed"
+		}
+		for _, l := range lab.Labels {
+			pr.Labels = append(pr.Labels, schema.Label{ID: l.ID, Name: l.Title, Color: l.Color, Description: l.Description})
+		}
+		git.Action = gitlabAction(&lab, git)
+	case "note":
+		note := lab.ObjectAttributes
+		git.Action = "created"
+		git.Comment.ID, git.Comment.Body, git.Comment.User.Login = note.ID, note.Note, lab.User.Username
+		if note.NoteableType == "MergeRequest" {
+			git.Issue.Number, git.Issue.Title = lab.MergeRequest.IID, lab.MergeRequest.Title
+			git.Issue.PullRequest = &struct {
+				URL string `json:"url"`
+			}{URL: lab.MergeRequest.URL}
+		}
+	case "release":
+		git.Action = map[string]string{"create": "published", "update": "updated", "delete": "deleted"}[lab.Action]
+		git.Release.TagName, git.Release.Name, git.Release.Body = lab.Tag, lab.Name, lab.Description
+		git.Release.HTMLURL, git.Release.TargetCommitish = lab.URL, lab.Commit.ID
+	}
+	return git, nil
+}
+
+// gitlabAction - private utility function, maps the merge request action to the pull request actions:
+// a merge is a merged close, an update with new commits (oldrev) is a synchronize and one that changed
+// the labels is labeled (or unlabeled) with the first label added (or removed); approvals are reviews
+func gitlabAction(lab *schema.GitLabSchema, git *schema.GitSchema) string {
+	switch lab.ObjectAttributes.Action {
+	case "open":
+		return "opened"
+	case "reopen":
+		return "reopened"
+	case "close", "merge":
+		return "closed"
+	case "approved":
+		git.Review.State = "approved"
+		git.Review.User.Login = lab.User.Username
+		return "submitted"
+	case "update":
+		if lab.ObjectAttributes.OldRev != "" {
+			return "synchronize"
+		}
+		changes := lab.Changes.Labels
+		if added := labelsMissing(changes.Current, changes.Previous); len(added) > 0 {
+			git.Label = schema.Label{ID: added[0].ID, Name: added[0].Title}
+			return "labeled"
+		}
+		if removed := labelsMissing(changes.Previous, changes.Current); len(removed) > 0 {
+			git.Label = schema.Label{ID: removed[0].ID, Name: removed[0].Title}
+			return "unlabeled"
+		}
+		return "edited"
+	}
+	return lab.ObjectAttributes.Action
+}
+
+// gitlabEventType - private utility function, the event type of the X-Gitlab-Event header,
+// approved merge requests are reviews and the other hooks are named like "Pipeline Hook" (pipeline)
+func gitlabEventType(header string, git *schema.GitSchema) string {
+	switch header {
+	case "Push Hook", "Tag Push Hook":
+		return "push"
+	case "Merge Request Hook":
+		if git.Review.State == "approved" {
+			return "pull_request_review"
+		}
+		return "pull_request"
+	case "Note Hook":
+		return "issue_comment"
+	case "Release Hook":
+		return "release"
+	}
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSuffix(header, " Hook")), " ", "_")
+}
+
+// gitlabVisibility - private utility function, the visibility of the project visibility level
+func gitlabVisibility(level int) string {
+	switch level {
+	case 20:
+		return "public"
+	case 10:
+		return "internal"
+	}
+	return "private"
+}
+
+// labelsMissing - private utility function, the labels of a that b does not have
+func labelsMissing(a []schema.GitLabLabel, b []schema.GitLabLabel) []schema.GitLabLabel {
+	var missing []schema.GitLabLabel
+	for _, l := range a {
+		found := false
+		for _, o := range b {
+			found = found || o.Title == l.Title
+		}
+		if !found {
+			missing = append(missing, l)
+		}
+	}
+	return missing
+}
+
+// isZeroSha - private utility function, gitlab sends a zero sha as before of a new ref and after of a deleted one
+func isZeroSha(sha string) bool {
+	return sha != "" && strings.Trim(sha, "0") == ""
+}
@@ -0,0 +1,202 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/microlib/simple"
+)
+
+func TestGitLabEvents(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var urls []string
+	var bindings []schema.MapBinding
+
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		var binding schema.MapBinding
+		json.Unmarshal(body, &binding)
+		urls, bindings = append(urls, r.URL.String()), append(bindings, binding)
+		return nil
+	})
+	reg := NewRegistry(&config.Config{Tenants: []config.Tenant{{
+		Name:      "team-g",
+		Secret:    "gl-token",
+		Providers: []string{"gitlab"},
+		Routes: []config.Route{
+			{Name: "push", Event: "push", Actions: []string{"branch"}, URL: "http://el-push:8080"},
+			{Name: "tag", Event: "push", Actions: []string{"tag"}, URL: "http://el-tag:8080"},
+			{Name: "pr", Event: "pull_request", Actions: []string{"opened", "synchronize"}, URL: "http://el-pr:8080"},
+			{Name: "merged", Event: "pull_request", Actions: []string{"merged"}, URL: "http://el-merged:8080"},
+			{Name: "e2e", Event: "pull_request", Actions: []string{"labeled"}, Labels: []string{"run-e2e"}, URL: "http://el-e2e:8080"},
+			{Name: "approved", Event: "pull_request_review", Actions: []string{"approved"}, URL: "http://el-approved:8080"},
+		},
+	}}})
+
+	// send - posts the payload file as the gitlab hook after applying the change, returns the status code
+	send := func(file string, hook string, change func(payload map[string]interface{}, attributes map[string]interface{})) int {
+		var payload map[string]interface{}
+		data, _ := ioutil.ReadFile(file)
+		json.Unmarshal(data, &payload)
+		attributes, _ := payload["object_attributes"].(map[string]interface{})
+		change(payload, attributes)
+		data, _ = json.Marshal(payload)
+		urls, bindings = nil, nil
+		return PostTenant(conn, reg, "team-g", data, map[string]string{"X-Gitlab-Event": hook, "X-Gitlab-Token": "gl-token", "X-Gitlab-Event-UUID": "gl-1"}).Code
+	}
+
+	t.Run("TenantWebhookHandler : should pass (gitlab push and tag push)", func(t *testing.T) {
+		code := send("../../tests/gitlab-payload-push.json", "Push Hook", func(map[string]interface{}, map[string]interface{}) {})
+		if code != http.StatusOK || fmt.Sprint(urls) != "[http://el-push:8080]" {
+			t.Fatalf(fmt.Sprintf("Handler %s routed the push incorrectly - got (%d %v)", "TenantWebhookHandler", code, urls))
+		}
+		b := bindings[0]
+		if b.RepoName != "diaspora" || b.RepoUrl != "https://gitlab.example.com/mike/diaspora.git" || b.RepoHash != "da1560886d4f094c3e6c9ef40349f7d38b5d27d7" ||
+			b.Branch != "master" || b.ActorName != "jsmith" || b.Message != "fixed readme" || b.ActorEmail != "gitlabdev@dv6700.(none)" || b.DeliveryID != "gl-1-push" {
+			t.Errorf(fmt.Sprintf("Handler %s posted an incorrect push binding - got (%+v)", "TenantWebhookHandler", b))
+		}
+		send("../../tests/gitlab-payload-push.json", "Tag Push Hook", func(payload map[string]interface{}, _ map[string]interface{}) {
+			payload["object_kind"], payload["ref"] = "tag_push", "refs/tags/v1.2.0"
+		})
+		if fmt.Sprint(urls) != "[http://el-tag:8080]" || bindings[0].TagVersion != "v1.2.0" {
+			t.Errorf(fmt.Sprintf("Handler %s routed the tag push incorrectly - got (%v %v)", "TenantWebhookHandler", urls, bindings))
+		}
+		// a deleted branch has a zero after sha
+		send("../../tests/gitlab-payload-push.json", "Push Hook", func(payload map[string]interface{}, _ map[string]interface{}) {
+			payload["after"] = "0000000000000000000000000000000000000000"
+		})
+		if len(urls) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s routed a deleted branch - got (%v)", "TenantWebhookHandler", urls))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should pass (gitlab merge request actions)", func(t *testing.T) {
+		send("../../tests/gitlab-payload-mr.json", "Merge Request Hook", func(map[string]interface{}, map[string]interface{}) {})
+		if fmt.Sprint(urls) != "[http://el-pr:8080]" || bindings[0].RepoName != "gitlab-test" || bindings[0].RepoHash != "da1560886d4f094c3e6c9ef40349f7d38b5d27d7" ||
+			bindings[0].ActorName != "root" || bindings[0].Message != "MS-Viewport" || fmt.Sprint(bindings[0].Labels) != "[API]" {
+			t.Errorf(fmt.Sprintf("Handler %s routed the opened merge request incorrectly - got (%v %+v)", "TenantWebhookHandler", urls, bindings))
+		}
+		send("../../tests/gitlab-payload-mr.json", "Merge Request Hook", func(_ map[string]interface{}, attributes map[string]interface{}) {
+			attributes["action"], attributes["oldrev"] = "update", "95790bf891e76fee5e1747ab589903a6a1f80f22"
+		})
+		if fmt.Sprint(urls) != "[http://el-pr:8080]" {
+			t.Errorf(fmt.Sprintf("Handler %s routed the updated merge request incorrectly - got (%v)", "TenantWebhookHandler", urls))
+		}
+		send("../../tests/gitlab-payload-mr.json", "Merge Request Hook", func(payload map[string]interface{}, attributes map[string]interface{}) {
+			attributes["action"] = "update"
+			payload["changes"] = map[string]interface{}{"labels": map[string]interface{}{
+				"previous": []interface{}{map[string]interface{}{"id": 206, "title": "API"}},
+				"current":  []interface{}{map[string]interface{}{"id": 206, "title": "API"}, map[string]interface{}{"id": 207, "title": "run-e2e"}},
+			}}
+		})
+		if fmt.Sprint(urls) != "[http://el-e2e:8080]" {
+			t.Errorf(fmt.Sprintf("Handler %s routed the labeled merge request incorrectly - got (%v)", "TenantWebhookHandler", urls))
+		}
+		send("../../tests/gitlab-payload-mr.json", "Merge Request Hook", func(_ map[string]interface{}, attributes map[string]interface{}) {
+			attributes["action"], attributes["state"], attributes["merge_commit_sha"] = "merge", "merged", "9f13d0b2a8e7c6a1c3f1d8f7e5a4b3c2d1e0f9a8"
+		})
+		if fmt.Sprint(urls) != "[http://el-merged:8080]" || bindings[0].RepoHash != "9f13d0b2a8e7c6a1c3f1d8f7e5a4b3c2d1e0f9a8" {
+			t.Errorf(fmt.Sprintf("Handler %s routed the merged merge request incorrectly - got (%v %v)", "TenantWebhookHandler", urls, bindings))
+		}
+		send("../../tests/gitlab-payload-mr.json", "Merge Request Hook", func(_ map[string]interface{}, attributes map[string]interface{}) {
+			attributes["action"] = "approved"
+		})
+		if fmt.Sprint(urls) != "[http://el-approved:8080]" {
+			t.Errorf(fmt.Sprintf("Handler %s routed the approved merge request incorrectly - got (%v)", "TenantWebhookHandler", urls))
+		}
+		// a merge request from another project is a fork
+		send("../../tests/gitlab-payload-mr.json", "Merge Request Hook", func(_ map[string]interface{}, attributes map[string]interface{}) {
+			attributes["source"].(map[string]interface{})["path_with_namespace"] = "awesome_space/gitlab-test"
+		})
+		if len(urls) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s routed a fork merge request without ok-to-test - got (%v)", "TenantWebhookHandler", urls))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should fail (gitlab token)", func(t *testing.T) {
+		data, _ := ioutil.ReadFile("../../tests/gitlab-payload-push.json")
+		rr := PostTenant(conn, reg, "team-g", data, map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "wrong"})
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf(fmt.Sprintf("Handler %s returned wrong status code - got (%d) wanted (%d)", "TenantWebhookHandler", rr.Code, http.StatusUnauthorized))
+		}
+	})
+
+	t.Run("gitlabSchema : should pass (notes, releases and other hooks)", func(t *testing.T) {
+		note := `{"object_kind":"note","user":{"username":"jsmith"},"project":{"path_with_namespace":"gitlabhq/gitlab-test"},
+			"object_attributes":{"id":1244,"note":"/retest","noteable_type":"MergeRequest"},"merge_request":{"iid":1,"title":"MS-Viewport"}}`
+		git, err := gitlabSchema([]byte(note))
+		if err != nil || gitlabEventType("Note Hook", git) != "issue_comment" || git.Action != "created" || git.Issue.PullRequest == nil ||
+			git.Issue.Number != 1 || git.Comment.ID != 1244 || git.Comment.Body != "/retest" || git.Comment.User.Login != "jsmith" {
+			t.Errorf(fmt.Sprintf("Handler %s normalised the note incorrectly - got (%v %+v)", "gitlabSchema", err, git))
+		}
+		release := `{"object_kind":"release","action":"create","tag":"v1.0.0","name":"v1.0.0","description":"first","url":"https://gitlab.example.com/mike/diaspora/-/releases/v1.0.0",
+			"project":{"path_with_namespace":"mike/diaspora"},"commit":{"id":"ee0a3fb31ac16e11b9dbb596ad16d4af654d08f8"}}`
+		git, _ = gitlabSchema([]byte(release))
+		event := &schema.Event{Type: gitlabEventType("Release Hook", git), Git: git}
+		if event.Type != "release" || normaliseAction(event.Type, git) != "released" || git.Release.TargetCommitish != "ee0a3fb31ac16e11b9dbb596ad16d4af654d08f8" ||
+			git.Repository.Name != "diaspora" || git.Repository.Owner.Login != "mike" || git.Repository.Visibility != "private" {
+			t.Errorf(fmt.Sprintf("Handler %s normalised the release incorrectly - got (%+v)", "gitlabSchema", git.Release))
+		}
+		if gitlabEventType("Pipeline Hook", git) != "pipeline" || gitlabEventType("Deployment Hook", git) != "deployment" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect event types", "gitlabEventType"))
+		}
+		if _, err = gitlabSchema([]byte("{")); err == nil || !strings.Contains(err.Error(), "unexpected end") {
+			t.Errorf(fmt.Sprintf("Handler %s returned no error - got (%v)", "gitlabSchema", err))
+		}
+	})
+}
+
+func TestGitLabForge(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var urls, statuses, diffs []string
+
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		switch {
+		case strings.HasPrefix(r.URL.String(), "https://gitlab.example.com/api/v4/projects/gitlabhq%2Fgitlab-test/merge_requests/1/diffs"):
+			diffs = append(diffs, r.URL.RawQuery)
+			if r.URL.Query().Get("page") == "1" {
+				return NewTestResponse(200, `[{"old_path":"docs/README.md","new_path":"docs/index.md","renamed_file":true}]`)
+			}
+			return NewTestResponse(200, "[]")
+		case strings.HasPrefix(r.URL.String(), "https://gitlab.example.com/api/v4/projects/gitlabhq%2Fgitlab-test/statuses/"):
+			statuses = append(statuses, r.URL.String())
+			return NewTestResponse(201, "{}")
+		}
+		urls = append(urls, r.URL.String())
+		return nil
+	})
+	reg := NewRegistry(&config.Config{Tenants: []config.Tenant{{
+		Name:      "team-gf",
+		Secret:    "gl-token",
+		Providers: []string{"gitlab"},
+		Forges:    []config.Forge{{Provider: "gitlab", APIURL: "https://gitlab.example.com/api/v4", Token: "glpat"}},
+		Routes: []config.Route{
+			{Name: "docs", Event: "pull_request", Actions: []string{"opened"}, URL: "http://el-docs:8080", IncludePaths: []string{"docs/**"}},
+			{Name: "api", Event: "pull_request", Actions: []string{"opened"}, URL: "http://el-api:8080", IncludePaths: []string{"api/**"}},
+		},
+	}}})
+
+	t.Run("TenantWebhookHandler : should pass (gitlab forge statuses and merge request diffs)", func(t *testing.T) {
+		data, _ := ioutil.ReadFile("../../tests/gitlab-payload-mr.json")
+		rr := PostTenant(conn, reg, "team-gf", data, map[string]string{"X-Gitlab-Event": "Merge Request Hook", "X-Gitlab-Token": "gl-token"})
+		if rr.Code != http.StatusOK || fmt.Sprint(urls) != "[http://el-docs:8080]" {
+			t.Fatalf(fmt.Sprintf("Handler %s routed the merge request incorrectly - got (%d %v)", "TenantWebhookHandler", rr.Code, urls))
+		}
+		if len(diffs) != 2 || diffs[0] != "per_page=100&page=1" {
+			t.Errorf(fmt.Sprintf("Handler %s listed the merge request files incorrectly - got (%v)", "TenantWebhookHandler", diffs))
+		}
+		if len(statuses) != 1 || !strings.Contains(statuses[0], "/statuses/da1560886d4f094c3e6c9ef40349f7d38b5d27d7?") || !strings.Contains(statuses[0], "state=pending") {
+			t.Errorf(fmt.Sprintf("Handler %s reported incorrect gitlab statuses - got (%v)", "TenantWebhookHandler", statuses))
+		}
+	})
+}
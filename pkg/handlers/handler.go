@@ -2,19 +2,26 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 
+	"github.com/gorilla/mux"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/cloudevents"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
 	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/forge"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/payload"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/policy"
 	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/sinks"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
 )
 
 const (
@@ -23,18 +30,69 @@ const (
 	ERRMSG          string = "{\"status\":\"KO\", \"statuscode\":\"500\",\"message\":\""
 )
 
+// WebhookHandler - legacy single tenant endpoint, routes are built from the envars
 func WebhookHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	processWebhook(w, r, con, config.FromEnv())
+}
+
+// TenantWebhookHandler - multi tenant endpoint, the tenant is taken from the url path
+func TenantWebhookHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients, reg *Registry) {
+	name := mux.Vars(r)["tenant"]
+	ts := reg.lookup(name)
+	if ts == nil {
+		con.Info("TenantWebhookHandler unknown tenant %s", name)
+		response(w, http.StatusNotFound, "Unknown tenant "+name)
+		return
+	}
+	if !ts.allow() {
+		con.Info("TenantWebhookHandler rate limit exceeded for tenant %s", name)
+		response(w, http.StatusTooManyRequests, "Rate limit exceeded for tenant "+name)
+		return
+	}
+	if !ts.acquire() {
+		con.Info("TenantWebhookHandler too many deliveries in flight for tenant %s", name)
+		response(w, http.StatusTooManyRequests, "Too many deliveries in flight for tenant "+name)
+		return
+	}
+	defer ts.release()
+	processWebhook(w, r, con, ts.tenant)
+}
+
+// processWebhook - private function, verifies, parses and routes the webhook for the given tenant
+func processWebhook(w http.ResponseWriter, r *http.Request, con connectors.Clients, tenant *config.Tenant) {
 	var git *schema.GitSchema
-	var mapping *schema.MapBinding
-	var eventListenerUrl string
 	var payload string
 
 	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		con.Error("WebhookHandler could not read body data %v", err)
+		resp := ERRMSG + fmt.Sprintf("\"WebhookHandler could not read body data %v", err) + "\"}"
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "%s", resp)
+		return
+	}
+
+	provider := detectProvider(r)
+	if !tenant.AllowsProvider(provider) {
+		con.Info("WebhookHandler provider %s is not enabled for tenant %s", provider, tenant.Name)
+		response(w, http.StatusForbidden, "Provider "+provider+" is not enabled")
+		return
+	}
+
+	if tenant.Secret != "" {
+		if err = verifySignature(r, body, tenant.Secret); err != nil {
+			con.Error("WebhookHandler signature verification failed for tenant %s %v", tenant.Name, err)
+			response(w, http.StatusUnauthorized, "Signature verification failed")
+			return
+		}
+	}
+
 	if strings.Contains(string(body), "payload=") {
 		formatted := strings.Split(string(body), "=")[1]
 		payload, err = url.QueryUnescape(formatted)
 		if err != nil {
-			log.Fatal(err)
+			con.Error("WebhookHandler could not decode form payload %v", err)
+			response(w, http.StatusInternalServerError, fmt.Sprintf("WebhookHandler could not decode form payload %v", err))
 			return
 		}
 	} else {
@@ -42,15 +100,12 @@ func WebhookHandler(w http.ResponseWriter, r *http.Request, con connectors.Clien
 	}
 
 	con.Trace("Input data %s", payload)
-	if err != nil {
-		con.Error("WebhookHandler could not read body data %v", err)
-		resp := ERRMSG + fmt.Sprintf("\"WebhookHandler could not read body data %v", err) + "\"}"
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "%s", resp)
-		return
-	}
 
-	err = json.Unmarshal([]byte(payload), &git)
+	if provider == "gitlab" {
+		git, err = gitlabSchema([]byte(payload))
+	} else {
+		err = json.Unmarshal([]byte(payload), &git)
+	}
 	if err != nil {
 		con.Error("WebhookHandler could not unmarshal to struct %v", err)
 		resp := ERRMSG + fmt.Sprintf("\"WebhookHandler could not unmarshal struct %v", err) + "\"}"
@@ -61,81 +116,347 @@ func WebhookHandler(w http.ResponseWriter, r *http.Request, con connectors.Clien
 
 	con.Debug("Mapping struct %v", git)
 
-	postRequest := false
+	event := newEvent(r, provider, git)
+	event.Payload = []byte(payload)
+	event.Body, event.Header = body, r.Header.Clone()
+	if event.Action == "rerequested" && (event.Type == "check_run" || event.Type == "check_suite") {
+		rerunDeliveries(w, con, tenant, event)
+		return
+	}
+
+	undo := func() {}
+	if event.Type == "release" {
+		event.Action, undo = releaseTransition(tenant, event)
+	}
+	if event.Type == "pull_request" && event.Action == "closed" {
+		// the closing event itself is still held (or trusted) as before
+		defer forgetPullRequest(tenant, event)
+	}
+	if user, held := heldBy(tenant, event); held {
+		con.Info("WebhookHandler pull request held by %s, delivery skipped", user)
+		response(w, http.StatusOK, "Pull request is held by "+user+", use /unhold to resume")
+		return
+	}
+	if err = checkPolicy(tenant, event); err != nil {
+		con.Info("WebhookHandler %v, delivery skipped", err)
+		undo()
+		if err == policy.ErrNotTrusted {
+			response(w, http.StatusOK, "Fork pull request is waiting for /ok-to-test")
+			return
+		}
+		n := newNotification(tenant, config.POLICYBLOCKED, event, nil)
+		n.Reason = err.Error()
+		sendNotification(con, tenant, n)
+		response(w, http.StatusForbidden, "Denied by policy, "+err.Error())
+		return
+	}
+	// commands run once the actor policy allows the commenter
+	if event.Type == "issue_comment" {
+		handleComment(w, con, tenant, event)
+		return
+	}
+
+	mapping := newMapBinding(event)
+	unmapped := mapping == nil
+	if unmapped {
+		// other event types can only be passed through
+		mapping = &schema.MapBinding{RepoUrl: git.Repository.CloneURL, RepoName: git.Repository.Name, ActorName: git.Sender.Login}
+	}
+	if mapping.TagVersion != "" {
+		tagEnvironment(tenant, mapping)
+	}
+	posted := 0
+	var held, frozenRoutes, queued, skipped, runs []string
+	frozenCode := 0
+	resolved := false
+	retest := okToTest(tenant, event)
+	if retest {
+		// later events of the same head commit (another label, a redelivery) stay trusted
+		trusted.Hold(trustKey(tenant, git), git.Sender.Login)
+	}
+	// the changed files are read before anything is posted so that a failure can be redelivered
+	var files []string
+	filtered := false
+	if filtersPaths(tenant, event, retest) {
+		if files, filtered, err = changedFiles(con, tenant, event); err != nil {
+			con.Error("WebhookHandler %v", err)
+			response(w, http.StatusBadGateway, err.Error())
+			return
+		}
+	}
 	// post to the various eventlisteners
-	if len(os.Getenv("PR_OPENED_URL")) > 0 && git.Action == "opened" {
-		// post to the pr_opened eventlistener
-		mapping = &schema.MapBinding{
-			RepoUrl:   git.Repository.CloneURL,
-			RepoName:  git.Repository.Name,
-			RepoHash:  git.PullRequest.Head.Sha,
-			ActorName: git.PullRequest.User.Login,
-			Message:   git.PullRequest.Title,
-		}
-		postRequest = true
-		eventListenerUrl = os.Getenv("PR_OPENED_URL")
-	}
-
-	if len(os.Getenv("PR_MERGED_URL")) > 0 && git.Action == "closed" {
-		// only post on merged true
-		if git.PullRequest.Merged {
-			// post to the pr+merged eventlistener
-			mapping = &schema.MapBinding{
-				RepoUrl:   git.Repository.CloneURL,
-				RepoName:  git.Repository.Name,
-				RepoHash:  git.PullRequest.MergeCommitSha,
-				ActorName: git.PullRequest.User.Login,
-				Message:   git.PullRequest.Title,
-			}
-			postRequest = true
-			eventListenerUrl = os.Getenv("PR_MERGED_URL")
-		}
-	}
-
-	if (len(os.Getenv("PRERELEASED_URL")) > 0 || len(os.Getenv("RELEASED_URL")) > 0) && git.Action == "published" {
-		// check for the prerelease field
-		if git.Release.Prerelease {
-			// post to the pre_release eventlistener
-			mapping = &schema.MapBinding{
-				RepoUrl:    git.Repository.CloneURL,
-				RepoName:   git.Repository.Name,
-				RepoHash:   git.Release.TargetCommitish,
-				ActorName:  git.Release.Author.Login,
-				Message:    git.Release.Name + " " + git.Release.Body,
-				TagVersion: git.Release.TagName,
+	for x := range tenant.Routes {
+		route := &tenant.Routes[x]
+		if !(route.Matches(event.Type, event.Action) || (retest && route.Matches(event.Type, "opened"))) {
+			continue
+		}
+		if unmapped && !route.Passthrough {
+			continue
+		}
+		if route.SkipDraft && isPullRequest(event.Type) && git.PullRequest.Draft {
+			con.Info("WebhookHandler draft pull request %d skipped for route %s", git.PullRequest.Number, route.Name)
+			continue
+		}
+		if route.Environment != "" && route.Environment != mapping.Environment {
+			continue
+		}
+		if isPullRequest(event.Type) && !route.MatchesLabels(routeLabels(event)) {
+			con.Debug("WebhookHandler pull request %d labels do not match route %s", git.PullRequest.Number, route.Name)
+			continue
+		}
+		if filtered && !route.MatchesPaths(files) {
+			con.Info("WebhookHandler no changed path matches route %s, skipped", route.Name)
+			continue
+		}
+		if reason := skipReason(route, event); reason != "" {
+			con.Info("WebhookHandler route %s skipped, %s", route.Name, reason)
+			skipped = append(skipped, route.Name+" skipped, "+reason)
+			continue
+		}
+		// the release commit is only looked up once a route needs it
+		if !resolved && event.Type == "release" {
+			if err = resolveRelease(con, tenant, event, mapping); err != nil {
+				con.Error("WebhookHandler %v", err)
+				undo()
+				response(w, http.StatusBadGateway, err.Error())
+				return
 			}
-			postRequest = true
-			eventListenerUrl = os.Getenv("PRERELEASED_URL")
-		} else {
-			// post to release eventlistener
-			mapping = &schema.MapBinding{
-				RepoUrl:    git.Repository.CloneURL,
-				RepoName:   git.Repository.Name,
-				RepoHash:   git.Release.TargetCommitish,
-				ActorName:  git.Release.Author.Login,
-				Message:    git.Release.Name + " " + git.Release.Body,
-				TagVersion: git.Release.TagName,
+			resolved = true
+		}
+		if reason, ok := checkApproval(con, tenant, event, route); !ok {
+			held = append(held, holdForApproval(con, tenant, event, route, mapping, reason, undo).ID)
+			continue
+		}
+		if msg, code := freezeGate(con, tenant, event, route, mapping); code != 0 {
+			frozenRoutes = append(frozenRoutes, msg)
+			if code > frozenCode {
+				frozenCode = code
 			}
-			postRequest = true
-			eventListenerUrl = os.Getenv("RELEASED_URL")
+			continue
 		}
-	}
-
-	if postRequest {
-		_, err = makePostRequest(eventListenerUrl, APPLICATIONJSON, mapping, con)
+		if msg, ok := debounce(con, tenant, event, route, mapping); ok {
+			queued = append(queued, msg)
+			continue
+		}
+		run, err := deliver(con, tenant, event, route, mapping)
 		if err != nil {
+			if posted == 0 {
+				undo()
+			}
 			resp := ERRMSG + fmt.Sprintf("\"Request failed %v", err) + "\"}"
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, "%s", resp)
 			return
 		}
+		if run != "" {
+			runs = append(runs, run)
+		}
+		posted++
+	}
+
+	if posted > 0 && len(runs) > 0 {
+		con.Debug("Result struct for git webhook %v", mapping)
+		response(w, http.StatusOK, "Request sent successfully, created "+strings.Join(runs, ","))
+	} else if posted > 0 {
 		resp := "{\"status\":\"OK\", \"statuscode\":\"200\",\"message\":\"Request sent successfully\"}"
 		w.WriteHeader(http.StatusOK)
 		con.Debug("Result struct for git webhook %v", mapping)
 		fmt.Fprintf(w, "%s", string(resp))
+	} else if len(held) > 0 {
+		response(w, http.StatusAccepted, "Held for approval "+strings.Join(held, ","))
+	} else if len(queued) > 0 {
+		response(w, http.StatusAccepted, "Debounced, "+strings.Join(queued, "; "))
+	} else if len(frozenRoutes) > 0 {
+		if frozenCode == http.StatusLocked {
+			// rejected, a redelivery after the freeze is routed again
+			undo()
+		}
+		response(w, frozenCode, strings.Join(frozenRoutes, "; "))
+	} else if len(skipped) > 0 {
+		response(w, http.StatusOK, "Skipped, "+strings.Join(skipped, "; "))
 	} else {
-		con.Info("NOP (opened,merged,release or prerelease action not detected)")
+		con.Info("NOP (no route for %s %s)", event.Type, event.Action)
+	}
+}
+
+// deliver - private function, posts the binding (as a CloudEvent, the rendered route template or the webhook itself
+// for passthrough routes) to the route eventlistener, or creates the run of a tekton route
+// the delivery is recorded for callbacks and re-runs, its state reported to the forge and failures
+// (and forwarded releases) sent to the tenant notifiers
+// the name of the created run is returned (empty for other routes)
+func deliver(con connectors.Clients, tenant *config.Tenant, event *schema.Event, route *config.Route, mapping *schema.MapBinding) (string, error) {
+	delivery, err := attemptDelivery(con, tenant, event, route, mapping)
+	if err != nil {
+		if delivery != nil {
+			reportFailure(con, tenant, event, route, delivery, err.Error())
+		}
+		return "", err
+	}
+	return delivery.Run, nil
+}
+
+// reportFailure - private function, reports the failed delivery to the forge and the tenant notifiers
+func reportFailure(con connectors.Clients, tenant *config.Tenant, event *schema.Event, route *config.Route, delivery *store.Delivery, reason string) {
+	notifyForge(con, tenant, delivery, forge.ERROR, "Delivery to the eventlistener failed")
+	n := newNotification(tenant, config.DELIVERYFAILED, event, delivery.Binding)
+	n.Route, n.DeliveryID, n.Reason = route.Name, delivery.ID, reason
+	sendNotification(con, tenant, n)
+}
+
+// attemptDelivery - private function, records and sends the delivery, failures are returned unreported
+// (with the recorded delivery, nil when the route could not be rendered)
+func attemptDelivery(con connectors.Clients, tenant *config.Tenant, event *schema.Event, route *config.Route, mapping *schema.MapBinding) (*store.Delivery, error) {
+	binding := *mapping
+	binding.DeliveryID = event.DeliveryID + "-" + route.Name
+	var body []byte
+	var headers map[string]string
+	if route.Tekton != nil {
+		var err error
+		if body, err = renderRun(tenant, event, route, &binding); err != nil {
+			con.Error("Function deliver route %s run %v", route.Name, err)
+			return nil, fmt.Errorf("route %s run %v", route.Name, err)
+		}
+	} else if route.Passthrough {
+		body, headers = event.Body, make(map[string]string)
+		for _, h := range route.Headers() {
+			if v := event.Header.Get(h); v != "" {
+				headers[h] = v
+			}
+		}
+	} else if route.CloudEvents != "" {
+		var err error
+		body, headers, err = cloudevents.Encode(route.CloudEvents, cloudevents.New(binding.DeliveryID, binding.RepoUrl, event.Type, event.Action, eventSubject(event, &binding), &binding))
+		if err != nil {
+			con.Error("Function deliver route %s %v", route.Name, err)
+			return nil, err
+		}
+	} else if route.Template != nil {
+		t, err := payload.Parse(route.Template)
+		if err == nil {
+			body, headers, err = t.Render(payload.NewData(tenant.Name, route.Name, event, &binding))
+		}
+		if err != nil {
+			con.Error("Function deliver route %s template %v", route.Name, err)
+			return nil, fmt.Errorf("route %s template %v", route.Name, err)
+		}
+	}
+	delivery := recordDelivery(tenant, event, route, &binding, body, headers)
+	if route.Sink != nil {
+		sink, err := renderSink(tenant, event, route, &binding)
+		if err != nil {
+			con.Error("Function deliver route %s sink %v", route.Name, err)
+			return nil, fmt.Errorf("route %s sink %v", route.Name, err)
+		}
+		delivery.Sink = sink
+		deliveries.Put(delivery)
 	}
+	if route.Tekton != nil {
+		delivery.Tekton = route.Tekton
+		deliveries.Put(delivery)
+	}
+	ctx, cancel := tenantContext(tenant)
+	err := send(ctx, con, delivery)
+	cancel()
+	if err != nil {
+		return delivery, err
+	}
+	notifyForge(con, tenant, delivery, forge.PENDING, "Pipeline triggered")
+	if event.Type == "release" && binding.TagVersion != "" {
+		n := newNotification(tenant, config.RELEASEFORWARDED, event, &binding)
+		n.Route, n.DeliveryID = route.Name, delivery.ID
+		sendNotification(con, tenant, n)
+	}
+	return delivery, nil
+}
+
+// send - private function, posts a recorded delivery, the rendered body when there is one or else the binding
+// deliveries with a sink are published to the broker and tekton deliveries create their run instead
+func send(ctx context.Context, con connectors.Clients, delivery *store.Delivery) error {
+	if delivery.Sink != nil {
+		return publish(ctx, con, delivery)
+	}
+	if delivery.Tekton != nil {
+		return createRun(ctx, con, delivery)
+	}
+	if len(delivery.Body) == 0 {
+		_, err := makePostRequest(ctx, delivery.URL, APPLICATIONJSON, delivery.Binding, con)
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", delivery.URL, bytes.NewBuffer(delivery.Body))
+	if err != nil {
+		con.Error("Function send http request %v", err)
+		return err
+	}
+	con.Debug("Post data to eventListenerUrl : %s", string(delivery.Body))
+	for k, v := range delivery.Headers {
+		req.Header.Set(k, v)
+	}
+	con.Info("Function send %s", delivery.URL)
+	resp, err := con.Do(req)
+	if err != nil {
+		con.Error("Function send http request %v", err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > http.StatusAccepted {
+		con.Error("Function send response code %v", resp.StatusCode)
+		return errors.New(strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
+
+// renderSink - private function, the route sink with its templates (subject, key, repository, ref and params) executed
+// the key and repository default to the event repository and the ref to the event branch or tag
+func renderSink(tenant *config.Tenant, event *schema.Event, route *config.Route, binding *schema.MapBinding) (*config.Sink, error) {
+	sink := *route.Sink
+	data := payload.NewData(tenant.Name, route.Name, event, binding)
+	var err error
+	for _, text := range []*string{&sink.Subject, &sink.Key, &sink.Repository, &sink.Ref} {
+		if *text, err = payload.Expand(*text, data); err != nil {
+			return nil, err
+		}
+	}
+	if sink.Key == "" {
+		sink.Key = event.Git.Repository.FullName
+	}
+	if sink.Repository == "" {
+		sink.Repository = event.Git.Repository.FullName
+	}
+	if sink.Ref == "" {
+		sink.Ref = eventRef(event, binding)
+	}
+	if len(route.Sink.Params) > 0 {
+		sink.Params = make(map[string]string)
+		for name, text := range route.Sink.Params {
+			if sink.Params[name], err = payload.Expand(text, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &sink, nil
+}
+
+// publish - private function, publishes a recorded delivery to its sink, the binding is published as json
+// when there is no rendered body, an error is returned until the broker acknowledged the message
+func publish(ctx context.Context, con connectors.Clients, delivery *store.Delivery) error {
+	sink, err := sinks.New(delivery.URL, delivery.Sink, con)
+	if err != nil {
+		con.Error("Function publish %v", err)
+		return err
+	}
+	msg := &sinks.Message{ID: delivery.ID, Subject: delivery.Sink.Subject, Key: delivery.Sink.Key, Body: delivery.Body, Headers: delivery.Headers}
+	if len(msg.Body) == 0 {
+		msg.Body, _ = json.Marshal(delivery.Binding)
+		msg.Headers = map[string]string{CONTENTTYPE: APPLICATIONJSON}
+	}
+	con.Debug("Publish data to %s sink : %s", delivery.Sink.Type, string(msg.Body))
+	ack, err := sink.Publish(ctx, msg)
+	if err != nil {
+		con.Error("Function publish %s %v", delivery.ID, err)
+		return err
+	}
+	con.Info("Function publish %s acknowledged, %s", delivery.ID, ack)
+	return nil
 }
 
 func IsAlive(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
@@ -144,11 +465,15 @@ func IsAlive(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
 }
 
 // makePostRequest - private utility function for POST
-func makePostRequest(elUrl string, contentType string, mb *schema.MapBinding, con connectors.Clients) ([]byte, error) {
+func makePostRequest(ctx context.Context, elUrl string, contentType string, mb *schema.MapBinding, con connectors.Clients) ([]byte, error) {
 	var b []byte
 
 	data, _ := json.MarshalIndent(mb, "", "    ")
-	req, _ := http.NewRequest("POST", elUrl, bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(ctx, "POST", elUrl, bytes.NewBuffer(data))
+	if err != nil {
+		con.Error("Function makePostRequest http request %v", err)
+		return b, err
+	}
 	con.Debug("Post data to eventListenerUrl : %s", string(data))
 	req.Header.Set(CONTENTTYPE, contentType)
 	con.Info("Function makeRequest %s", elUrl)
@@ -165,3 +490,15 @@ func makePostRequest(elUrl string, contentType string, mb *schema.MapBinding, co
 	con.Error("Function makePostRequest response code %v", resp.StatusCode)
 	return []byte("ko"), errors.New(strconv.Itoa(resp.StatusCode))
 }
+
+// response - private utility function, writes the standard status json
+func response(w http.ResponseWriter, code int, msg string) {
+	status := "OK"
+	if code >= http.StatusBadRequest {
+		status = "KO"
+	}
+	message, _ := json.Marshal(msg)
+	w.Header().Set(CONTENTTYPE, APPLICATIONJSON)
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "{\"status\":\"%s\", \"statuscode\":\"%d\",\"message\":%s}", status, code, string(message))
+}
@@ -199,4 +199,41 @@ func TestHandlers(t *testing.T) {
 		}
 	})
 
+	t.Run("WebhookHandler : should fail (invalid eventlistener url)", func(t *testing.T) {
+		os.Setenv("PR_MERGED_URL", "http://el-pr-merged\x7f:8080")
+		defer os.Setenv("PR_MERGED_URL", "loclahost")
+		requestPayload, _ := ioutil.ReadFile("../../tests/git-payload-pr-merged.json")
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/service", bytes.NewBuffer([]byte(requestPayload)))
+		conn := NewTestConnectors("../../tests/response.json", 200, "true", logger)
+		WebhookHandler(rr, req, conn)
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "WebhookHandler", rr.Code, http.StatusInternalServerError))
+		}
+	})
+
+	t.Run("WebhookHandler : should fail (provider not enabled)", func(t *testing.T) {
+		var STATUS int = 403
+
+		os.Setenv("PROVIDERS", "github")
+		requestPayload, _ := ioutil.ReadFile("../../tests/prod-release.json")
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/service", bytes.NewBuffer([]byte(requestPayload)))
+		req.Header.Set("X-Gitea-Event", "release")
+		conn := NewTestConnectors("../../tests/response.json", STATUS, "none", logger)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			WebhookHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		os.Setenv("PROVIDERS", "")
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "WebhookHandler ", rr.Code, STATUS))
+		}
+	})
+
 }
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/notify"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+)
+
+// NOTIFYTIMEOUT - bounds each notifier send, the tenant timeout applies when it is shorter
+const NOTIFYTIMEOUT time.Duration = 10 * time.Second
+
+// MAXNOTIFYING - the notifier sends in flight per tenant, more are dropped (logged and counted) until one ends
+const MAXNOTIFYING int = 64
+
+// notifyTimeout and notifying - the send timeout and the sends in flight (tests wait for them)
+var notifyTimeout = NOTIFYTIMEOUT
+var notifying sync.WaitGroup
+
+// notifySlots and notifyDropped - the send slots of each tenant and the notifications each tenant dropped
+var notifyMutex sync.Mutex
+var notifySlots = map[string]chan struct{}{}
+var notifyDropped = map[string]int{}
+
+// notifySlot - private function, takes a send slot of the tenant, nil and the drops so far when all are in use
+// the slots are per tenant so a tenant with stalled notifiers never drops the notifications of the others
+func notifySlot(tenant string) (chan struct{}, int) {
+	notifyMutex.Lock()
+	defer notifyMutex.Unlock()
+	slots, ok := notifySlots[tenant]
+	if !ok {
+		slots = make(chan struct{}, MAXNOTIFYING)
+		notifySlots[tenant] = slots
+	}
+	select {
+	case slots <- struct{}{}:
+		return slots, notifyDropped[tenant]
+	default:
+		notifyDropped[tenant]++
+		return nil, notifyDropped[tenant]
+	}
+}
+
+// newNotification - private function, the notification of the condition for the event
+// binding is nil when the event was not mapped yet (policy blocks happen before routing)
+func newNotification(tenant *config.Tenant, condition string, event *schema.Event, binding *schema.MapBinding) *notify.Notification {
+	git := event.Git
+	n := &notify.Notification{
+		Condition: condition,
+		Tenant:    tenant.Name,
+		Event:     event.Type,
+		Action:    event.Action,
+		Repo:      git.Repository.FullName,
+		RepoURL:   git.Repository.HTMLURL,
+		Actor:     git.Sender.Login,
+		Sha:       git.PullRequest.Head.Sha,
+	}
+	if n.Sha == "" {
+		n.Sha = git.After
+	}
+	if binding != nil {
+		n.Tag, n.Branch, n.Environment = binding.TagVersion, binding.Branch, binding.Environment
+		if binding.ActorName != "" {
+			n.Actor = binding.ActorName
+		}
+		if binding.RepoHash != "" {
+			n.Sha = binding.RepoHash
+		}
+	}
+	for _, link := range []string{git.Release.HTMLURL, git.PullRequest.HTMLURL, git.Repository.HTMLURL} {
+		if link != "" {
+			n.Link = link
+			break
+		}
+	}
+	return n
+}
+
+// sendNotification - private function, sends the notification to the tenant notifiers configured for its condition
+// each notifier is sent to in the background with a bounded timeout, so a slow endpoint never delays the webhook;
+// failures are logged only, like forge statuses notifications never change the webhook response
+func sendNotification(con connectors.Clients, tenant *config.Tenant, n *notify.Notification) {
+	for x := range tenant.Notifiers {
+		notifier := &tenant.Notifiers[x]
+		if !notifier.Notifies(n.Condition, n.Environment) {
+			continue
+		}
+		t, err := notify.Parse(notifier)
+		if err != nil {
+			con.Error("Function sendNotification notifier %s template %v", notifier.Name, err)
+			continue
+		}
+		title, text, err := notify.Render(t, n)
+		if err != nil {
+			con.Error("Function sendNotification notifier %s template %v", notifier.Name, err)
+			continue
+		}
+		sender, err := notify.New(notifier, con)
+		if err != nil {
+			con.Error("Function sendNotification notifier %s %v", notifier.Name, err)
+			continue
+		}
+		slots, dropped := notifySlot(tenant.Name)
+		if slots == nil {
+			con.Error("Function sendNotification notifier %s dropped %s for tenant %s, %d sends in flight (%d dropped)", notifier.Name, n.Condition, tenant.Name, MAXNOTIFYING, dropped)
+			continue
+		}
+		timeout := notifyTimeout
+		if tenant.Timeout > 0 && time.Duration(tenant.Timeout)*time.Second < timeout {
+			timeout = time.Duration(tenant.Timeout) * time.Second
+		}
+		notifying.Add(1)
+		go func(name string, sender notify.Notifier, title string, text string) {
+			defer func() {
+				<-slots
+				notifying.Done()
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := sender.Send(ctx, n, title, text); err != nil {
+				con.Error("Function sendNotification notifier %s could not send %s %v", name, n.Condition, err)
+				return
+			}
+			con.Info("Function sendNotification %s sent to %s", n.Condition, name)
+		}(notifier.Name, sender, title, text)
+	}
+}
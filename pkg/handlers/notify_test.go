@@ -0,0 +1,134 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/notify"
+	"github.com/microlib/simple"
+)
+
+func TestNotifications(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var notified []map[string]string
+	var mutex sync.Mutex
+	code := 503
+
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		if r.URL.String() == "https://hooks.example.com/blocked" {
+			// a stalled endpoint answers only once the send timed out
+			<-r.Context().Done()
+			return NewTestResponse(504, "timeout")
+		}
+		if strings.HasPrefix(r.URL.String(), "https://hooks.example.com/") {
+			var msg map[string]string
+			json.Unmarshal(body, &msg)
+			msg["url"] = r.URL.String()
+			mutex.Lock()
+			notified = append(notified, msg)
+			mutex.Unlock()
+			return NewTestResponse(200, "ok")
+		}
+		return NewTestResponse(code, "{}")
+	})
+	reg := NewRegistry(&config.Config{Tenants: []config.Tenant{{Name: "team-n",
+		Routes: []config.Route{{Name: "pr-opened", Event: "pull_request", Actions: []string{"opened"}, URL: "http://el-pr-opened:8080"}},
+		Policy: &config.Policy{DenySenders: []string{"*[bot]"}},
+		Notifiers: []config.Notifier{
+			{Name: "chat", Type: "slack", URL: "https://hooks.example.com/slack"},
+			{Name: "audit", Type: "webhook", URL: "https://hooks.example.com/audit", On: []string{config.POLICYBLOCKED}},
+		},
+	}}})
+	// post - sends the pull request and waits for the notifications sent in the background
+	post := func(id string, sender string) *httptest.ResponseRecorder {
+		var payload map[string]interface{}
+		data, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+		json.Unmarshal(data, &payload)
+		payload["action"] = "opened"
+		payload["sender"].(map[string]interface{})["login"] = sender
+		data, _ = json.Marshal(payload)
+		notified = nil
+		rr := PostTenant(conn, reg, "team-n", data, map[string]string{"X-GitHub-Event": "pull_request", "X-GitHub-Delivery": id})
+		notifying.Wait()
+		sort.Slice(notified, func(i, j int) bool { return notified[i]["url"] < notified[j]["url"] })
+		return rr
+	}
+
+	t.Run("TenantWebhookHandler : should fail (delivery failure notified)", func(t *testing.T) {
+		rr := post("notify-4901", "lmz")
+		if rr.Code != http.StatusInternalServerError || len(notified) != 1 || notified[0]["url"] != "https://hooks.example.com/slack" ||
+			!strings.HasPrefix(notified[0]["text"], "*Delivery of luigizuccarelli/golang-simple-echoservice pull_request to pr-opened failed*") ||
+			!strings.Contains(notified[0]["text"], "Reason: 503") || !strings.Contains(notified[0]["text"], "Delivery: notify-4901-pr-opened") {
+			t.Errorf(fmt.Sprintf("Handler %s sent incorrect notifications - got (%d %v)", "TenantWebhookHandler", rr.Code, notified))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should pass (no notification when delivered)", func(t *testing.T) {
+		code = 202
+		if rr := post("notify-4902", "lmz"); rr.Code != http.StatusOK || len(notified) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s sent incorrect notifications - got (%d %v)", "TenantWebhookHandler", rr.Code, notified))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should fail (policy block notified)", func(t *testing.T) {
+		rr := post("notify-4903", "dependabot[bot]")
+		if rr.Code != http.StatusForbidden || len(notified) != 2 || notified[0]["url"] != "https://hooks.example.com/audit" ||
+			notified[0]["condition"] != config.POLICYBLOCKED || notified[0]["actor"] != "dependabot[bot]" || notified[0]["reason"] == "" {
+			t.Errorf(fmt.Sprintf("Handler %s sent incorrect notifications - got (%d %v)", "TenantWebhookHandler", rr.Code, notified))
+		}
+	})
+
+	t.Run("sendNotification : should pass (a stalled notifier neither blocks nor delays the others)", func(t *testing.T) {
+		notifyTimeout = 100 * time.Millisecond
+		defer func() { notifyTimeout = NOTIFYTIMEOUT }()
+		tenant := &config.Tenant{Name: "team-n", Notifiers: []config.Notifier{
+			{Name: "stalled", Type: "webhook", URL: "https://hooks.example.com/blocked"},
+			{Name: "chat", Type: "slack", URL: "https://hooks.example.com/slack"},
+		}}
+		n := &notify.Notification{Condition: config.DELIVERYFAILED, Tenant: "team-n", Repo: "luigizuccarelli/golang-simple-echoservice"}
+		notified = nil
+		start := time.Now()
+		sendNotification(conn, tenant, n)
+		returned := time.Since(start)
+		notifying.Wait()
+		if returned >= notifyTimeout || time.Since(start) > 5*notifyTimeout || len(notified) != 1 || notified[0]["url"] != "https://hooks.example.com/slack" {
+			t.Errorf(fmt.Sprintf("Handler %s was held up by a stalled notifier - got (%s %s %v)", "sendNotification", returned, time.Since(start), notified))
+		}
+	})
+
+	t.Run("sendNotification : should pass (a tenant out of slots drops and counts, the others still send)", func(t *testing.T) {
+		full := make(chan struct{}, MAXNOTIFYING)
+		for i := 0; i < MAXNOTIFYING; i++ {
+			full <- struct{}{}
+		}
+		notifyMutex.Lock()
+		notifySlots["team-full"] = full
+		notifyMutex.Unlock()
+		notifiers := []config.Notifier{{Name: "chat", Type: "slack", URL: "https://hooks.example.com/slack"}}
+		n := &notify.Notification{Condition: config.DELIVERYFAILED, Repo: "luigizuccarelli/golang-simple-echoservice"}
+		notified = nil
+		sendNotification(conn, &config.Tenant{Name: "team-full", Notifiers: notifiers}, n)
+		sendNotification(conn, &config.Tenant{Name: "team-full", Notifiers: notifiers}, n)
+		sendNotification(conn, &config.Tenant{Name: "team-n", Notifiers: notifiers}, n)
+		notifying.Wait()
+		notifyMutex.Lock()
+		dropped := notifyDropped["team-full"]
+		notifyMutex.Unlock()
+		if dropped != 2 || len(notified) != 1 {
+			t.Errorf(fmt.Sprintf("Handler %s shared the notifier slots between tenants - got (%d %d) wanted (%d %d)", "sendNotification", dropped, len(notified), 2, 1))
+		}
+	})
+}
@@ -0,0 +1,63 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/microlib/simple"
+)
+
+func TestPassthrough(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var bodies []string
+	var headers []http.Header
+
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		bodies = append(bodies, string(body))
+		headers = append(headers, r.Header)
+		return nil
+	})
+	reg := NewRegistry(&config.Config{Tenants: []config.Tenant{{Name: "team-h", Routes: []config.Route{
+		{Name: "interceptor", Event: "pull_request", Actions: []string{"opened"}, URL: "http://el-github:8080", Passthrough: true},
+		{Name: "issues", Event: "issues", Actions: []string{"*"}, URL: "http://el-issues:8080", Passthrough: true, ForwardHeaders: []string{"X-GitHub-Event"}},
+		{Name: "ignored", Event: "issues", Actions: []string{"*"}, URL: "http://el-summary:8080"},
+	}}}})
+
+	send := func(eventType string, data []byte) {
+		bodies, headers = nil, nil
+		PostTenant(conn, reg, "team-h", data, map[string]string{
+			"X-GitHub-Event":      eventType,
+			"X-GitHub-Delivery":   "pass-4401",
+			"X-Hub-Signature-256": "sha256=0123",
+			"Authorization":       "Bearer secret",
+		})
+	}
+
+	t.Run("TenantWebhookHandler : should pass (original bytes and provider headers)", func(t *testing.T) {
+		data, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+		data = append([]byte("  "), data...)
+		send("pull_request", data)
+		if len(bodies) != 1 || bodies[0] != string(data) {
+			t.Fatalf(fmt.Sprintf("Handler %s did not forward the original body - got (%d)", "TenantWebhookHandler", len(bodies)))
+		}
+		h := headers[0]
+		if h.Get("X-GitHub-Event") != "pull_request" || h.Get("X-GitHub-Delivery") != "pass-4401" || h.Get("X-Hub-Signature-256") != "sha256=0123" || h.Get("Authorization") != "" {
+			t.Errorf(fmt.Sprintf("Handler %s forwarded incorrect headers - got (%v)", "TenantWebhookHandler", h))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should pass (unmapped event types)", func(t *testing.T) {
+		data := []byte(`{"action":"opened","issue":{"number":7},"repository":{"name":"app","full_name":"org/app"},"sender":{"login":"lmz"}}`)
+		send("issues", data)
+		if len(bodies) != 1 || bodies[0] != string(data) || headers[0].Get("X-Hub-Signature-256") != "" {
+			t.Errorf(fmt.Sprintf("Handler %s forwarded incorrectly - got (%v %v)", "TenantWebhookHandler", bodies, headers))
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+)
+
+// MAXPUSHCOMMITS - github lists at most 20 commits in a push event
+const MAXPUSHCOMMITS int = 20
+
+// hasFiles - private utility function, reports whether route path filters apply to the event type
+func hasFiles(eventType string) bool {
+	return eventType == "push" || isPullRequest(eventType)
+}
+
+// filtersPaths - private utility function, reports whether a route matching the event has path filters
+// (retest also matches the pull request opened routes), other events never read the changed files
+func filtersPaths(tenant *config.Tenant, event *schema.Event, retest bool) bool {
+	if !hasFiles(event.Type) {
+		return false
+	}
+	for x := range tenant.Routes {
+		route := &tenant.Routes[x]
+		if route.HasPaths() && (route.Matches(event.Type, event.Action) || (retest && route.Matches(event.Type, "opened"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// changedFiles - private function, the files changed by a push (added, modified and removed in each commit)
+// or by a pull request (read through the forge api), false is returned when they cannot be known
+// (no forge configured, a push of a new branch, a force-push or a truncated commit list) and the routes are then not filtered
+func changedFiles(con connectors.Clients, tenant *config.Tenant, event *schema.Event) ([]string, bool, error) {
+	git := event.Git
+	if event.Type == "push" {
+		if git.Created || git.Forced || len(git.Commits) == 0 || len(git.Commits) >= MAXPUSHCOMMITS {
+			con.Info("Function changedFiles push of %d commits does not list all changes, path filters are not applied", len(git.Commits))
+			return nil, false, nil
+		}
+		var files []string
+		for _, c := range git.Commits {
+			files = append(files, c.Added...)
+			files = append(files, c.Modified...)
+			files = append(files, c.Removed...)
+		}
+		return files, true, nil
+	}
+	_, client := forgeFor(tenant, event.Provider, con)
+	if client == nil {
+		con.Info("Function changedFiles no forge configured, path filters are not applied")
+		return nil, false, nil
+	}
+	ctx, cancel := tenantContext(tenant)
+	defer cancel()
+	files, err := client.ChangedFiles(ctx, git.Repository.FullName, git.PullRequest.Number)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not read the files changed by pull request %d %v", git.PullRequest.Number, err)
+	}
+	con.Debug("Function changedFiles pull request %d changed %d files", git.PullRequest.Number, len(files))
+	return files, true, nil
+}
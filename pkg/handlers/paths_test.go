@@ -0,0 +1,139 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/microlib/simple"
+)
+
+func TestChangedPaths(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var urls []string
+	filesCode, filesResponse := 200, "[]"
+
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		code, resp := 202, "{}"
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/files"):
+			code, resp = filesCode, "[]"
+			if r.URL.Query().Get("page") == "1" {
+				resp = filesResponse
+			}
+		case strings.Contains(r.URL.Path, "/statuses/"):
+			code = 201
+		default:
+			urls = append(urls, r.URL.String())
+		}
+		return NewTestResponse(code, resp)
+	})
+	tenant := config.Tenant{
+		Name:   "team-f",
+		Forges: []config.Forge{{Provider: "github", Token: "abc"}},
+		Routes: []config.Route{
+			{Name: "api", Event: "push", Actions: []string{"branch"}, URL: "http://el-api:8080", IncludePaths: []string{"services/api/**"}},
+			{Name: "web", Event: "push", Actions: []string{"branch"}, URL: "http://el-web:8080", IncludePaths: []string{"services/web"}, ExcludePaths: []string{"**/*.md"}},
+			{Name: "pr-api", Event: "pull_request", Actions: []string{"opened"}, URL: "http://el-pr-api:8080", IncludePaths: []string{"services/api"}},
+		},
+	}
+	reg := NewRegistry(&config.Config{Tenants: []config.Tenant{tenant}})
+
+	// send - posts the payload file as the event type after applying the change, returns the status code
+	send := func(file string, eventType string, change func(payload map[string]interface{})) int {
+		var payload map[string]interface{}
+		data, _ := ioutil.ReadFile(file)
+		json.Unmarshal(data, &payload)
+		change(payload)
+		data, _ = json.Marshal(payload)
+		urls = nil
+		return PostTenant(conn, reg, "team-f", data, map[string]string{"X-GitHub-Event": eventType}).Code
+	}
+	push := func(added []string, modified []string) {
+		send("../../tests/git-payload-push-for-pr.json", "push", func(payload map[string]interface{}) {
+			payload["created"] = false
+			payload["commits"] = []interface{}{
+				map[string]interface{}{"id": "1", "added": added},
+				map[string]interface{}{"id": "2", "modified": modified},
+			}
+		})
+	}
+
+	t.Run("TenantWebhookHandler : should pass (push routed by changed paths)", func(t *testing.T) {
+		push([]string{"services/api/handler.go"}, []string{"services/web/README.md"})
+		if fmt.Sprint(urls) != "[http://el-api:8080]" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect routes - got (%v)", "TenantWebhookHandler", urls))
+		}
+		push(nil, []string{"services/web/index.html", "services/api/go.mod"})
+		if fmt.Sprint(urls) != "[http://el-api:8080 http://el-web:8080]" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect routes - got (%v)", "TenantWebhookHandler", urls))
+		}
+		push(nil, []string{"README.md"})
+		if len(urls) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s posted unrelated changes - got (%v)", "TenantWebhookHandler", urls))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should pass (push not listing all changes is not filtered)", func(t *testing.T) {
+		for _, change := range []func(payload map[string]interface{}){
+			func(payload map[string]interface{}) { payload["commits"] = []interface{}{} },
+			func(payload map[string]interface{}) {
+				payload["forced"] = true
+				payload["created"] = false
+				payload["commits"] = []interface{}{map[string]interface{}{"id": "1", "modified": []string{"README.md"}}}
+			},
+			func(payload map[string]interface{}) {
+				var commits []interface{}
+				for x := 0; x < MAXPUSHCOMMITS; x++ {
+					commits = append(commits, map[string]interface{}{"id": fmt.Sprint(x), "modified": []string{"README.md"}})
+				}
+				payload["created"] = false
+				payload["commits"] = commits
+			},
+		} {
+			send("../../tests/git-payload-push-for-pr.json", "push", change)
+			if fmt.Sprint(urls) != "[http://el-api:8080 http://el-web:8080]" {
+				t.Errorf(fmt.Sprintf("Handler %s filtered an incomplete push - got (%v)", "TenantWebhookHandler", urls))
+			}
+		}
+	})
+
+	opened := func(payload map[string]interface{}) {
+		payload["action"] = "opened"
+		payload["pull_request"].(map[string]interface{})["number"] = 4101
+	}
+
+	t.Run("TenantWebhookHandler : should pass (pull request files from the forge)", func(t *testing.T) {
+		filesResponse = `[{"filename":"docs/setup.md"},{"filename":"services/api/main.go"}]`
+		send("../../tests/git-payload-pr-created.json", "pull_request", opened)
+		if fmt.Sprint(urls) != "[http://el-pr-api:8080]" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect routes - got (%v)", "TenantWebhookHandler", urls))
+		}
+		filesResponse = `[{"filename":"docs/setup.md"}]`
+		send("../../tests/git-payload-pr-created.json", "pull_request", opened)
+		if len(urls) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s posted unrelated changes - got (%v)", "TenantWebhookHandler", urls))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should fail (forge error)", func(t *testing.T) {
+		filesCode = 500
+		defer func() { filesCode = 200 }()
+		if code := send("../../tests/git-payload-pr-created.json", "pull_request", opened); code != http.StatusBadGateway || len(urls) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect status - got (%d %v) wanted (%d)", "TenantWebhookHandler", code, urls, http.StatusBadGateway))
+		}
+		// no route with path filters matches the action, the forge is not asked
+		closed := func(payload map[string]interface{}) { payload["action"] = "closed" }
+		if code := send("../../tests/git-payload-pr-created.json", "pull_request", closed); code != http.StatusOK {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect status - got (%d) wanted (%d)", "TenantWebhookHandler", code, http.StatusOK))
+		}
+	})
+}
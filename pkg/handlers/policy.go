@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/policy"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
+)
+
+// trusted - fork pull request commits marked with /ok-to-test or the ok-to-test label (keyed by TrustKey),
+// a push to the fork is not trusted until it is marked again, the user is kept for reporting
+var trusted = store.NewHolds(HOLDTTL)
+
+// trustKey - private utility function, the trusted key of the pull request head commit
+func trustKey(tenant *config.Tenant, git *schema.GitSchema) string {
+	return store.TrustKey(tenant.Name, git.Repository.FullName, git.PullRequest.Number, git.PullRequest.Head.Sha)
+}
+
+// checkPolicy - private function, returns why the tenant policy does not allow the event
+func checkPolicy(tenant *config.Tenant, event *schema.Event) error {
+	return policy.Check(tenant.Policy, subject(tenant, event))
+}
+
+// subject - private utility function, the policy subject of the event
+func subject(tenant *config.Tenant, event *schema.Event) policy.Subject {
+	git := event.Git
+	s := policy.Subject{
+		Sender:     git.Sender.Login,
+		Owner:      git.Repository.Owner.Login,
+		Visibility: git.Repository.Visibility,
+	}
+	if s.Visibility == "" {
+		// gitea only has the private flag
+		s.Visibility = "public"
+		if git.Repository.Private {
+			s.Visibility = "private"
+		}
+	}
+	if !isPullRequest(event.Type) {
+		return s
+	}
+	s.PullRequest = true
+	s.Author = git.PullRequest.User.Login
+	s.Association = git.PullRequest.AuthorAssociation
+	s.Fork = isFork(git)
+	if s.Fork {
+		// the label stays on the pull request, only the event adding it trusts the head commit
+		_, s.Trusted = trusted.Held(trustKey(tenant, git))
+		s.Trusted = s.Trusted || okToTest(tenant, event)
+	}
+	return s
+}
+
+// isFork - private utility function, reports whether the pull request head lives in another repository
+// head.repo.fork alone is also set for pull requests between branches of a forked repository
+func isFork(git *schema.GitSchema) bool {
+	head := git.PullRequest.Head.Repo.FullName
+	if head == "" || git.Repository.FullName == "" {
+		return git.PullRequest.Head.Repo.Fork
+	}
+	return head != git.Repository.FullName
+}
+
+// okToTest - private utility function, reports whether the event added the ok-to-test label to a fork
+// pull request, the pull request opened routes are then fired as for a new pull request
+func okToTest(tenant *config.Tenant, event *schema.Event) bool {
+	return event.Type == "pull_request" && event.Action == "labeled" &&
+		event.Git.Label.Name == policy.Label(tenant.Policy) && isFork(event.Git)
+}
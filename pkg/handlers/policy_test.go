@@ -0,0 +1,112 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
+	"github.com/microlib/simple"
+)
+
+func TestPolicy(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	posted := 0
+
+	os.Setenv("PR_OPENED_URL", "http://el-pr-opened:8080")
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		posted++
+		return nil
+	})
+
+	// send - posts a fork pull request event after applying the change, returns the status code
+	send := func(change func(payload map[string]interface{}, pr map[string]interface{})) int {
+		var payload map[string]interface{}
+		data, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+		json.Unmarshal(data, &payload)
+		pr := payload["pull_request"].(map[string]interface{})
+		pr["number"] = 4040
+		pr["head"].(map[string]interface{})["repo"].(map[string]interface{})["full_name"] = "someone/golang-simple-echoservice"
+		change(payload, pr)
+		data, _ = json.Marshal(payload)
+		posted = 0
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/service", bytes.NewBuffer(data))
+		req.Header.Set("X-GitHub-Event", "pull_request")
+		WebhookHandler(rr, req, conn)
+		return rr.Code
+	}
+	opened := func(payload map[string]interface{}, pr map[string]interface{}) { payload["action"] = "opened" }
+
+	t.Run("WebhookHandler : should pass (fork waits for ok-to-test)", func(t *testing.T) {
+		if code := send(opened); code != http.StatusOK || posted != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s forwarded an untrusted fork - got (%d %d) wanted (%d %d)", "WebhookHandler", code, posted, http.StatusOK, 0))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (ok-to-test label runs the opened routes)", func(t *testing.T) {
+		code := send(func(payload map[string]interface{}, pr map[string]interface{}) {
+			payload["action"] = "labeled"
+			payload["label"] = map[string]interface{}{"name": "ok-to-test"}
+			pr["labels"] = []interface{}{map[string]interface{}{"name": "ok-to-test"}}
+		})
+		if code != http.StatusOK || posted != 1 {
+			t.Errorf(fmt.Sprintf("Handler %s did not forward the trusted fork - got (%d %d) wanted (%d %d)", "WebhookHandler", code, posted, http.StatusOK, 1))
+		}
+	})
+
+	t.Run("WebhookHandler : should pass (a new head commit is not trusted until ok-to-test is given again)", func(t *testing.T) {
+		if _, ok := trusted.Held(store.TrustKey("default", "luigizuccarelli/golang-simple-echoservice", 4040, "6183473b17fa69a8872c2b59c2d974a8f01db187")); !ok {
+			t.Errorf(fmt.Sprintf("Handler %s did not trust the labeled head commit", "WebhookHandler"))
+		}
+		code := send(func(payload map[string]interface{}, pr map[string]interface{}) {
+			payload["action"] = "synchronize"
+			pr["labels"] = []interface{}{map[string]interface{}{"name": "ok-to-test"}}
+			pr["head"].(map[string]interface{})["sha"] = "4040404040404040404040404040404040404040"
+		})
+		if code != http.StatusOK || posted != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s forwarded an untrusted head commit - got (%d %d) wanted (%d %d)", "WebhookHandler", code, posted, http.StatusOK, 0))
+		}
+	})
+
+	t.Run("WebhookHandler : should fail (denied by policy)", func(t *testing.T) {
+		defer os.Setenv("DENY_SENDERS", "")
+		defer os.Setenv("FORK_PRS", "")
+		defer os.Setenv("ALLOW_VISIBILITY", "")
+		denied := []struct {
+			envar  string
+			value  string
+			change func(payload map[string]interface{}, pr map[string]interface{})
+		}{
+			{"DENY_SENDERS", "*[bot]", func(payload map[string]interface{}, pr map[string]interface{}) {
+				payload["action"] = "opened"
+				payload["sender"].(map[string]interface{})["login"] = "dependabot[bot]"
+				pr["head"].(map[string]interface{})["repo"].(map[string]interface{})["full_name"] = "luigizuccarelli/golang-simple-echoservice"
+			}},
+			{"FORK_PRS", "deny", func(payload map[string]interface{}, pr map[string]interface{}) {
+				payload["action"] = "opened"
+				pr["labels"] = []interface{}{map[string]interface{}{"name": "ok-to-test"}}
+			}},
+			{"ALLOW_VISIBILITY", "public", func(payload map[string]interface{}, pr map[string]interface{}) {
+				payload["action"] = "opened"
+				payload["repository"].(map[string]interface{})["visibility"] = "private"
+			}},
+		}
+		for _, d := range denied {
+			os.Setenv(d.envar, d.value)
+			if code := send(d.change); code != http.StatusForbidden || posted != 0 {
+				t.Errorf(fmt.Sprintf("Handler %s %s - got (%d %d) wanted (%d %d)", "WebhookHandler", d.envar, code, posted, http.StatusForbidden, 0))
+			}
+			os.Setenv(d.envar, "")
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/semver"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
+)
+
+// RELEASETTL - the routed state of a release is kept this long after its last transition
+const RELEASETTL time.Duration = 90 * 24 * time.Hour
+
+// releases - the routed state of each release, shared by all tenants (keys carry the tenant)
+var releases = store.NewReleases(RELEASETTL)
+
+// releaseTransition - private function, returns the action to route for the release event
+// and a function that undoes the transition when the event could not be delivered (so that a redelivery is routed)
+// github sends published together with prereleased or released, and edited together with released
+// when a prerelease is promoted (gitea only sends updated), the release state makes sure
+// each of prereleased and released is routed once and never after a full release
+func releaseTransition(tenant *config.Tenant, event *schema.Event) (string, func()) {
+	git := event.Git
+	key := store.ReleaseKey(tenant.Name, git.Repository.FullName, git.Release.ID)
+	previous := releases.State(key)
+	undo := func() { releases.Set(key, previous) }
+	switch event.Action {
+	case store.PRERELEASED, store.RELEASED:
+		if !releases.Advance(key, event.Action) {
+			return "", func() {}
+		}
+	case "edited":
+		if !git.Release.Prerelease && releases.Promote(key) {
+			return store.RELEASED, undo
+		}
+	case "deleted":
+		releases.Delete(key)
+	}
+	return event.Action, undo
+}
+
+// resolveRelease - private function, replaces a branch target_commitish with the commit the release tag points to
+// so that the pipeline builds the tagged commit even if the branch has moved on,
+// without a forge the branch cannot be resolved and the delivery fails rather than build whatever the branch holds
+func resolveRelease(con connectors.Clients, tenant *config.Tenant, event *schema.Event, mapping *schema.MapBinding) error {
+	if mapping.Branch == "" {
+		return nil
+	}
+	_, client := forgeFor(tenant, event.Provider, con)
+	if client == nil {
+		return fmt.Errorf("no forge configured to resolve tag %s, the release targets branch %s", mapping.TagVersion, mapping.Branch)
+	}
+	ctx, cancel := tenantContext(tenant)
+	defer cancel()
+	sha, err := client.ResolveTag(ctx, event.Git.Repository.FullName, mapping.TagVersion)
+	if err != nil || sha == "" {
+		return fmt.Errorf("could not resolve tag %s to a commit %v", mapping.TagVersion, err)
+	}
+	con.Debug("Function resolveRelease tag %s resolved to %s", mapping.TagVersion, sha)
+	mapping.RepoHash = sha
+	return nil
+}
+
+// tagEnvironment - private utility function, adds the parsed semver and the environment of the tag to the binding
+// tags that are not semantic versions can still match an environment pattern
+func tagEnvironment(tenant *config.Tenant, mapping *schema.MapBinding) {
+	if v, err := semver.Parse(mapping.TagVersion); err == nil {
+		mapping.Semver = v
+	}
+	mapping.Environment = tenant.EnvironmentFor(mapping.TagVersion, mapping.Semver)
+}
@@ -0,0 +1,69 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/microlib/simple"
+)
+
+func TestSinks(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var paths []string
+	var bodies []string
+	offsets := `{"offsets":[{"partition":0,"offset":7}]}`
+
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, string(body))
+		return NewTestResponse(200, offsets)
+	})
+	reg := NewRegistry(&config.Config{Tenants: []config.Tenant{{Name: "team-k", Routes: []config.Route{
+		{Name: "bus", Event: "pull_request", Actions: []string{"opened"}, URL: "http://kafka-rest:8082",
+			Sink: &config.Sink{Type: config.KAFKA, Subject: "git.{{ .Tenant }}.{{ .Event }}.{{ .Action }}", Key: "{{ .Binding.RepoName }}"}},
+		{Name: "actions", Event: "pull_request", Actions: []string{"opened"}, URL: "https://github.example.com/api/v3",
+			Sink: &config.Sink{Type: config.GITHUB, Workflow: "ci.yml", Token: "ghp_0123", Params: map[string]string{"sha": "{{ shortsha .Binding.RepoHash }}"}}},
+	}}}})
+	post := func(id string) *httptest.ResponseRecorder {
+		data, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+		return PostTenant(conn, reg, "team-k", data, map[string]string{"X-GitHub-Event": "pull_request", "X-GitHub-Delivery": id})
+	}
+
+	t.Run("TenantWebhookHandler : should pass (kafka sink)", func(t *testing.T) {
+		rr := post("sink-4601")
+		var produce map[string][]map[string][]byte
+		json.Unmarshal([]byte(bodies[0]), &produce)
+		var binding map[string]interface{}
+		json.Unmarshal(produce["records"][0]["value"], &binding)
+		if rr.Code != http.StatusOK || paths[0] != "/topics/git.team-k.pull_request.opened" || binding["deliveryid"] != "sink-4601-bus" ||
+			string(produce["records"][0]["key"]) != binding["name"] {
+			t.Errorf(fmt.Sprintf("Handler %s published incorrect record - got (%d %v %s)", "TenantWebhookHandler", rr.Code, paths, bodies))
+		}
+		var dispatch map[string]interface{}
+		json.Unmarshal([]byte(bodies[1]), &dispatch)
+		if len(paths) != 2 || paths[1] != "/api/v3/repos/luigizuccarelli/golang-simple-echoservice/actions/workflows/ci.yml/dispatches" ||
+			dispatch["ref"] != "test-trigger" || dispatch["inputs"].(map[string]interface{})["sha"] != binding["hash"].(string)[:7] {
+			t.Errorf(fmt.Sprintf("Handler %s dispatched incorrect workflow - got (%v %s)", "TenantWebhookHandler", paths, bodies))
+		}
+		if d := deliveries.Get("sink-4601-bus"); d == nil || d.Sink == nil || d.Sink.Subject != "git.team-k.pull_request.opened" {
+			t.Errorf(fmt.Sprintf("Handler %s recorded incorrect delivery - got (%v)", "TenantWebhookHandler", d))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should fail (record not acknowledged)", func(t *testing.T) {
+		offsets = `{"offsets":[{"error_code":40403,"error":"Topic not found"}]}`
+		if rr := post("sink-4602"); rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), "Topic not found") {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect status - got (%d %s)", "TenantWebhookHandler", rr.Code, rr.Body.String()))
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/forge"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
+)
+
+// STATUSCONTEXT - prefix of the commit status context (and check run name), the route name is appended
+const STATUSCONTEXT string = "tekton/"
+
+// forgeFor - private utility function, returns the forge and api client for the event provider
+// nil is returned when the tenant has no forge configured for it
+func forgeFor(tenant *config.Tenant, provider string, con connectors.Clients) (*config.Forge, forge.Client) {
+	f := tenant.Forge(provider)
+	if f == nil {
+		return nil, nil
+	}
+	client, err := forge.New(f.Provider, f.APIURL, f.Token, con)
+	if err != nil {
+		con.Error("Function forgeFor %v", err)
+		return nil, nil
+	}
+	return f, client
+}
+
+// notifyForge - private function, reports the state of pull request deliveries
+// failures are logged only, the delivery itself has already happened
+func notifyForge(con connectors.Clients, tenant *config.Tenant, delivery *store.Delivery, state string, description string) {
+	if !isPullRequest(delivery.Event) || delivery.Sha == "" {
+		return
+	}
+	f, client := forgeFor(tenant, delivery.Provider, con)
+	if client == nil {
+		return
+	}
+	ctx, cancel := tenantContext(tenant)
+	defer cancel()
+	if err := reportStatus(ctx, client, f.Checks, delivery, state, description, description, ""); err != nil {
+		con.Error("Function notifyForge could not report %s on %s %v", state, delivery.Sha, err)
+	}
+}
+
+// reportStatus - private function, sets the commit status or, when the forge uses checks,
+// creates or updates the check run of the delivery (the check run id is kept on the delivery)
+func reportStatus(ctx context.Context, client forge.Client, checks bool, delivery *store.Delivery, state string, description string, summary string, targetURL string) error {
+	name := STATUSCONTEXT + delivery.Route
+	if !checks {
+		status := forge.Status{State: state, Context: name, Description: description, TargetURL: targetURL}
+		return client.SetStatus(ctx, delivery.Repo, delivery.Sha, status)
+	}
+
+	run := forge.CheckRun{
+		Name:       name,
+		HeadSha:    delivery.Sha,
+		ExternalID: delivery.ID,
+		DetailsURL: targetURL,
+		Output:     &forge.CheckOutput{Title: description, Summary: summary},
+	}
+	switch state {
+	case forge.PENDING:
+		run.Status = "queued"
+	case forge.RUNNING:
+		run.Status = "in_progress"
+	case forge.SUCCESS:
+		run.Status, run.Conclusion = "completed", "success"
+	default:
+		run.Status, run.Conclusion = "completed", "failure"
+	}
+	if delivery.CheckRun == 0 {
+		id, err := client.CreateCheckRun(ctx, delivery.Repo, run)
+		if err != nil {
+			return err
+		}
+		delivery.CheckRun = id
+		deliveries.Put(delivery)
+		return nil
+	}
+	run.HeadSha = ""
+	return client.UpdateCheckRun(ctx, delivery.Repo, delivery.CheckRun, run)
+}
@@ -0,0 +1,75 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/forge"
+	"github.com/microlib/simple"
+)
+
+func TestStatusReporting(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+
+	os.Setenv("PR_OPENED_URL", "http://el-pr-opened:8080")
+	os.Setenv("FORGE_PROVIDER", "github")
+	os.Setenv("FORGE_TOKEN", "abc")
+	defer os.Setenv("FORGE_PROVIDER", "")
+
+	tests := []struct {
+		name     string
+		elStatus int
+		status   int
+		state    string
+	}{
+		{"should pass (pending status)", 202, 200, forge.PENDING},
+		{"should fail (error status)", 500, 500, forge.ERROR},
+	}
+
+	for _, tc := range tests {
+		t.Run("WebhookHandler : "+tc.name, func(t *testing.T) {
+			var statuses []forge.Status
+			var paths []string
+			conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+				code := tc.elStatus
+				if strings.HasPrefix(r.URL.String(), "https://api.github.com") {
+					var st forge.Status
+					json.Unmarshal(body, &st)
+					statuses = append(statuses, st)
+					paths = append(paths, r.URL.Path)
+					code = 201
+				}
+				return NewTestResponse(code, "{}")
+			})
+
+			requestPayload, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+			rr := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/v1/service", bytes.NewBuffer(requestPayload))
+			req.Header.Set("X-GitHub-Event", "pull_request")
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				WebhookHandler(w, r, conn)
+			})
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.status {
+				t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "WebhookHandler", rr.Code, tc.status))
+			}
+			if len(statuses) != 1 || statuses[0].State != tc.state || statuses[0].Context != "tekton/pr-opened" {
+				t.Fatalf(fmt.Sprintf("Handler %s reported incorrect status - got (%v) wanted (%s)", "WebhookHandler", statuses, tc.state))
+			}
+			if paths[0] != "/repos/luigizuccarelli/golang-simple-echoservice/statuses/6183473b17fa69a8872c2b59c2d974a8f01db187" {
+				t.Errorf(fmt.Sprintf("Handler %s reported status on incorrect path - got (%s)", "WebhookHandler", paths[0]))
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/payload"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/store"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/tekton"
+)
+
+// newDynamic - the Kubernetes client tekton routes create their runs with
+var newDynamic = tekton.NewDynamic
+
+// renderRun - private function, the run a tekton route creates for the binding
+// the route template is executed with the payload.Data of the event
+func renderRun(tenant *config.Tenant, event *schema.Event, route *config.Route, binding *schema.MapBinding) ([]byte, error) {
+	var rendered []byte
+	if route.Tekton.Template != nil {
+		t, err := payload.Parse(route.Tekton.Template)
+		if err == nil {
+			rendered, _, err = t.Render(payload.NewData(tenant.Name, route.Name, event, binding))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("template %v", err)
+		}
+	}
+	run, err := tekton.NewRun(route.Tekton, route.Name, binding.DeliveryID, rendered, binding)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(run)
+}
+
+// createRun - private function, creates the run held by a recorded delivery, the name of the
+// created run is kept on the delivery (re-runs create a new run from the same object)
+func createRun(ctx context.Context, con connectors.Clients, delivery *store.Delivery) error {
+	var run map[string]interface{}
+	if err := json.Unmarshal(delivery.Body, &run); err != nil {
+		return fmt.Errorf("delivery %s holds no run %v", delivery.ID, err)
+	}
+	client, err := newDynamic(delivery.Tekton.Kubeconfig, con)
+	if err != nil {
+		con.Error("Function createRun %v", err)
+		return err
+	}
+	apiVersion, _ := run["apiVersion"].(string)
+	kind, _ := run["kind"].(string)
+	metadata, _ := run["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	created, err := client.Create(ctx, tekton.ResourceFor(apiVersion, kind), namespace, run)
+	if err != nil {
+		con.Error("Function createRun %s %v", delivery.ID, err)
+		return err
+	}
+	delivery.Run = tekton.Name(created)
+	deliveries.Put(delivery)
+	con.Info("Function createRun %s created %s %s/%s", delivery.ID, kind, namespace, delivery.Run)
+	return nil
+}
@@ -0,0 +1,66 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/tekton"
+	"github.com/microlib/simple"
+)
+
+func TestTekton(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	fake := &FakeDynamic{}
+	var kubeconfigs []string
+	newDynamic = func(path string, con connectors.Clients) (tekton.Dynamic, error) {
+		kubeconfigs = append(kubeconfigs, path)
+		return fake, nil
+	}
+	defer func() { newDynamic = tekton.NewDynamic }()
+
+	conn := NewTestConnectors("../../tests/response.json", 200, "false", logger)
+	reg := NewRegistry(&config.Config{Tenants: []config.Tenant{{Name: "team-t", Routes: []config.Route{
+		{Name: "build", Event: "pull_request", Actions: []string{"opened"}, Tekton: &config.Tekton{Namespace: "ci", Pipeline: "build",
+			Params: map[string]string{"revision": "hash", "git-url": "url"}, Kubeconfig: "/etc/gitwebhook/kubeconfig.json"}},
+	}}}})
+	post := func(id string) *httptest.ResponseRecorder {
+		data, _ := ioutil.ReadFile("../../tests/git-payload-pr-created.json")
+		return PostTenant(conn, reg, "team-t", data, map[string]string{"X-GitHub-Event": "pull_request", "X-GitHub-Delivery": id})
+	}
+
+	t.Run("TenantWebhookHandler : should pass (pipelinerun created)", func(t *testing.T) {
+		rr := post("tk-4701")
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "created build-00001") || len(fake.Created) != 1 {
+			t.Fatalf(fmt.Sprintf("Handler %s returned incorrect response - got (%d %s)", "TenantWebhookHandler", rr.Code, rr.Body.String()))
+		}
+		run := fake.Created[0]
+		labels := run["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
+		params := run["spec"].(map[string]interface{})["params"].([]interface{})
+		revision := params[1].(map[string]interface{})
+		if fake.Namespaces[0] != "ci" || fake.Resources[0] != (tekton.Resource{Group: "tekton.dev", Version: "v1beta1", Resource: "pipelineruns"}) ||
+			labels[tekton.LABELDELIVERY] != "tk-4701-build" || revision["name"] != "revision" || revision["value"] == "" || kubeconfigs[0] != "/etc/gitwebhook/kubeconfig.json" {
+			t.Errorf(fmt.Sprintf("Handler %s created incorrect run - got (%v %v %v)", "TenantWebhookHandler", fake.Namespaces, fake.Resources, run))
+		}
+		if d := deliveries.Get("tk-4701-build"); d == nil || d.Run != "build-00001" {
+			t.Errorf(fmt.Sprintf("Handler %s recorded incorrect delivery - got (%v)", "TenantWebhookHandler", d))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should fail (run not created)", func(t *testing.T) {
+		fake.Force = errors.New("create pipelineruns failed with 403 pipelineruns.tekton.dev is forbidden")
+		if rr := post("tk-4702"); rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), "forbidden") {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect response - got (%d %s)", "TenantWebhookHandler", rr.Code, rr.Body.String()))
+		}
+	})
+}
@@ -0,0 +1,66 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/microlib/simple"
+)
+
+func TestRouteTemplate(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+	var bodies []string
+	var headers []http.Header
+
+	conn := NewCaptureConnectors(logger, func(r *http.Request, body []byte) *http.Response {
+		bodies = append(bodies, string(body))
+		headers = append(headers, r.Header)
+		return nil
+	})
+	routes := []config.Route{
+		{Name: "build", Event: "push", Actions: []string{"branch"}, URL: "http://el-build:8080", Template: &config.Template{
+			Body:        `{"git-revision":"{{ .Binding.RepoHash }}","short":"{{ shortsha .Binding.RepoHash }}","branch":{{ json .Binding.Branch }},"pusher":{{ json .Payload.pusher.name }}}`,
+			ContentType: "application/vnd.build+json",
+			Headers:     map[string]string{"X-Event": "{{ .Event }}/{{ .Action }}"},
+		}},
+		{Name: "audit", Event: "push", Actions: []string{"branch"}, URL: "http://el-audit:8080", Template: &config.Template{Body: `{{ .Payload.missing | replace "(" "" }}`}},
+	}
+
+	send := func(routes []config.Route) int {
+		reg := NewRegistry(&config.Config{Tenants: []config.Tenant{{Name: "team-g", Routes: routes}}})
+		data, _ := ioutil.ReadFile("../../tests/git-payload-push-for-pr.json")
+		bodies, headers = nil, nil
+		return PostTenant(conn, reg, "team-g", data, map[string]string{"X-GitHub-Event": "push", "X-GitHub-Delivery": "tmpl-4301"}).Code
+	}
+
+	t.Run("TenantWebhookHandler : should pass (rendered payload and headers)", func(t *testing.T) {
+		send(routes[:1])
+		var got map[string]string
+		if len(bodies) != 1 || json.Unmarshal([]byte(bodies[0]), &got) != nil {
+			t.Fatalf(fmt.Sprintf("Handler %s posted incorrect payload - got (%v)", "TenantWebhookHandler", bodies))
+		}
+		if got["git-revision"] != "6183473b17fa69a8872c2b59c2d974a8f01db187" || got["short"] != "6183473" || got["branch"] != "test-trigger" || got["pusher"] == "" {
+			t.Errorf(fmt.Sprintf("Handler %s rendered incorrect payload - got (%v)", "TenantWebhookHandler", got))
+		}
+		if headers[0].Get("Content-Type") != "application/vnd.build+json" || headers[0].Get("X-Event") != "push/branch" {
+			t.Errorf(fmt.Sprintf("Handler %s sent incorrect headers - got (%v)", "TenantWebhookHandler", headers[0]))
+		}
+		if d := deliveries.Get("tmpl-4301-build"); d == nil || string(d.Body) != bodies[0] {
+			t.Errorf(fmt.Sprintf("Handler %s did not record the rendered payload for re-runs - got (%v)", "TenantWebhookHandler", d))
+		}
+	})
+
+	t.Run("TenantWebhookHandler : should fail (template error)", func(t *testing.T) {
+		if code := send(routes[1:]); code != http.StatusInternalServerError || len(bodies) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect status - got (%d %v) wanted (%d)", "TenantWebhookHandler", code, bodies, http.StatusInternalServerError))
+		}
+	})
+}
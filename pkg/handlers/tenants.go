@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+)
+
+// tenant rate limit used when the tenant sets none
+const (
+	DEFAULTRATELIMIT float64 = 10
+	DEFAULTBURST     int     = 20
+)
+
+// Registry - runtime state for each configured tenant
+// every tenant has its own rate limiter and in flight cap so that a flood
+// from one team cannot starve the deliveries of another
+type Registry struct {
+	tenants map[string]*tenantState
+}
+
+type tenantState struct {
+	tenant   *config.Tenant
+	mutex    sync.Mutex
+	tokens   float64
+	last     time.Time
+	inflight chan struct{}
+}
+
+// NewRegistry - builds the runtime state for the (validated) tenant configuration
+func NewRegistry(cfg *config.Config) *Registry {
+	reg := &Registry{tenants: make(map[string]*tenantState)}
+	for x := range cfg.Tenants {
+		t := &cfg.Tenants[x]
+		ts := &tenantState{tenant: t, tokens: float64(burst(t)), last: time.Now()}
+		if t.MaxInFlight > 0 {
+			ts.inflight = make(chan struct{}, t.MaxInFlight)
+		}
+		reg.tenants[t.Name] = ts
+	}
+	return reg
+}
+
+func (reg *Registry) lookup(name string) *tenantState {
+	if reg == nil {
+		return nil
+	}
+	return reg.tenants[name]
+}
+
+// burst - the bucket size, 1 when only the rate limit is set and DEFAULTBURST with the default rate limit
+func burst(t *config.Tenant) int {
+	if t.Burst > 0 {
+		return t.Burst
+	}
+	if t.RateLimit > 0 {
+		return 1
+	}
+	return DEFAULTBURST
+}
+
+// rate - the tenant rate limit, DEFAULTRATELIMIT when none is set
+func rate(t *config.Tenant) float64 {
+	if t.RateLimit > 0 {
+		return t.RateLimit
+	}
+	return DEFAULTRATELIMIT
+}
+
+// allow - token bucket, refilled at the tenant rate limit tokens per second
+func (ts *tenantState) allow() bool {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	now := time.Now()
+	ts.tokens += now.Sub(ts.last).Seconds() * rate(ts.tenant)
+	if max := float64(burst(ts.tenant)); ts.tokens > max {
+		ts.tokens = max
+	}
+	ts.last = now
+	if ts.tokens < 1 {
+		return false
+	}
+	ts.tokens--
+	return true
+}
+
+// acquire - non blocking, fails when the tenant already has MaxInFlight deliveries running
+func (ts *tenantState) acquire() bool {
+	if ts.inflight == nil {
+		return true
+	}
+	select {
+	case ts.inflight <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (ts *tenantState) release() {
+	if ts.inflight != nil {
+		<-ts.inflight
+	}
+}
+
+// tenantContext - private utility function, bounds outbound requests by the tenant timeout
+func tenantContext(t *config.Tenant) (context.Context, context.CancelFunc) {
+	if t.Timeout > 0 {
+		return context.WithTimeout(context.Background(), time.Duration(t.Timeout)*time.Second)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// verifySignature - private utility function, checks the provider signature header against the secret
+// github and gitea sign the raw body with hmac sha256, gitlab sends the token as is
+func verifySignature(r *http.Request, body []byte, secret string) error {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if sig := r.Header.Get("X-Hub-Signature-256"); sig != "" {
+		if !hmac.Equal([]byte(sig), []byte("sha256="+expected)) {
+			return errors.New("X-Hub-Signature-256 does not match")
+		}
+		return nil
+	}
+	if sig := r.Header.Get("X-Gitea-Signature"); sig != "" {
+		if !hmac.Equal([]byte(sig), []byte(expected)) {
+			return errors.New("X-Gitea-Signature does not match")
+		}
+		return nil
+	}
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		if !hmac.Equal([]byte(token), []byte(secret)) {
+			return errors.New("X-Gitlab-Token does not match")
+		}
+		return nil
+	}
+	return errors.New("no signature header found")
+}
@@ -0,0 +1,73 @@
+//go:build fake
+// +build fake
+
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/microlib/simple"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestTenantHandlers(t *testing.T) {
+
+	var logger = &simple.Logger{Level: "info"}
+
+	cfg, err := config.Load("../../tests/tenants.json")
+	if err != nil {
+		t.Fatalf("Should not fail : found error %v", err)
+	}
+	reg := NewRegistry(cfg)
+	secret := cfg.Lookup("team-a").Secret
+
+	tests := []struct {
+		name     string
+		tenant   string
+		file     string
+		headers  map[string]string
+		signWith string
+		status   int
+	}{
+		{"should fail (unknown tenant)", "team-x", "../../tests/git-payload-pr-created.json", nil, "", 404},
+		{"should fail (missing signature)", "team-a", "../../tests/git-payload-pr-created.json", map[string]string{"X-GitHub-Event": "pull_request"}, "", 401},
+		{"should fail (bad signature)", "team-a", "../../tests/git-payload-pr-created.json", map[string]string{"X-GitHub-Event": "pull_request"}, "wrong-secret", 401},
+		{"should fail (provider not allowed)", "team-b", "../../tests/git-payload-pr-created.json", map[string]string{"X-GitHub-Event": "pull_request"}, "short", 403},
+		{"should pass (post) pr", "team-a", "../../tests/git-payload-pr-created.json", map[string]string{"X-GitHub-Event": "pull_request"}, secret, 200},
+		{"should fail (rate limit)", "team-a", "../../tests/git-payload-pr-created.json", map[string]string{"X-GitHub-Event": "pull_request"}, secret, 429},
+	}
+
+	for _, tc := range tests {
+		t.Run("TenantWebhookHandler : "+tc.name, func(t *testing.T) {
+			requestPayload, _ := ioutil.ReadFile(tc.file)
+			headers := map[string]string{}
+			for k, v := range tc.headers {
+				headers[k] = v
+			}
+			if tc.signWith != "" {
+				headers["X-Hub-Signature-256"] = sign(tc.signWith, requestPayload)
+			}
+			conn := NewTestConnectors("../../tests/response.json", 200, "none", logger)
+			rr := PostTenant(conn, reg, tc.tenant, requestPayload, headers)
+			body, e := ioutil.ReadAll(rr.Body)
+			if e != nil {
+				t.Fatalf("Should not fail : found error %v", e)
+			}
+			logger.Trace(fmt.Sprintf("Response %s", string(body)))
+			if rr.Code != tc.status {
+				t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "TenantWebhookHandler", rr.Code, tc.status))
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+)
+
+// SMTPTIMEOUT - bounds sending a mail when the context has no deadline
+const SMTPTIMEOUT time.Duration = 30 * time.Second
+
+// email - private struct, sends plain text mails through an smtp server
+// STARTTLS is used when the server offers it, credentials are only sent over tls (or to localhost)
+type email struct {
+	addr     string
+	host     string
+	user     string
+	password string
+	from     string
+	to       []string
+}
+
+// newEmail - private function, the url is smtp://[user:password@]host[:port] (port 587 by default)
+func newEmail(n *config.Notifier) (Notifier, error) {
+	u, err := url.Parse(n.URL)
+	if err != nil || u.Scheme != "smtp" || u.Hostname() == "" {
+		return nil, fmt.Errorf("email notifier url %q should be of the form smtp://host:587", n.URL)
+	}
+	if n.From == "" || len(n.To) == 0 {
+		return nil, fmt.Errorf("email notifier needs from and to addresses")
+	}
+	e := &email{addr: u.Host, host: u.Hostname(), from: n.From, to: n.To}
+	if u.Port() == "" {
+		e.addr = net.JoinHostPort(u.Hostname(), "587")
+	}
+	if u.User != nil {
+		e.user = u.User.Username()
+		e.password, _ = u.User.Password()
+	}
+	return e, nil
+}
+
+func (e *email) Send(ctx context.Context, n *Notification, title string, text string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", e.addr)
+	if err != nil {
+		return fmt.Errorf("smtp connect %v", err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(SMTPTIMEOUT)
+	}
+	conn.SetDeadline(deadline)
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp %v", err)
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+			return fmt.Errorf("smtp starttls %v", err)
+		}
+	}
+	if e.user != "" {
+		if err = c.Auth(smtp.PlainAuth("", e.user, e.password, e.host)); err != nil {
+			return fmt.Errorf("smtp auth %v", err)
+		}
+	}
+	if err = c.Mail(e.from); err != nil {
+		return fmt.Errorf("smtp mail from %v", err)
+	}
+	for _, to := range e.to {
+		if err = c.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp rcpt to %s %v", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data %v", err)
+	}
+	message := "From: " + e.from + "\r\n" +
+		"To: " + strings.Join(e.to, ", ") + "\r\n" +
+		"Subject: " + strings.NewReplacer("\r", " ", "\n", " ").Replace(title) + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + strings.Replace(text, "\n", "\r\n", -1) + "\r\n"
+	if _, err = w.Write([]byte(message)); err != nil {
+		return fmt.Errorf("smtp write %v", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("smtp data %v", err)
+	}
+	return c.Quit()
+}
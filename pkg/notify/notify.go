@@ -0,0 +1,169 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/payload"
+)
+
+// Notification - what a notifier reports, Link is the web page of the release, pull request
+// or repository and Reason why the delivery failed or the event was blocked
+type Notification struct {
+	Condition   string `json:"condition"`
+	Tenant      string `json:"tenant"`
+	Route       string `json:"route,omitempty"`
+	Event       string `json:"event"`
+	Action      string `json:"action,omitempty"`
+	Repo        string `json:"repo"`
+	RepoURL     string `json:"repourl,omitempty"`
+	Actor       string `json:"actor"`
+	Tag         string `json:"tag,omitempty"`
+	Branch      string `json:"branch,omitempty"`
+	Sha         string `json:"sha,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	DeliveryID  string `json:"deliveryid,omitempty"`
+	Link        string `json:"link,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// MESSAGE - the default message template, the first line is used as title (email subject)
+const MESSAGE string = `{{ if eq .Condition "delivery_failed" }}Delivery of {{ .Repo }} {{ .Event }} to {{ .Route }} failed
+{{- else if eq .Condition "release_forwarded" }}Release {{ .Tag }} of {{ .Repo }} forwarded to {{ .Route }}
+{{- else if eq .Condition "policy_blocked" }}{{ .Event }} of {{ .Repo }} by {{ .Actor }} blocked by policy
+{{- else if eq .Condition "approval_expired" }}Approval of {{ .Repo }} {{ .Tag }} for {{ .Route }} expired
+{{- else }}{{ .Condition }} {{ .Repo }}{{ end }}
+Repository: {{ .Repo }}{{ if .RepoURL }} ({{ .RepoURL }}){{ end }}
+Actor: {{ .Actor }}
+{{- if .Tag }}
+Tag: {{ .Tag }}{{ end }}
+{{- if .Environment }}
+Environment: {{ .Environment }}{{ end }}
+{{- if .Branch }}
+Branch: {{ .Branch }}{{ end }}
+{{- if .Sha }}
+Commit: {{ shortsha .Sha }}{{ end }}
+{{- if .Reason }}
+Reason: {{ .Reason }}{{ end }}
+{{- if .Link }}
+Link: {{ .Link }}{{ end }}
+{{- if .DeliveryID }}
+Delivery: {{ .DeliveryID }}{{ end }}`
+
+// Notifier - sends notifications, title is the first line of the rendered message and text the rest
+type Notifier interface {
+	Send(ctx context.Context, n *Notification, title string, text string) error
+}
+
+// Types - the supported notifier types
+var Types = []string{"slack", "teams", "webhook", "email"}
+
+// New - returns the notifier of the type, the http based notifiers go through connectors.Clients
+func New(n *config.Notifier, con connectors.Clients) (Notifier, error) {
+	switch n.Type {
+	case "slack":
+		return &slack{url: n.URL, con: con}, nil
+	case "teams":
+		return &teams{url: n.URL, con: con}, nil
+	case "webhook":
+		return &webhook{url: n.URL, con: con}, nil
+	case "email":
+		return newEmail(n)
+	}
+	return nil, fmt.Errorf("notifier type %q should be slack, teams, webhook or email", n.Type)
+}
+
+// Parse - parses the message template of the notifier (MESSAGE when it has none)
+func Parse(n *config.Notifier) (*template.Template, error) {
+	text := n.Template
+	if text == "" {
+		text = MESSAGE
+	}
+	return template.New("message").Funcs(payload.Funcs).Parse(text)
+}
+
+// Render - executes the message template, the title is the first line
+func Render(t *template.Template, n *Notification) (string, string, error) {
+	var message bytes.Buffer
+	if err := t.Execute(&message, n); err != nil {
+		return "", "", err
+	}
+	lines := strings.SplitN(strings.TrimSpace(message.String()), "\n", 2)
+	if len(lines) == 1 {
+		return lines[0], "", nil
+	}
+	return lines[0], strings.TrimSpace(lines[1]), nil
+}
+
+// post - private utility function, posts the json to the url
+func post(ctx context.Context, con connectors.Clients, url string, value interface{}) error {
+	data, _ := json.Marshal(value)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := con.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("notification post failed with %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// slack - private struct, a slack incoming webhook (mrkdwn text, the title in bold)
+type slack struct {
+	url string
+	con connectors.Clients
+}
+
+func (s *slack) Send(ctx context.Context, n *Notification, title string, text string) error {
+	return post(ctx, s.con, s.url, map[string]string{"text": "*" + title + "*\n" + text})
+}
+
+// teams - private struct, a Microsoft Teams incoming webhook (legacy message card)
+type teams struct {
+	url string
+	con connectors.Clients
+}
+
+func (t *teams) Send(ctx context.Context, n *Notification, title string, text string) error {
+	card := map[string]string{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary":  title,
+		"title":    title,
+		// teams renders markdown, two trailing spaces keep the line breaks
+		"text": strings.Replace(text, "\n", "  \n", -1),
+	}
+	if n.Condition == config.DELIVERYFAILED || n.Condition == config.POLICYBLOCKED || n.Condition == config.APPROVALEXPIRED {
+		card["themeColor"] = "D70000"
+	}
+	return post(ctx, t.con, t.url, card)
+}
+
+// webhook - private struct, posts the notification fields with the rendered title and text
+type webhook struct {
+	url string
+	con connectors.Clients
+}
+
+func (w *webhook) Send(ctx context.Context, n *Notification, title string, text string) error {
+	return post(ctx, w.con, w.url, struct {
+		*Notification
+		Title string `json:"title"`
+		Text  string `json:"text"`
+	}{n, title, text})
+}
@@ -0,0 +1,168 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+)
+
+// fakeClients - records the posted requests and answers with code
+type fakeClients struct {
+	urls   []string
+	bodies []string
+	code   int
+}
+
+func (f *fakeClients) Error(string, ...interface{}) {}
+func (f *fakeClients) Info(string, ...interface{})  {}
+func (f *fakeClients) Debug(string, ...interface{}) {}
+func (f *fakeClients) Trace(string, ...interface{}) {}
+
+func (f *fakeClients) Do(req *http.Request) (*http.Response, error) {
+	body, _ := ioutil.ReadAll(req.Body)
+	f.urls = append(f.urls, req.URL.String())
+	f.bodies = append(f.bodies, string(body))
+	return &http.Response{StatusCode: f.code, Body: ioutil.NopCloser(bytes.NewBufferString("no_text")), Header: make(http.Header)}, nil
+}
+
+// smtpServer - an in-process stand-in for an smtp server without STARTTLS, records the envelope and the mail
+type smtpServer struct {
+	listener net.Listener
+	commands []string
+	mail     string
+	done     chan bool
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start the smtp stand-in %v", err)
+	}
+	s := &smtpServer{listener: l, done: make(chan bool, 10)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(conn)
+			s.done <- true
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprint(conn, "220 stand-in ESMTP\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		s.commands = append(s.commands, line)
+		switch verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); verb {
+		case "EHLO":
+			fmt.Fprint(conn, "250-stand-in\r\n250 8BITMIME\r\n")
+		case "DATA":
+			fmt.Fprint(conn, "354 end with .\r\n")
+			for {
+				data, err := r.ReadString('\n')
+				if err != nil || data == ".\r\n" {
+					break
+				}
+				s.mail += data
+			}
+			fmt.Fprint(conn, "250 queued\r\n")
+		case "QUIT":
+			fmt.Fprint(conn, "221 bye\r\n")
+			return
+		default:
+			fmt.Fprint(conn, "250 ok\r\n")
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	n := &Notification{Condition: config.DELIVERYFAILED, Tenant: "team-a", Route: "pr-opened", Event: "pull_request", Repo: "org/app",
+		RepoURL: "https://github.com/org/app", Actor: "lmz", Sha: "6183473b2d5e1c7f", Link: "https://github.com/org/app/pull/12",
+		DeliveryID: "abc-pr-opened", Reason: "503"}
+
+	t.Run("Render : should pass (default message)", func(t *testing.T) {
+		tpl, _ := Parse(&config.Notifier{})
+		title, text, err := Render(tpl, n)
+		if err != nil || title != "Delivery of org/app pull_request to pr-opened failed" || !strings.Contains(text, "Commit: 6183473") ||
+			!strings.Contains(text, "Reason: 503") || !strings.Contains(text, "Link: https://github.com/org/app/pull/12") || strings.Contains(text, "Tag:") {
+			t.Errorf(fmt.Sprintf("Handler %s rendered incorrect message - got (%s %s %v)", "Render", title, text, err))
+		}
+		tpl, _ = Parse(&config.Notifier{Template: "{{ upper .Repo }} {{ .Tag }}"})
+		if title, text, _ = Render(tpl, &Notification{Repo: "org/app", Tag: "v1.0.0"}); title != "ORG/APP v1.0.0" || text != "" {
+			t.Errorf(fmt.Sprintf("Handler %s rendered incorrect message - got (%s %s)", "Render", title, text))
+		}
+	})
+
+	t.Run("Send : should pass (slack, teams and webhook)", func(t *testing.T) {
+		con := &fakeClients{code: 200}
+		for _, kind := range []string{"slack", "teams", "webhook"} {
+			notifier, _ := New(&config.Notifier{Type: kind, URL: "https://hooks.example.com/" + kind}, con)
+			if err := notifier.Send(context.Background(), n, "title", "line 1\nline 2"); err != nil {
+				t.Errorf(fmt.Sprintf("Handler %s returned incorrect error - got (%v)", "Send", err))
+			}
+		}
+		var slack, card, hook map[string]string
+		json.Unmarshal([]byte(con.bodies[0]), &slack)
+		json.Unmarshal([]byte(con.bodies[1]), &card)
+		json.Unmarshal([]byte(con.bodies[2]), &hook)
+		if len(con.urls) != 3 || con.urls[1] != "https://hooks.example.com/teams" || slack["text"] != "*title*\nline 1\nline 2" ||
+			card["@type"] != "MessageCard" || card["themeColor"] != "D70000" || card["text"] != "line 1  \nline 2" ||
+			hook["condition"] != config.DELIVERYFAILED || hook["repo"] != "org/app" || hook["title"] != "title" {
+			t.Errorf(fmt.Sprintf("Handler %s posted incorrect messages - got (%v %v)", "Send", con.urls, con.bodies))
+		}
+	})
+
+	t.Run("Send : should fail (webhook rejected)", func(t *testing.T) {
+		notifier, _ := New(&config.Notifier{Type: "slack", URL: "https://hooks.example.com/slack"}, &fakeClients{code: 404})
+		if err := notifier.Send(context.Background(), n, "title", ""); err == nil || !strings.Contains(err.Error(), "404 no_text") {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect error - got (%v)", "Send", err))
+		}
+	})
+
+	t.Run("Send : should pass (email)", func(t *testing.T) {
+		server := newSMTPServer(t)
+		defer server.listener.Close()
+		notifier, err := New(&config.Notifier{Type: "email", URL: "smtp://" + server.listener.Addr().String(), From: "ci@example.com",
+			To: []string{"dev@example.com", "ops@example.com"}}, nil)
+		if err == nil {
+			err = notifier.Send(context.Background(), n, "Delivery failed", "Repository: org/app\nReason: 503")
+		}
+		<-server.done
+		if err != nil || !strings.Contains(strings.Join(server.commands, "|"), "MAIL FROM:<ci@example.com>") ||
+			!strings.Contains(strings.Join(server.commands, "|"), "RCPT TO:<ops@example.com>") ||
+			!strings.Contains(server.mail, "Subject: Delivery failed\r\n") || !strings.Contains(server.mail, "\r\n\r\nRepository: org/app\r\nReason: 503\r\n") {
+			t.Errorf(fmt.Sprintf("Handler %s sent incorrect mail - got (%v %v %q)", "Send", err, server.commands, server.mail))
+		}
+	})
+
+	t.Run("New : should fail (email)", func(t *testing.T) {
+		if _, err := New(&config.Notifier{Type: "email", URL: "https://mail.example.com", From: "ci@example.com", To: []string{"dev@example.com"}}, nil); err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect error - got (%v) wanted (%v)", "New", err, "smtp url"))
+		}
+		if _, err := New(&config.Notifier{Type: "email", URL: "smtp://mail.example.com"}, nil); err == nil || !strings.Contains(err.Error(), "from and to") {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect error - got (%v) wanted (%v)", "New", err, "addresses"))
+		}
+		if _, err := New(&config.Notifier{Type: "pager"}, nil); err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect error - got (%v) wanted (%v)", "New", err, "unknown type"))
+		}
+	})
+}
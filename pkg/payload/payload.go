@@ -0,0 +1,145 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+)
+
+// Data - what a template is executed with, Binding is the normalised event
+// and Payload the raw webhook payload (numbers keep their original form)
+type Data struct {
+	Tenant     string
+	Route      string
+	Provider   string
+	Event      string
+	Action     string
+	DeliveryID string
+	Binding    *schema.MapBinding
+	Payload    map[string]interface{}
+}
+
+// Funcs - the helper functions available to templates, json encodes a value (strings are quoted and escaped),
+// shortsha keeps the first 7 characters of a sha, replace is a regular expression replacement
+// ({{ .Binding.Branch | replace "^feature/" "" }}) and default returns its first argument
+// when the value is empty ({{ .Binding.Environment | default "dev" }}), lower, upper and trim as in strings
+var Funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"shortsha": func(sha string) string {
+		if len(sha) > 7 {
+			return sha[:7]
+		}
+		return sha
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"replace": func(pattern string, replacement string, value string) (string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+		return re.ReplaceAllString(value, replacement), nil
+	},
+	"default": func(def interface{}, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
+}
+
+// Template - a parsed route template
+type Template struct {
+	contentType string
+	body        *template.Template
+	headers     map[string]*template.Template
+}
+
+// Parse - parses the body (read from the file when set) and the header templates
+func Parse(t *config.Template) (*Template, error) {
+	source := t.Body
+	if t.File != "" {
+		data, err := ioutil.ReadFile(t.File)
+		if err != nil {
+			return nil, err
+		}
+		source = string(data)
+	}
+	if source == "" {
+		return nil, errors.New("template body or file is mandatory")
+	}
+	body, err := template.New("body").Funcs(Funcs).Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &Template{contentType: t.ContentType, body: body, headers: make(map[string]*template.Template)}
+	if p.contentType == "" {
+		p.contentType = "application/json"
+	}
+	for name, value := range t.Headers {
+		h, err := template.New(name).Funcs(Funcs).Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		p.headers[name] = h
+	}
+	return p, nil
+}
+
+// Render - executes the body and header templates, the content type is returned as a header
+func (p *Template) Render(data *Data) ([]byte, map[string]string, error) {
+	var body bytes.Buffer
+	if err := p.body.Execute(&body, data); err != nil {
+		return nil, nil, err
+	}
+	headers := map[string]string{"Content-Type": p.contentType}
+	for name, h := range p.headers {
+		var value bytes.Buffer
+		if err := h.Execute(&value, data); err != nil {
+			return nil, nil, err
+		}
+		headers[name] = strings.TrimSpace(value.String())
+	}
+	return body.Bytes(), headers, nil
+}
+
+// Expand - executes a one line template (sink subjects and keys), surrounding spaces are trimmed
+func Expand(text string, data *Data) (string, error) {
+	t, err := template.New("text").Funcs(Funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var value bytes.Buffer
+	if err = t.Execute(&value, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(value.String()), nil
+}
+
+// NewData - the template data of the event, a payload that is not a json object is left empty
+func NewData(tenant string, route string, event *schema.Event, binding *schema.MapBinding) *Data {
+	data := &Data{
+		Tenant:     tenant,
+		Route:      route,
+		Provider:   event.Provider,
+		Event:      event.Type,
+		Action:     event.Action,
+		DeliveryID: binding.DeliveryID,
+		Binding:    binding,
+	}
+	decoder := json.NewDecoder(bytes.NewReader(event.Payload))
+	decoder.UseNumber()
+	decoder.Decode(&data.Payload)
+	return data
+}
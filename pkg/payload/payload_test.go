@@ -0,0 +1,53 @@
+package payload
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+)
+
+func TestPayload(t *testing.T) {
+
+	event := &schema.Event{Provider: "github", Type: "push", Action: "branch", Payload: []byte(`{"ref":"refs/heads/feature/Login","repository":{"id":187215468,"full_name":"org/app"}}`)}
+	binding := &schema.MapBinding{RepoHash: "6183473b17fa69a8872c2b59c2d974a8f01db187", Message: "Fix \"quoted\" title", DeliveryID: "abc-build"}
+
+	t.Run("Render : should pass (helpers, raw payload and headers)", func(t *testing.T) {
+		p, err := Parse(&config.Template{
+			Body:    `{"sha":"{{ shortsha .Binding.RepoHash }}","title":{{ json .Binding.Message }},"branch":"{{ .Payload.ref | replace "^refs/heads/" "" | lower }}","repo":{{ .Payload.repository.id }},"env":"{{ .Binding.Environment | default "dev" }}"}`,
+			Headers: map[string]string{"X-Repo": "{{ .Payload.repository.full_name | upper }}", "X-Delivery": "{{ .DeliveryID }}"},
+		})
+		if err != nil {
+			t.Fatalf(fmt.Sprintf("Handler %s returned with error - got (%v) wanted (%v)", "Parse", err, nil))
+		}
+		body, headers, err := p.Render(NewData("team-a", "build", event, binding))
+		want := `{"sha":"6183473","title":"Fix \"quoted\" title","branch":"feature/login","repo":187215468,"env":"dev"}`
+		if err != nil || string(body) != want {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect body - got (%s %v) wanted (%s)", "Render", body, err, want))
+		}
+		if headers["Content-Type"] != "application/json" || headers["X-Repo"] != "ORG/APP" || headers["X-Delivery"] != "abc-build" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect headers - got (%v)", "Render", headers))
+		}
+	})
+
+	t.Run("Parse : should fail (syntax, missing body and file)", func(t *testing.T) {
+		for _, tmpl := range []*config.Template{
+			{Body: `{{ .Binding.RepoHash `},
+			{},
+			{File: "../../tests/missing.tmpl"},
+			{Body: `{}`, Headers: map[string]string{"X-Bad": "{{ unknown }}"}},
+		} {
+			if _, err := Parse(tmpl); err == nil {
+				t.Errorf(fmt.Sprintf("Handler %s returned no error for %v", "Parse", tmpl))
+			}
+		}
+	})
+
+	t.Run("Render : should fail (invalid replace pattern)", func(t *testing.T) {
+		p, _ := Parse(&config.Template{Body: `{{ .Payload.ref | replace "(" "" }}`, ContentType: "text/plain"})
+		if _, _, err := p.Render(NewData("team-a", "build", event, binding)); err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned no error - got (%v) wanted (%v)", "Render", err, "error"))
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+)
+
+// ErrNotTrusted - a fork pull request that has not been marked ok-to-test
+var ErrNotTrusted = errors.New("fork pull request needs ok-to-test")
+
+// Subject - the actors and repository of an event, the pull request fields are only
+// checked when PullRequest is set, Trusted marks a fork pull request as ok-to-test
+type Subject struct {
+	Sender      string
+	Owner       string
+	Visibility  string
+	PullRequest bool
+	Author      string
+	Association string
+	Fork        bool
+	Trusted     bool
+}
+
+// Label - the ok-to-test label of the policy (a nil policy uses the default)
+func Label(p *config.Policy) string {
+	if p == nil || p.OkToTestLabel == "" {
+		return config.OKTOTEST
+	}
+	return p.OkToTestLabel
+}
+
+// Check - returns why the policy denies the subject, nil when it is allowed
+// a nil policy still holds back untrusted fork pull requests
+func Check(p *config.Policy, s Subject) error {
+	if p == nil {
+		p = &config.Policy{}
+	}
+	if err := allowed("sender", s.Sender, p.AllowSenders, p.DenySenders); err != nil {
+		return err
+	}
+	if err := allowed("repository owner", s.Owner, p.AllowOwners, p.DenyOwners); err != nil {
+		return err
+	}
+	if len(p.Visibility) > 0 && !contains(p.Visibility, s.Visibility) {
+		return fmt.Errorf("repository visibility %q is not allowed", s.Visibility)
+	}
+	if !s.PullRequest {
+		return nil
+	}
+	if err := allowed("author", s.Author, p.AllowAuthors, p.DenyAuthors); err != nil {
+		return err
+	}
+	if len(p.Associations) > 0 && !contains(p.Associations, s.Association) {
+		return fmt.Errorf("author association %q is not allowed", s.Association)
+	}
+	if !s.Fork {
+		return nil
+	}
+	switch p.Forks {
+	case config.ALLOW:
+		return nil
+	case config.DENY:
+		return errors.New("fork pull requests are not allowed")
+	}
+	if !s.Trusted {
+		return ErrNotTrusted
+	}
+	return nil
+}
+
+// allowed - private utility function, a deny match wins and an empty allow list allows everyone
+// an unknown (empty) login only passes when there is no allow list
+func allowed(what string, login string, allow []string, deny []string) error {
+	for _, d := range deny {
+		if Match(d, login) {
+			return fmt.Errorf("%s %q is denied", what, login)
+		}
+	}
+	if len(allow) == 0 {
+		return nil
+	}
+	for _, a := range allow {
+		if Match(a, login) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %q is not allowed", what, login)
+}
+
+// contains - private utility function, case insensitive
+func contains(list []string, value string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match - case insensitive glob match where * matches any run of characters
+// (brackets are literal so that "*[bot]" matches bot accounts)
+func Match(pattern string, value string) bool {
+	pattern, value = strings.ToLower(pattern), strings.ToLower(value)
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, p)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(p):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
@@ -0,0 +1,84 @@
+package policy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+)
+
+func TestPolicy(t *testing.T) {
+
+	t.Run("Match : should pass", func(t *testing.T) {
+		tests := []struct {
+			pattern string
+			value   string
+			want    bool
+		}{
+			{"*[bot]", "dependabot[bot]", true},
+			{"*[bot]", "robot", false},
+			{"LMZ", "lmz", true},
+			{"release-*-ci", "release-team-ci", true},
+			{"release-*-ci", "release-team", false},
+			{"*", "", true},
+		}
+		for _, tt := range tests {
+			if got := Match(tt.pattern, tt.value); got != tt.want {
+				t.Errorf(fmt.Sprintf("Handler %s %q %q - got (%v) wanted (%v)", "Match", tt.pattern, tt.value, got, tt.want))
+			}
+		}
+	})
+
+	t.Run("Check : should pass (nil policy)", func(t *testing.T) {
+		if err := Check(nil, Subject{Sender: "someone", PullRequest: true, Author: "someone"}); err != nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned error - got (%v) wanted (%v)", "Check", err, nil))
+		}
+		if err := Check(nil, Subject{PullRequest: true, Fork: true}); err != ErrNotTrusted {
+			t.Errorf(fmt.Sprintf("Handler %s untrusted fork - got (%v) wanted (%v)", "Check", err, ErrNotTrusted))
+		}
+		if err := Check(nil, Subject{PullRequest: true, Fork: true, Trusted: true}); err != nil {
+			t.Errorf(fmt.Sprintf("Handler %s trusted fork - got (%v) wanted (%v)", "Check", err, nil))
+		}
+	})
+
+	t.Run("Check : should fail (denied)", func(t *testing.T) {
+		p := &config.Policy{
+			AllowSenders: []string{"*"},
+			DenySenders:  []string{"*[bot]"},
+			AllowOwners:  []string{"luigizuccarelli"},
+			Visibility:   []string{"public"},
+			DenyAuthors:  []string{"mallory"},
+			Associations: []string{"OWNER", "MEMBER"},
+			Forks:        config.DENY,
+		}
+		ok := Subject{Sender: "lmz", Owner: "luigizuccarelli", Visibility: "public", PullRequest: true, Author: "lmz", Association: "OWNER"}
+		if err := Check(p, ok); err != nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned error - got (%v) wanted (%v)", "Check", err, nil))
+		}
+		denied := []func(s *Subject){
+			func(s *Subject) { s.Sender = "renovate[bot]" },
+			func(s *Subject) { s.Owner = "someone-else" },
+			func(s *Subject) { s.Visibility = "private" },
+			func(s *Subject) { s.Author = "Mallory" },
+			func(s *Subject) { s.Association = "CONTRIBUTOR" },
+			func(s *Subject) { s.Fork, s.Trusted = true, true },
+		}
+		for x, deny := range denied {
+			s := ok
+			deny(&s)
+			if err := Check(p, s); err == nil {
+				t.Errorf(fmt.Sprintf("Handler %s case %d - got (%v) wanted an error", "Check", x, err))
+			}
+		}
+		// pull request rules do not apply to other events
+		if err := Check(p, Subject{Sender: "lmz", Owner: "luigizuccarelli", Visibility: "public", Author: "mallory"}); err != nil {
+			t.Errorf(fmt.Sprintf("Handler %s release event - got (%v) wanted (%v)", "Check", err, nil))
+		}
+	})
+
+	t.Run("Label : should pass", func(t *testing.T) {
+		if Label(nil) != "ok-to-test" || Label(&config.Policy{OkToTestLabel: "safe-to-test"}) != "safe-to-test" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect label", "Label"))
+		}
+	})
+}
@@ -1,7 +1,10 @@
 package schema
 
 import (
+	"net/http"
 	"time"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/semver"
 )
 
 type Response struct {
@@ -12,19 +15,97 @@ type Response struct {
 }
 
 type MapBinding struct {
-	RepoUrl    string `json:"url"`
-	RepoName   string `json:"name"`
-	RepoHash   string `json:"hash"`
-	ActorName  string `json:"actorname"`
-	ActorEmail string `json:"actoremail"`
-	Message    string `json:"message"`
-	TagVersion string `json:"tagversion,omitempty"`
-	InfraRepo  string `json:"infrarepo"`
+	RepoUrl     string          `json:"url"`
+	RepoName    string          `json:"name"`
+	RepoHash    string          `json:"hash"`
+	ActorName   string          `json:"actorname"`
+	ActorEmail  string          `json:"actoremail"`
+	Message     string          `json:"message"`
+	TagVersion  string          `json:"tagversion,omitempty"`
+	InfraRepo   string          `json:"infrarepo"`
+	DeliveryID  string          `json:"deliveryid,omitempty"`
+	Labels      []string        `json:"labels,omitempty"`
+	Branch      string          `json:"branch,omitempty"`
+	Semver      *semver.Version `json:"semver,omitempty"`
+	Environment string          `json:"environment,omitempty"`
+}
+
+// Label - a pull request label
+type Label struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+}
+
+// Commit - a pushed commit and the files it changed
+type Commit struct {
+	ID       string   `json:"id"`
+	Message  string   `json:"message"`
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+// Review - a pull request review, github sends State (approved, changes_requested or commented),
+// gitea sends Type (pull_request_review_approved, ...) and Content
+type Review struct {
+	ID      int64  `json:"id"`
+	State   string `json:"state"`
+	Body    string `json:"body"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	User    struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	SubmittedAt string `json:"submitted_at"`
+}
+
+// Event - the normalised view of an incoming webhook, used for routing
+type Event struct {
+	Provider   string
+	Type       string
+	Action     string
+	DeliveryID string
+	Git        *GitSchema
+	// Payload is the raw webhook payload, outbound templates read it
+	Payload []byte
+	// Body and Header are the request as received, passthrough routes forward them
+	Body   []byte
+	Header http.Header
+}
+
+// Callback - sent by pipeline finally tasks to /api/v1/callback/{deliveryID}
+type Callback struct {
+	Status  string `json:"status"`
+	LogURL  string `json:"logurl"`
+	Summary string `json:"summary"`
+	Comment bool   `json:"comment"`
+	Title   string `json:"title"`
 }
 
 type GitSchema struct {
-	Action  string `json:"action"`
-	Number  int    `json:"number"`
+	Action string `json:"action"`
+	Number int    `json:"number"`
+	// push, create and delete events, push refs are fully qualified (refs/tags/v1.0.0),
+	// create and delete refs are short names with a ref_type of tag or branch
+	Ref        string `json:"ref"`
+	RefType    string `json:"ref_type"`
+	Sha        string `json:"sha"`
+	Before     string `json:"before"`
+	After      string `json:"after"`
+	Created    bool   `json:"created"`
+	Deleted    bool   `json:"deleted"`
+	Forced     bool   `json:"forced"`
+	HeadCommit struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+		Author  struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"author"`
+	} `json:"head_commit"`
+	Commits []Commit `json:"commits"`
 	Release struct {
 		URL       string `json:"url"`
 		AssetsURL string `json:"assets_url"`
@@ -107,7 +188,7 @@ type GitSchema struct {
 		Assignees          []interface{} `json:"assignees"`
 		RequestedReviewers []interface{} `json:"requested_reviewers"`
 		RequestedTeams     []interface{} `json:"requested_teams"`
-		Labels             []interface{} `json:"labels"`
+		Labels             []Label       `json:"labels"`
 		Milestone          interface{}   `json:"milestone"`
 		Draft              bool          `json:"draft"`
 		CommitsURL         string        `json:"commits_url"`
@@ -545,6 +626,35 @@ type GitSchema struct {
 		Watchers                 int           `json:"watchers"`
 		DefaultBranch            string        `json:"default_branch"`
 	} `json:"repository"`
+	Issue struct {
+		Number      int    `json:"number"`
+		Title       string `json:"title"`
+		PullRequest *struct {
+			URL string `json:"url"`
+		} `json:"pull_request"`
+	} `json:"issue"`
+	IsPull  bool   `json:"is_pull"`
+	Label   Label  `json:"label"`
+	Review  Review `json:"review"`
+	Comment struct {
+		ID   int64  `json:"id"`
+		Body string `json:"body"`
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		AuthorAssociation string `json:"author_association"`
+	} `json:"comment"`
+	CheckRun struct {
+		ID         int64  `json:"id"`
+		Name       string `json:"name"`
+		HeadSha    string `json:"head_sha"`
+		ExternalID string `json:"external_id"`
+	} `json:"check_run"`
+	CheckSuite struct {
+		ID         int64  `json:"id"`
+		HeadSha    string `json:"head_sha"`
+		HeadBranch string `json:"head_branch"`
+	} `json:"check_suite"`
 	Sender struct {
 		Login             string `json:"login"`
 		ID                int    `json:"id"`
@@ -567,6 +677,99 @@ type GitSchema struct {
 	} `json:"sender"`
 }
 
+// GitLabSchema - the gitlab push, tag push, merge request, note and release hooks (see object_kind),
+// only the fields that are normalised to GitSchema are decoded
+type GitLabSchema struct {
+	ObjectKind   string        `json:"object_kind"`
+	Ref          string        `json:"ref"`
+	Before       string        `json:"before"`
+	After        string        `json:"after"`
+	CheckoutSha  string        `json:"checkout_sha"`
+	UserUsername string        `json:"user_username"`
+	UserEmail    string        `json:"user_email"`
+	User         GitLabUser    `json:"user"`
+	Project      GitLabProject `json:"project"`
+	Commits      []struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+		Author  struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"author"`
+		Added    []string `json:"added"`
+		Modified []string `json:"modified"`
+		Removed  []string `json:"removed"`
+	} `json:"commits"`
+	// the merge request of merge request hooks and the note of note hooks
+	ObjectAttributes struct {
+		ID             int64         `json:"id"`
+		IID            int           `json:"iid"`
+		Title          string        `json:"title"`
+		Description    string        `json:"description"`
+		State          string        `json:"state"`
+		Action         string        `json:"action"`
+		URL            string        `json:"url"`
+		SourceBranch   string        `json:"source_branch"`
+		TargetBranch   string        `json:"target_branch"`
+		Source         GitLabProject `json:"source"`
+		Target         GitLabProject `json:"target"`
+		MergeCommitSha string        `json:"merge_commit_sha"`
+		OldRev         string        `json:"oldrev"`
+		Draft          bool          `json:"draft"`
+		WorkInProgress bool          `json:"work_in_progress"`
+		LastCommit     struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+		Note         string `json:"note"`
+		NoteableType string `json:"noteable_type"`
+	} `json:"object_attributes"`
+	Labels  []GitLabLabel `json:"labels"`
+	Changes struct {
+		Labels struct {
+			Previous []GitLabLabel `json:"previous"`
+			Current  []GitLabLabel `json:"current"`
+		} `json:"labels"`
+	} `json:"changes"`
+	// the merge request a note was added to
+	MergeRequest struct {
+		IID   int    `json:"iid"`
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	} `json:"merge_request"`
+	// release hooks
+	Action      string `json:"action"`
+	Tag         string `json:"tag"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Commit      struct {
+		ID string `json:"id"`
+	} `json:"commit"`
+}
+
+type GitLabUser struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// GitLabProject - visibility_level is 0 (private), 10 (internal) or 20 (public)
+type GitLabProject struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+	GitHTTPURL        string `json:"git_http_url"`
+	DefaultBranch     string `json:"default_branch"`
+	VisibilityLevel   int    `json:"visibility_level"`
+}
+
+type GitLabLabel struct {
+	ID          int64  `json:"id"`
+	Title       string `json:"title"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+}
+
 type GiteaSchema struct {
 	Secret      string `json:"secret"`
 	Action      string `json:"action"`
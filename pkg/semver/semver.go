@@ -0,0 +1,54 @@
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pattern - semver 2.0.0 with an optional v prefix, the minor and patch versions may be omitted (v1, v1.2)
+var pattern = regexp.MustCompile(`^[vV]?(0|[1-9]\d*)(?:\.(0|[1-9]\d*))?(?:\.(0|[1-9]\d*))?(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?$`)
+
+// Version - a parsed semantic version, Version is the normalised form without the v prefix
+type Version struct {
+	Version    string   `json:"version"`
+	Major      int      `json:"major"`
+	Minor      int      `json:"minor"`
+	Patch      int      `json:"patch"`
+	Prerelease []string `json:"prerelease,omitempty"`
+	Build      string   `json:"build,omitempty"`
+}
+
+// Parse - parses the tag, an error is returned when it is not a semantic version
+func Parse(tag string) (*Version, error) {
+	m := pattern.FindStringSubmatch(strings.TrimSpace(tag))
+	if m == nil {
+		return nil, fmt.Errorf("%q is not a semantic version", tag)
+	}
+	v := &Version{Build: m[5]}
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	if m[4] != "" {
+		v.Prerelease = strings.Split(m[4], ".")
+	}
+	v.Version = fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if m[4] != "" {
+		v.Version += "-" + m[4]
+	}
+	if m[5] != "" {
+		v.Version += "+" + m[5]
+	}
+	return v, nil
+}
+
+// HasPrerelease - reports whether one of the pre-release identifiers is id (case insensitive)
+func (v *Version) HasPrerelease(id string) bool {
+	for _, p := range v.Prerelease {
+		if strings.EqualFold(p, id) {
+			return true
+		}
+	}
+	return false
+}
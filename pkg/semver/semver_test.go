@@ -0,0 +1,36 @@
+package semver
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+
+	t.Run("Parse : should pass", func(t *testing.T) {
+		tests := map[string]string{
+			"v1.0.1-PROD":        "1.0.1-PROD",
+			"1.2.3":              "1.2.3",
+			"v2":                 "2.0.0",
+			"v1.0.0-rc.1+build5": "1.0.0-rc.1+build5",
+		}
+		for tag, want := range tests {
+			v, err := Parse(tag)
+			if err != nil || v.Version != want {
+				t.Errorf(fmt.Sprintf("Handler %s returned incorrect version - got (%v %v) wanted (%s)", "Parse", v, err, want))
+			}
+		}
+		v, _ := Parse("v1.0.1-uat.2")
+		if v.Major != 1 || v.Patch != 1 || !v.HasPrerelease("UAT") || v.HasPrerelease("PROD") {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect version - got (%v)", "Parse", v))
+		}
+	})
+
+	t.Run("Parse : should fail", func(t *testing.T) {
+		for _, tag := range []string{"", "release-2021", "v1.02.3", "1.2.3.4"} {
+			if v, err := Parse(tag); err == nil {
+				t.Errorf(fmt.Sprintf("Handler %s returned with no error for %q - got (%v)", "Parse", tag, v))
+			}
+		}
+	})
+}
@@ -0,0 +1,460 @@
+package sinks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AMQPTIMEOUT - bounds a publish when the context has no deadline
+const AMQPTIMEOUT time.Duration = 10 * time.Second
+
+// AMQPPORT - the default broker port
+const AMQPPORT string = "5672"
+
+// AMQPFRAMEMAX - the largest frame accepted before the broker tuned the connection (and when it sets no limit)
+const AMQPFRAMEMAX uint32 = 131072
+
+// amqp frame types, the frame end octet and the methods the sink sends or expects (class id << 16 | method id)
+const (
+	amqpMethod   byte = 1
+	amqpHeader   byte = 2
+	amqpBody     byte = 3
+	amqpFrameEnd byte = 0xce
+
+	amqpConnectionStart   uint32 = 10<<16 | 10
+	amqpConnectionStartOk uint32 = 10<<16 | 11
+	amqpConnectionTune    uint32 = 10<<16 | 30
+	amqpConnectionTuneOk  uint32 = 10<<16 | 31
+	amqpConnectionOpen    uint32 = 10<<16 | 40
+	amqpConnectionOpenOk  uint32 = 10<<16 | 41
+	amqpConnectionClose   uint32 = 10<<16 | 50
+	amqpConnectionCloseOk uint32 = 10<<16 | 51
+	amqpChannelOpen       uint32 = 20<<16 | 10
+	amqpChannelOpenOk     uint32 = 20<<16 | 11
+	amqpChannelClose      uint32 = 20<<16 | 40
+	amqpChannelCloseOk    uint32 = 20<<16 | 41
+	amqpBasicPublish      uint32 = 60<<16 | 40
+	amqpBasicReturn       uint32 = 60<<16 | 50
+	amqpBasicAck          uint32 = 60<<16 | 80
+	amqpBasicNack         uint32 = 60<<16 | 120
+	amqpConfirmSelect     uint32 = 85<<16 | 10
+	amqpConfirmSelectOk   uint32 = 85<<16 | 11
+)
+
+// ErrNotConfirmed - the broker refused (nacked) the message, it was not stored
+var ErrNotConfirmed = errors.New("amqp message was not confirmed by the broker")
+
+// amqp - private struct, publishes over AMQP 0-9-1 with publisher confirms
+// a connection is opened per message, the channel is put in confirm mode and the message is published
+// persistent and mandatory: the broker returns it when no queue is bound and acks it once it is stored
+type amqp struct {
+	addr     string
+	user     string
+	password string
+	vhost    string
+	exchange string
+}
+
+// newAMQP - private utility function, the vhost is the sink vhost or the url path (default /),
+// the credentials default to guest like the other AMQP clients
+func newAMQP(u *url.URL, exchange string, vhost string) *amqp {
+	a := &amqp{addr: u.Host, user: "guest", password: "guest", vhost: vhost, exchange: exchange}
+	if u.Port() == "" {
+		a.addr = net.JoinHostPort(u.Hostname(), AMQPPORT)
+	}
+	if u.User != nil {
+		a.user = u.User.Username()
+		a.password, _ = u.User.Password()
+	}
+	if a.vhost == "" && len(u.Path) > 1 {
+		a.vhost = u.Path[1:]
+	}
+	if a.vhost == "" {
+		a.vhost = "/"
+	}
+	// amq.default is how the management api names the default exchange, AMQP names it ""
+	if a.exchange == RABBITMQEXCHANGE {
+		a.exchange = ""
+	}
+	return a
+}
+
+// Publish - publishes the message with the subject as routing key and waits for the broker confirm,
+// an unrouted (returned) message is ErrNotRouted and a nacked one ErrNotConfirmed
+func (a *amqp) Publish(ctx context.Context, msg *Message) (string, error) {
+	if len(msg.Subject) > 255 || len(a.exchange) > 255 {
+		return "", fmt.Errorf("amqp routing key %q or exchange %q is longer than 255", msg.Subject, a.exchange)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", a.addr)
+	if err != nil {
+		return "", fmt.Errorf("amqp connect %v", err)
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(AMQPTIMEOUT)
+	}
+	conn.SetDeadline(deadline)
+
+	c := &amqpConn{conn: conn, r: bufio.NewReader(conn), frameMax: AMQPFRAMEMAX}
+	if err = c.open(a.user, a.password, a.vhost); err != nil {
+		return "", err
+	}
+	if err = c.publish(a.exchange, msg); err != nil {
+		return "", err
+	}
+	c.close()
+	exchange := a.exchange
+	if exchange == "" {
+		exchange = RABBITMQEXCHANGE
+	}
+	return "exchange " + exchange + " routing key " + msg.Subject + " confirmed", nil
+}
+
+// amqpConn - private struct, the connection of a single publish, the sink only uses channel 1
+type amqpConn struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	frameMax uint32
+}
+
+// open - private function, the handshake (PLAIN auth), the vhost and channel 1 in confirm mode
+func (c *amqpConn) open(user string, password string, vhost string) error {
+	if _, err := c.conn.Write([]byte("AMQP\x00\x00\x09\x01")); err != nil {
+		return fmt.Errorf("amqp connect %v", err)
+	}
+	args, err := c.expect(0, amqpConnectionStart)
+	if err != nil {
+		return err
+	}
+	args.octet()
+	args.octet()
+	args.table()
+	mechanisms := args.longstr()
+	if args.err != nil || !strings.Contains(" "+mechanisms+" ", " PLAIN ") {
+		return fmt.Errorf("amqp broker %s does not offer PLAIN authentication (%q)", c.conn.RemoteAddr(), mechanisms)
+	}
+
+	var w amqpWriter
+	w.table(map[string]interface{}{
+		"product":      "golang-gitwebhook-service",
+		"capabilities": map[string]interface{}{"authentication_failure_close": true},
+	})
+	w.shortstr("PLAIN")
+	w.longstr("\x00" + user + "\x00" + password)
+	w.shortstr("en_US")
+	if err = c.send(0, amqpConnectionStartOk, w.Bytes()); err != nil {
+		return err
+	}
+	if args, err = c.expect(0, amqpConnectionTune); err != nil {
+		return err
+	}
+	args.short()
+	if frameMax := args.long(); frameMax > 0 && frameMax < c.frameMax {
+		c.frameMax = frameMax
+	}
+	// one channel and no heartbeats, the connection lives for a single publish
+	w.Reset()
+	w.short(1)
+	w.long(c.frameMax)
+	w.short(0)
+	if err = c.send(0, amqpConnectionTuneOk, w.Bytes()); err != nil {
+		return err
+	}
+
+	w.Reset()
+	w.shortstr(vhost)
+	w.shortstr("")
+	w.octet(0)
+	if err = c.send(0, amqpConnectionOpen, w.Bytes()); err != nil {
+		return err
+	}
+	if _, err = c.expect(0, amqpConnectionOpenOk); err != nil {
+		return err
+	}
+	if err = c.send(1, amqpChannelOpen, []byte{0}); err != nil {
+		return err
+	}
+	if _, err = c.expect(1, amqpChannelOpenOk); err != nil {
+		return err
+	}
+	if err = c.send(1, amqpConfirmSelect, []byte{0}); err != nil {
+		return err
+	}
+	_, err = c.expect(1, amqpConfirmSelectOk)
+	return err
+}
+
+// publish - private function, sends the Basic.Publish, content header and body frames and waits for the confirm
+// RabbitMQ sends the Basic.Return of an unroutable mandatory message before its Basic.Ack
+func (c *amqpConn) publish(exchange string, msg *Message) error {
+	var w amqpWriter
+	w.short(0)
+	w.shortstr(exchange)
+	w.shortstr(msg.Subject)
+	w.octet(1) // mandatory
+	frames := amqpFrame(amqpMethod, 1, append(methodID(amqpBasicPublish), w.Bytes()...))
+
+	// properties: content-type, headers, delivery-mode (persistent) and message-id
+	var flags uint16
+	var props amqpWriter
+	if ct := msg.Headers["Content-Type"]; ct != "" {
+		flags |= 0x8000
+		props.shortstr(ct)
+	}
+	if len(msg.Headers) > 0 {
+		headers := make(map[string]interface{}, len(msg.Headers))
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+		flags |= 0x2000
+		props.table(headers)
+	}
+	flags |= 0x1000
+	props.octet(2)
+	if msg.ID != "" {
+		flags |= 0x0080
+		props.shortstr(msg.ID)
+	}
+	w.Reset()
+	w.short(60)
+	w.short(0)
+	w.longlong(uint64(len(msg.Body)))
+	w.short(flags)
+	w.Write(props.Bytes())
+	frames = append(frames, amqpFrame(amqpHeader, 1, w.Bytes())...)
+	max := int(c.frameMax) - 8
+	for body := msg.Body; len(body) > 0; {
+		n := len(body)
+		if n > max {
+			n = max
+		}
+		frames = append(frames, amqpFrame(amqpBody, 1, body[:n])...)
+		body = body[n:]
+	}
+	if _, err := c.conn.Write(frames); err != nil {
+		return fmt.Errorf("amqp publish %v", err)
+	}
+
+	returned := ""
+	for {
+		method, args, err := c.next(1)
+		if err != nil {
+			return err
+		}
+		switch method {
+		case amqpBasicReturn:
+			code := args.short()
+			returned = fmt.Sprintf("%d %s", code, args.shortstr())
+		case amqpBasicAck:
+			if returned != "" {
+				return ErrNotRouted
+			}
+			return nil
+		case amqpBasicNack:
+			return ErrNotConfirmed
+		}
+	}
+}
+
+// close - private function, closes the connection cleanly, a publish was confirmed already so errors are ignored
+func (c *amqpConn) close() {
+	var w amqpWriter
+	w.short(200)
+	w.shortstr("")
+	w.short(0)
+	w.short(0)
+	if c.send(0, amqpConnectionClose, w.Bytes()) == nil {
+		c.expect(0, amqpConnectionCloseOk)
+	}
+}
+
+// send - private function, writes a method frame
+func (c *amqpConn) send(channel uint16, method uint32, args []byte) error {
+	if _, err := c.conn.Write(amqpFrame(amqpMethod, channel, append(methodID(method), args...))); err != nil {
+		return fmt.Errorf("amqp write %v", err)
+	}
+	return nil
+}
+
+// expect - private function, the next method must be the one expected
+func (c *amqpConn) expect(channel uint16, expected uint32) (*amqpReader, error) {
+	method, args, err := c.next(channel)
+	if err != nil {
+		return nil, err
+	}
+	if method != expected {
+		return nil, fmt.Errorf("amqp broker sent method %d.%d, expected %d.%d", method>>16, method&0xffff, expected>>16, expected&0xffff)
+	}
+	return args, nil
+}
+
+// next - private function, reads frames until a method of the channel arrives, heartbeats and the content of returned
+// messages are skipped and a connection or channel close from the broker is answered and returned as an error
+func (c *amqpConn) next(channel uint16) (uint32, *amqpReader, error) {
+	for {
+		typ, ch, payload, err := c.read()
+		if err != nil {
+			return 0, nil, err
+		}
+		if typ != amqpMethod {
+			continue
+		}
+		if len(payload) < 4 {
+			return 0, nil, errors.New("amqp method frame too short")
+		}
+		method := binary.BigEndian.Uint32(payload)
+		args := &amqpReader{data: payload[4:]}
+		switch {
+		case method == amqpConnectionClose:
+			c.send(0, amqpConnectionCloseOk, nil)
+			return 0, nil, fmt.Errorf("amqp connection closed by the broker %d %s", args.short(), args.shortstr())
+		case method == amqpChannelClose && ch == channel:
+			c.send(ch, amqpChannelCloseOk, nil)
+			return 0, nil, fmt.Errorf("amqp channel closed by the broker %d %s", args.short(), args.shortstr())
+		case ch != channel:
+			continue
+		}
+		return method, args, nil
+	}
+}
+
+// read - private function, reads a frame, the payload cannot exceed the negotiated frame max
+func (c *amqpConn) read() (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return 0, 0, nil, fmt.Errorf("amqp read %v", err)
+	}
+	if string(header[:4]) == "AMQP" {
+		return 0, 0, nil, errors.New("amqp broker does not support protocol 0-9-1")
+	}
+	size := binary.BigEndian.Uint32(header[3:])
+	if size > c.frameMax {
+		return 0, 0, nil, fmt.Errorf("amqp frame of %d bytes exceeds the frame max %d", size, c.frameMax)
+	}
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, 0, nil, fmt.Errorf("amqp read %v", err)
+	}
+	if payload[size] != amqpFrameEnd {
+		return 0, 0, nil, errors.New("amqp frame end missing")
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:]), payload[:size], nil
+}
+
+// amqpFrame - private utility function, a frame of the type on the channel
+func amqpFrame(typ byte, channel uint16, payload []byte) []byte {
+	frame := make([]byte, 7, len(payload)+8)
+	frame[0] = typ
+	binary.BigEndian.PutUint16(frame[1:], channel)
+	binary.BigEndian.PutUint32(frame[3:], uint32(len(payload)))
+	return append(append(frame, payload...), amqpFrameEnd)
+}
+
+// methodID - private utility function, the class and method ids of a method frame
+func methodID(method uint32) []byte {
+	id := make([]byte, 4)
+	binary.BigEndian.PutUint32(id, method)
+	return id
+}
+
+// amqpWriter - private struct, encodes the AMQP data types
+type amqpWriter struct {
+	bytes.Buffer
+}
+
+func (w *amqpWriter) octet(v byte) { w.WriteByte(v) }
+
+func (w *amqpWriter) short(v uint16) { binary.Write(w, binary.BigEndian, v) }
+
+func (w *amqpWriter) long(v uint32) { binary.Write(w, binary.BigEndian, v) }
+
+func (w *amqpWriter) longlong(v uint64) { binary.Write(w, binary.BigEndian, v) }
+
+// shortstr - the callers make sure s is at most 255 bytes
+func (w *amqpWriter) shortstr(s string) {
+	w.octet(byte(len(s)))
+	w.WriteString(s)
+}
+
+func (w *amqpWriter) longstr(s string) {
+	w.long(uint32(len(s)))
+	w.WriteString(s)
+}
+
+// table - a field table of strings (S), booleans (t) and tables (F), sorted by name
+func (w *amqpWriter) table(fields map[string]interface{}) {
+	var t amqpWriter
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.shortstr(name)
+		switch v := fields[name].(type) {
+		case string:
+			t.octet('S')
+			t.longstr(v)
+		case bool:
+			t.octet('t')
+			if v {
+				t.octet(1)
+			} else {
+				t.octet(0)
+			}
+		case map[string]interface{}:
+			t.octet('F')
+			t.table(v)
+		}
+	}
+	w.long(uint32(t.Len()))
+	w.Write(t.Bytes())
+}
+
+// amqpReader - private struct, decodes the AMQP data types, err is set once the data is too short
+type amqpReader struct {
+	data []byte
+	err  error
+}
+
+func (r *amqpReader) take(n int) []byte {
+	if r.err != nil || len(r.data) < n {
+		r.err = errors.New("amqp method arguments too short")
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *amqpReader) octet() byte { return r.take(1)[0] }
+
+func (r *amqpReader) short() uint16 { return binary.BigEndian.Uint16(r.take(2)) }
+
+func (r *amqpReader) long() uint32 { return binary.BigEndian.Uint32(r.take(4)) }
+
+func (r *amqpReader) shortstr() string { return string(r.take(int(r.octet()))) }
+
+func (r *amqpReader) longstr() string {
+	size := r.long()
+	if r.err != nil || uint64(size) > uint64(len(r.data)) {
+		r.err = errors.New("amqp method arguments too short")
+		return ""
+	}
+	return string(r.take(int(size)))
+}
+
+// table - skips a field table, the sink does not use the broker properties
+func (r *amqpReader) table() { r.longstr() }
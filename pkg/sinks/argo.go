@@ -0,0 +1,81 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/tekton"
+)
+
+// argo - private struct, submits a workflow from a WorkflowTemplate through the Argo server api
+// the workflow is labelled with the delivery id like tekton runs
+type argo struct {
+	api       *api
+	template  string
+	namespace string
+	token     string
+	params    map[string]string
+}
+
+// argoSubmit - private struct, the submit request
+type argoSubmit struct {
+	Namespace     string            `json:"namespace"`
+	ResourceKind  string            `json:"resourceKind"`
+	ResourceName  string            `json:"resourceName"`
+	SubmitOptions argoSubmitOptions `json:"submitOptions"`
+}
+
+type argoSubmitOptions struct {
+	Parameters []string `json:"parameters,omitempty"`
+	Labels     string   `json:"labels,omitempty"`
+}
+
+// Publish - submits the template with the params as workflow parameters, the workflow name is returned
+func (a *argo) Publish(ctx context.Context, msg *Message) (string, error) {
+	submit := argoSubmit{Namespace: a.namespace, ResourceKind: "WorkflowTemplate", ResourceName: a.template}
+	for name, value := range a.params {
+		submit.SubmitOptions.Parameters = append(submit.SubmitOptions.Parameters, name+"="+value)
+	}
+	sort.Strings(submit.SubmitOptions.Parameters)
+	if msg.ID != "" {
+		submit.SubmitOptions.Labels = tekton.LABELDELIVERY + "=" + tekton.LabelValue(msg.ID)
+	}
+	data, _ := json.Marshal(submit)
+	req, err := http.NewRequestWithContext(ctx, "POST", a.api.base+"/api/v1/workflows/"+url.PathEscape(a.namespace)+"/submit", bytes.NewBuffer(data))
+	if err != nil {
+		return "", fmt.Errorf("argo submit %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	} else {
+		a.api.authorize(req)
+	}
+	a.api.con.Info("Function argo Publish %s/%s", a.namespace, a.template)
+	resp, err := a.api.con.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("argo submit %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	var workflow struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Message string `json:"message"`
+	}
+	json.Unmarshal(body, &workflow)
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		if workflow.Message == "" {
+			workflow.Message = string(body)
+		}
+		return "", fmt.Errorf("argo submit of %s failed with %d %s", a.template, resp.StatusCode, workflow.Message)
+	}
+	return "workflow " + workflow.Metadata.Name, nil
+}
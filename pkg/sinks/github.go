@@ -0,0 +1,76 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GITHUBAPI - the default api url of github sinks
+const GITHUBAPI string = "https://api.github.com"
+
+// MAXCLIENTPAYLOAD - github accepts at most 10 top level client payload properties
+const MAXCLIENTPAYLOAD int = 10
+
+// github - private struct, starts GitHub Actions workflows, through a workflow_dispatch of the workflow
+// on the ref or, without a workflow, through a repository_dispatch of the event type
+type github struct {
+	api        *api
+	token      string
+	repository string
+	workflow   string
+	eventType  string
+	ref        string
+	params     map[string]string
+}
+
+// Publish - dispatches the workflow with the params as inputs, or the repository event with the params
+// as client payload (the message, usually the binding, is sent as client_payload.binding when there are none)
+func (g *github) Publish(ctx context.Context, msg *Message) (string, error) {
+	var path, done string
+	var request interface{}
+	if g.workflow != "" {
+		path = "/repos/" + g.repository + "/actions/workflows/" + url.PathEscape(g.workflow) + "/dispatches"
+		request = map[string]interface{}{"ref": g.ref, "inputs": g.params}
+		done = "workflow " + g.workflow + " dispatched on " + g.ref
+	} else {
+		payload := map[string]interface{}{}
+		for k, v := range g.params {
+			payload[k] = v
+		}
+		if len(g.params) == 0 && json.Valid(msg.Body) {
+			payload["binding"] = json.RawMessage(msg.Body)
+		}
+		path = "/repos/" + g.repository + "/dispatches"
+		request = map[string]interface{}{"event_type": g.eventType, "client_payload": payload}
+		done = "repository_dispatch " + g.eventType + " sent to " + g.repository
+	}
+	data, _ := json.Marshal(request)
+	req, err := http.NewRequestWithContext(ctx, "POST", g.api.base+path, bytes.NewBuffer(data))
+	if err != nil {
+		return "", fmt.Errorf("github dispatch %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	} else {
+		g.api.authorize(req)
+	}
+	g.api.con.Info("Function github Publish %s", path)
+	resp, err := g.api.con.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("github dispatch %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("github dispatch to %s failed with %d %s", g.repository, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return done, nil
+}
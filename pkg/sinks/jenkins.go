@@ -0,0 +1,102 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// jenkins - private struct, triggers a (parameterised) build of a job through the remote access api
+// a crumb is requested first and sent with the session cookie it belongs to,
+// servers without CSRF protection (no crumb issuer) are triggered without one
+type jenkins struct {
+	api    *api
+	job    string
+	token  string
+	params map[string]string
+}
+
+// crumb - private struct, the crumb issuer response
+type crumb struct {
+	Crumb             string `json:"crumb"`
+	CrumbRequestField string `json:"crumbRequestField"`
+}
+
+// jobPath - private utility function, folder/job becomes /job/folder/job/job
+func jobPath(job string) string {
+	var path string
+	for _, name := range strings.Split(strings.Trim(job, "/"), "/") {
+		path += "/job/" + url.PathEscape(name)
+	}
+	return path
+}
+
+// Publish - posts to buildWithParameters (build when the route has no params), the queue item is returned
+func (j *jenkins) Publish(ctx context.Context, msg *Message) (string, error) {
+	values := url.Values{}
+	for k, v := range j.params {
+		values.Set(k, v)
+	}
+	if j.token != "" {
+		values.Set("token", j.token)
+	}
+	endpoint := "/build"
+	if len(j.params) > 0 {
+		endpoint = "/buildWithParameters"
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", j.api.base+jobPath(j.job)+endpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("jenkins build %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	j.api.authorize(req)
+	if err := j.crumb(ctx, req); err != nil {
+		return "", err
+	}
+	j.api.con.Info("Function jenkins Publish %s", j.job)
+	resp, err := j.api.con.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("jenkins build %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("jenkins build of %s failed with %d %s", j.job, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if location := resp.Header.Get("Location"); location != "" {
+		return "job " + j.job + " queued " + location, nil
+	}
+	return "job " + j.job + " queued", nil
+}
+
+// crumb - private function, adds the crumb header and session cookie to the build request
+func (j *jenkins) crumb(ctx context.Context, build *http.Request) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", j.api.base+"/crumbIssuer/api/json", nil)
+	if err != nil {
+		return fmt.Errorf("jenkins crumb %v", err)
+	}
+	j.api.authorize(req)
+	resp, err := j.api.con.Do(req)
+	if err != nil {
+		return fmt.Errorf("jenkins crumb %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// CSRF protection is disabled
+		return nil
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	var c crumb
+	if resp.StatusCode >= http.StatusMultipleChoices || json.Unmarshal(body, &c) != nil || c.Crumb == "" {
+		return fmt.Errorf("jenkins crumb request failed with %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	build.Header.Set(c.CrumbRequestField, c.Crumb)
+	for _, cookie := range resp.Cookies() {
+		build.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return nil
+}
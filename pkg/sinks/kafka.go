@@ -0,0 +1,72 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// kafka - private struct, produces records through the Kafka REST proxy (v2 api)
+// the body and key are sent base64 encoded (binary embedded format) so that any body can be published
+type kafka struct {
+	api *api
+}
+
+// kafkaRecords - private struct, the produce request
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   []byte `json:"key,omitempty"`
+	Value []byte `json:"value"`
+}
+
+// kafkaOffsets - private struct, the produce response, an error is reported per record
+type kafkaOffsets struct {
+	Offsets []struct {
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"`
+		ErrorCode int    `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+// Publish - produces one record to the topic (the message subject), the partition and offset are returned
+func (k *kafka) Publish(ctx context.Context, msg *Message) (string, error) {
+	record := kafkaRecord{Value: msg.Body}
+	if msg.Key != "" {
+		record.Key = []byte(msg.Key)
+	}
+	data, _ := json.Marshal(kafkaRecords{Records: []kafkaRecord{record}})
+	req, err := http.NewRequestWithContext(ctx, "POST", k.api.base+"/topics/"+url.PathEscape(msg.Subject), bytes.NewBuffer(data))
+	if err != nil {
+		return "", fmt.Errorf("kafka produce %v", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.binary.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	k.api.authorize(req)
+	k.api.con.Info("Function kafka Publish %s", msg.Subject)
+	resp, err := k.api.con.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("kafka produce %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return "", fmt.Errorf("kafka produce to %s failed with %d %s", msg.Subject, resp.StatusCode, body)
+	}
+	var offsets kafkaOffsets
+	if err = json.Unmarshal(body, &offsets); err != nil || len(offsets.Offsets) == 0 {
+		return "", fmt.Errorf("kafka produce to %s was not acknowledged %s", msg.Subject, body)
+	}
+	o := offsets.Offsets[0]
+	if o.Error != "" || o.ErrorCode != 0 {
+		return "", fmt.Errorf("kafka produce to %s failed with %d %s", msg.Subject, o.ErrorCode, o.Error)
+	}
+	return fmt.Sprintf("topic %s partition %d offset %d", msg.Subject, o.Partition, o.Offset), nil
+}
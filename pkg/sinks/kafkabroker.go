@@ -0,0 +1,455 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KAFKATIMEOUT - bounds a produce when the context has no deadline
+const KAFKATIMEOUT time.Duration = 10 * time.Second
+
+// KAFKAPORT - the default broker port
+const KAFKAPORT string = "9092"
+
+// MAXKAFKARESPONSE - the largest response read from a broker
+const MAXKAFKARESPONSE int32 = 16 << 20
+
+// kafka api keys, the sink sends produce v3 (record batch v2), metadata v4, sasl handshake v1 and sasl authenticate v0
+const (
+	kafkaProduce          int16 = 0
+	kafkaMetadata         int16 = 3
+	kafkaSaslHandshake    int16 = 17
+	kafkaSaslAuthenticate int16 = 36
+)
+
+// kafkaErrors - the names of the error codes a produce usually fails with
+var kafkaErrors = map[int16]string{
+	2:  "CORRUPT_MESSAGE",
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_OR_FOLLOWER",
+	7:  "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE",
+	17: "INVALID_TOPIC_EXCEPTION",
+	19: "NOT_ENOUGH_REPLICAS",
+	20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+	33: "UNSUPPORTED_SASL_MECHANISM",
+	35: "UNSUPPORTED_VERSION",
+	58: "SASL_AUTHENTICATION_FAILED",
+}
+
+// kafkaBroker - private struct, produces records over the Kafka protocol
+// a connection is opened per message to the first bootstrap broker that answers, the topic metadata gives the leader
+// of the partition the key hashes to (murmur2, like the Java client) and the record is produced with acks all, so the
+// returned offset means every in sync replica stored it; credentials in the url are sent with SASL PLAIN (no tls)
+type kafkaBroker struct {
+	brokers  []string
+	user     string
+	password string
+}
+
+// newKafkaBroker - private utility function, the url host is a comma separated list of bootstrap brokers
+func newKafkaBroker(u *url.URL) *kafkaBroker {
+	k := &kafkaBroker{}
+	for _, host := range strings.Split(u.Host, ",") {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), KAFKAPORT)
+		}
+		k.brokers = append(k.brokers, host)
+	}
+	if u.User != nil {
+		k.user = u.User.Username()
+		k.password, _ = u.User.Password()
+	}
+	return k
+}
+
+// Publish - produces one record to the topic (the message subject) with the message headers as record headers,
+// the record is keyed by the message key (the id picks the partition when there is none)
+func (k *kafkaBroker) Publish(ctx context.Context, msg *Message) (string, error) {
+	topic := msg.Subject
+	if topic == "" || len(topic) > 249 || strings.ContainsAny(topic, " \t\r\n/") {
+		return "", fmt.Errorf("kafka topic %q is empty, too long or not a valid name", topic)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(KAFKATIMEOUT)
+	}
+	var conn *kafkaConn
+	var err error
+	for _, addr := range k.brokers {
+		if conn, err = k.dial(ctx, addr, deadline); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	defer func() { conn.Close() }()
+
+	brokers, partitions, err := conn.metadata(topic)
+	if err != nil {
+		return "", err
+	}
+	var key []byte
+	hashed := []byte(msg.ID)
+	if msg.Key != "" {
+		key = []byte(msg.Key)
+		hashed = key
+	}
+	partition := (murmur2(hashed) & 0x7fffffff) % int32(len(partitions))
+	leader, ok := brokers[partitions[partition]]
+	if partitions[partition] < 0 || !ok {
+		return "", fmt.Errorf("kafka topic %s partition %d has no leader", topic, partition)
+	}
+	if leader != conn.addr {
+		conn.Close()
+		if conn, err = k.dial(ctx, leader, deadline); err != nil {
+			return "", err
+		}
+	}
+	offset, err := conn.produce(topic, partition, recordBatch(msg, key, time.Now()), time.Until(deadline))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("topic %s partition %d offset %d", topic, partition, offset), nil
+}
+
+// dial - private function, connects to the broker and authenticates when the url carried credentials
+func (k *kafkaBroker) dial(ctx context.Context, addr string, deadline time.Time) (*kafkaConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("kafka connect %v", err)
+	}
+	conn.SetDeadline(deadline)
+	c := &kafkaConn{Conn: conn, addr: addr}
+	if k.user != "" {
+		if err = c.authenticate(k.user, k.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// kafkaConn - private struct, a broker connection and the last request correlation id
+type kafkaConn struct {
+	net.Conn
+	addr        string
+	correlation int32
+}
+
+// authenticate - private function, SASL PLAIN through the handshake and authenticate requests
+func (c *kafkaConn) authenticate(user string, password string) error {
+	var w kafkaWriter
+	w.str("PLAIN")
+	r, err := c.roundTrip(kafkaSaslHandshake, 1, w.Bytes())
+	if err != nil {
+		return err
+	}
+	if code := r.int16(); code != 0 {
+		return kafkaError("kafka sasl handshake", code, "")
+	}
+	w.Reset()
+	w.bytes([]byte("\x00" + user + "\x00" + password))
+	if r, err = c.roundTrip(kafkaSaslAuthenticate, 0, w.Bytes()); err != nil {
+		return err
+	}
+	if code := r.int16(); code != 0 {
+		return kafkaError("kafka sasl authenticate", code, r.str())
+	}
+	return nil
+}
+
+// metadata - private function, the broker addresses by node id and the leader of each partition of the topic
+func (c *kafkaConn) metadata(topic string) (map[int32]string, []int32, error) {
+	var w kafkaWriter
+	w.int32(1)
+	w.str(topic)
+	w.int8(0) // the topic is not created
+	r, err := c.roundTrip(kafkaMetadata, 4, w.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	r.int32()
+	brokers := map[int32]string{}
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		id, host, port := r.int32(), r.str(), r.int32()
+		r.str()
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	r.str()
+	r.int32()
+	type partition struct{ index, leader int32 }
+	var partitions []partition
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		code, name := r.int16(), r.str()
+		r.int8()
+		if name == topic && code != 0 {
+			return nil, nil, kafkaError("kafka topic "+topic+" metadata", code, "")
+		}
+		for m := r.int32(); m > 0 && r.err == nil; m-- {
+			r.int16()
+			p := partition{index: r.int32(), leader: r.int32()}
+			r.skip(4 * int(r.int32()))
+			r.skip(4 * int(r.int32()))
+			if name == topic {
+				partitions = append(partitions, p)
+			}
+		}
+	}
+	if r.err != nil {
+		return nil, nil, fmt.Errorf("kafka metadata %v", r.err)
+	}
+	if len(partitions) == 0 {
+		return nil, nil, kafkaError("kafka topic "+topic+" metadata", 3, "")
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].index < partitions[j].index })
+	leaders := make([]int32, len(partitions))
+	for i, p := range partitions {
+		leaders[i] = p.leader
+	}
+	return brokers, leaders, nil
+}
+
+// produce - private function, produces the record batch with acks all and returns its offset
+func (c *kafkaConn) produce(topic string, partition int32, batch []byte, timeout time.Duration) (int64, error) {
+	if timeout < time.Millisecond {
+		timeout = time.Millisecond
+	}
+	var w kafkaWriter
+	w.int16(-1) // no transactional id
+	w.int16(-1) // acks all
+	w.int32(int32(timeout / time.Millisecond))
+	w.int32(1)
+	w.str(topic)
+	w.int32(1)
+	w.int32(partition)
+	w.bytes(batch)
+	r, err := c.roundTrip(kafkaProduce, 3, w.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		name := r.str()
+		for m := r.int32(); m > 0 && r.err == nil; m-- {
+			index, code, offset := r.int32(), r.int16(), r.int64()
+			r.int64()
+			if name == topic && index == partition && r.err == nil {
+				if code != 0 {
+					return 0, kafkaError(fmt.Sprintf("kafka produce to %s partition %d", topic, partition), code, "")
+				}
+				return offset, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("kafka produce to %s was not acknowledged %v", topic, r.err)
+}
+
+// roundTrip - private function, sends the request (header v1) and reads the response of the same correlation id
+func (c *kafkaConn) roundTrip(api int16, version int16, body []byte) (*kafkaReader, error) {
+	c.correlation++
+	var w kafkaWriter
+	w.int32(0)
+	w.int16(api)
+	w.int16(version)
+	w.int32(c.correlation)
+	w.str("golang-gitwebhook-service")
+	w.Write(body)
+	request := w.Bytes()
+	binary.BigEndian.PutUint32(request, uint32(len(request)-4))
+	if _, err := c.Write(request); err != nil {
+		return nil, fmt.Errorf("kafka write %v", err)
+	}
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(c, size); err != nil {
+		return nil, fmt.Errorf("kafka read %v", err)
+	}
+	n := int32(binary.BigEndian.Uint32(size))
+	if n < 4 || n > MAXKAFKARESPONSE {
+		return nil, fmt.Errorf("kafka response of %d bytes is not valid", n)
+	}
+	response := make([]byte, n)
+	if _, err := io.ReadFull(c, response); err != nil {
+		return nil, fmt.Errorf("kafka read %v", err)
+	}
+	if int32(binary.BigEndian.Uint32(response)) != c.correlation {
+		return nil, errors.New("kafka response correlation id does not match the request")
+	}
+	return &kafkaReader{data: response[4:]}, nil
+}
+
+// kafkaError - private utility function, the error code with its name and the broker message
+func kafkaError(context string, code int16, message string) error {
+	name := kafkaErrors[code]
+	if name == "" {
+		name = "error"
+	}
+	if message != "" {
+		return fmt.Errorf("%s failed with %d %s %s", context, code, name, message)
+	}
+	return fmt.Errorf("%s failed with %d %s", context, code, name)
+}
+
+// recordBatch - private utility function, a v2 record batch of the message, the crc covers the attributes onwards
+func recordBatch(msg *Message, key []byte, timestamp time.Time) []byte {
+	var record kafkaWriter
+	record.int8(0)
+	record.varint(0)
+	record.varint(0)
+	if key == nil {
+		record.varint(-1)
+	} else {
+		record.varint(int64(len(key)))
+		record.Write(key)
+	}
+	record.varint(int64(len(msg.Body)))
+	record.Write(msg.Body)
+	names := make([]string, 0, len(msg.Headers))
+	for name := range msg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	record.varint(int64(len(names)))
+	for _, name := range names {
+		record.varint(int64(len(name)))
+		record.WriteString(name)
+		record.varint(int64(len(msg.Headers[name])))
+		record.WriteString(msg.Headers[name])
+	}
+
+	ms := timestamp.UnixNano() / int64(time.Millisecond)
+	var batch kafkaWriter
+	batch.int16(0)  // attributes, no compression
+	batch.int32(0)  // last offset delta
+	batch.int64(ms) // first and max timestamp
+	batch.int64(ms)
+	batch.int64(-1) // no producer id, epoch and sequence
+	batch.int16(-1)
+	batch.int32(-1)
+	batch.int32(1)
+	batch.varint(int64(record.Len()))
+	batch.Write(record.Bytes())
+
+	var w kafkaWriter
+	w.int64(0)
+	w.int32(int32(4 + 1 + 4 + batch.Len()))
+	w.int32(-1) // partition leader epoch
+	w.int8(2)   // magic
+	w.int32(int32(crc32.Checksum(batch.Bytes(), crc32.MakeTable(crc32.Castagnoli))))
+	w.Write(batch.Bytes())
+	return w.Bytes()
+}
+
+// murmur2 - private utility function, the hash the Java client default partitioner uses for keys
+func murmur2(data []byte) int32 {
+	const m uint32 = 0x5bd1e995
+	length := len(data)
+	h := uint32(0x9747b28c) ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> 24
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// kafkaWriter - private struct, encodes the Kafka protocol types
+type kafkaWriter struct {
+	bytes.Buffer
+}
+
+func (w *kafkaWriter) int8(v int8) { w.WriteByte(byte(v)) }
+
+func (w *kafkaWriter) int16(v int16) { binary.Write(w, binary.BigEndian, v) }
+
+func (w *kafkaWriter) int32(v int32) { binary.Write(w, binary.BigEndian, v) }
+
+func (w *kafkaWriter) int64(v int64) { binary.Write(w, binary.BigEndian, v) }
+
+// varint - zig-zag encoded, as binary.PutVarint does
+func (w *kafkaWriter) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	w.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func (w *kafkaWriter) str(s string) {
+	w.int16(int16(len(s)))
+	w.WriteString(s)
+}
+
+func (w *kafkaWriter) bytes(b []byte) {
+	w.int32(int32(len(b)))
+	w.Write(b)
+}
+
+// kafkaReader - private struct, decodes the Kafka protocol types, err is set once the data is too short
+type kafkaReader struct {
+	data []byte
+	err  error
+}
+
+func (r *kafkaReader) take(n int) []byte {
+	if r.err != nil || n < 0 || len(r.data) < n {
+		r.err = errors.New("kafka response too short")
+		return make([]byte, 8)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// skip - n is the size of an array, a null array (-1) has nothing to skip
+func (r *kafkaReader) skip(n int) {
+	if n > 0 {
+		r.take(n)
+	}
+}
+
+func (r *kafkaReader) int8() int8 { return int8(r.take(1)[0]) }
+
+func (r *kafkaReader) int16() int16 { return int16(binary.BigEndian.Uint16(r.take(2))) }
+
+func (r *kafkaReader) int32() int32 { return int32(binary.BigEndian.Uint32(r.take(4))) }
+
+func (r *kafkaReader) int64() int64 { return int64(binary.BigEndian.Uint64(r.take(8))) }
+
+// str - a string or a nullable string, null is empty
+func (r *kafkaReader) str() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.take(int(n)))
+}
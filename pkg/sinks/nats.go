@@ -0,0 +1,202 @@
+package sinks
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NATSTIMEOUT - bounds a publish when the context has no deadline
+const NATSTIMEOUT time.Duration = 10 * time.Second
+
+// NATSPORT - the default client port
+const NATSPORT string = "4222"
+
+// nats - private struct, publishes over the nats text protocol
+// a connection is opened per message, the server acknowledges the publish (verbose mode)
+// and the PONG to the trailing PING confirms it was processed; with a stream the publish is
+// a JetStream request instead and only the stream acknowledgement (PubAck) confirms it was stored
+type nats struct {
+	addr     string
+	user     string
+	password string
+	token    string
+	stream   string
+}
+
+// natsPubAck - private struct, the JetStream publish acknowledgement
+type natsPubAck struct {
+	Stream    string `json:"stream"`
+	Sequence  uint64 `json:"seq"`
+	Duplicate bool   `json:"duplicate"`
+	Error     *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// newNATS - private utility function, a user without password is sent as the auth token
+func newNATS(u *url.URL, stream string) *nats {
+	n := &nats{addr: u.Host, stream: stream}
+	if u.Port() == "" {
+		n.addr = net.JoinHostPort(u.Hostname(), NATSPORT)
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			n.user, n.password = u.User.Username(), password
+		} else {
+			n.token = u.User.Username()
+		}
+	}
+	return n
+}
+
+// natsInfo - private struct, the fields of the server INFO the sink uses
+type natsInfo struct {
+	Headers     bool  `json:"headers"`
+	MaxPayload  int64 `json:"max_payload"`
+	TLSRequired bool  `json:"tls_required"`
+}
+
+// Publish - sends CONNECT, PUB (HPUB with the headers when the server supports them) and PING,
+// a JetStream publish subscribes to a reply inbox first and sends the delivery id as Nats-Msg-Id
+// so that the stream stores a redelivered event once
+func (n *nats) Publish(ctx context.Context, msg *Message) (string, error) {
+	if msg.Subject == "" || strings.ContainsAny(msg.Subject, " \t\r\n") {
+		return "", fmt.Errorf("nats subject %q is empty or contains whitespace", msg.Subject)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return "", fmt.Errorf("nats connect %v", err)
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(NATSTIMEOUT)
+	}
+	conn.SetDeadline(deadline)
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		return "", fmt.Errorf("nats server did not send INFO %q %v", strings.TrimSpace(line), err)
+	}
+	var info natsInfo
+	json.Unmarshal([]byte(strings.TrimSpace(line[5:])), &info)
+	if info.TLSRequired {
+		return "", fmt.Errorf("nats server %s requires tls, which the sink does not support", n.addr)
+	}
+	if info.MaxPayload > 0 && int64(len(msg.Body)) > info.MaxPayload {
+		return "", fmt.Errorf("nats message of %d bytes exceeds the max payload of %d", len(msg.Body), info.MaxPayload)
+	}
+	if n.stream != "" && !info.Headers {
+		return "", fmt.Errorf("nats server %s does not support headers, which JetStream publishes need", n.addr)
+	}
+
+	options := map[string]interface{}{"verbose": true, "pedantic": false, "name": "golang-gitwebhook-service", "lang": "go", "protocol": 1,
+		"headers": info.Headers, "no_responders": info.Headers}
+	if n.token != "" {
+		options["auth_token"] = n.token
+	} else if n.user != "" {
+		options["user"], options["pass"] = n.user, n.password
+	}
+	connect, _ := json.Marshal(options)
+	var out strings.Builder
+	out.WriteString("CONNECT " + string(connect) + "\r\n")
+	headers, subject := msg.Headers, msg.Subject
+	if n.stream != "" {
+		inbox := make([]byte, 12)
+		rand.Read(inbox)
+		reply := "_INBOX." + hex.EncodeToString(inbox)
+		headers = map[string]string{"Nats-Expected-Stream": n.stream}
+		if msg.ID != "" {
+			headers["Nats-Msg-Id"] = msg.ID
+		}
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+		fmt.Fprintf(&out, "SUB %s 1\r\n", reply)
+		subject += " " + reply
+	}
+	if info.Headers && len(headers) > 0 {
+		var hdr strings.Builder
+		hdr.WriteString("NATS/1.0\r\n")
+		for k, v := range headers {
+			hdr.WriteString(k + ": " + v + "\r\n")
+		}
+		hdr.WriteString("\r\n")
+		fmt.Fprintf(&out, "HPUB %s %d %d\r\n%s%s\r\n", subject, hdr.Len(), hdr.Len()+len(msg.Body), hdr.String(), msg.Body)
+	} else {
+		fmt.Fprintf(&out, "PUB %s %d\r\n%s\r\n", msg.Subject, len(msg.Body), msg.Body)
+	}
+	out.WriteString("PING\r\n")
+	if _, err = conn.Write([]byte(out.String())); err != nil {
+		return "", fmt.Errorf("nats publish %v", err)
+	}
+
+	for {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("nats publish not acknowledged %v", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "-ERR"):
+			return "", errors.New("nats " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		case line == "PING":
+			conn.Write([]byte("PONG\r\n"))
+		case line == "PONG" && n.stream == "":
+			return "subject " + msg.Subject, nil
+		case strings.HasPrefix(line, "MSG ") || strings.HasPrefix(line, "HMSG "):
+			return n.acknowledged(r, line, msg.Subject)
+		}
+	}
+}
+
+// acknowledged - private function, reads the reply to a JetStream publish: the PubAck, an error or, when no stream
+// captures the subject, the 503 no responders status
+func (n *nats) acknowledged(r *bufio.Reader, line string, subject string) (string, error) {
+	fields := strings.Fields(line)
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || size < 0 {
+		return "", fmt.Errorf("nats reply %q is not valid", line)
+	}
+	data := make([]byte, size+2)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return "", fmt.Errorf("nats publish not acknowledged %v", err)
+	}
+	data = data[:size]
+	if fields[0] == "HMSG" {
+		hdr, _ := strconv.Atoi(fields[len(fields)-2])
+		if hdr > size {
+			return "", fmt.Errorf("nats reply %q is not valid", line)
+		}
+		status := strings.Fields(strings.SplitN(string(data[:hdr]), "\r\n", 2)[0])
+		if len(status) > 1 && status[1] == "503" {
+			return "", fmt.Errorf("nats no stream captures subject %s (expected stream %s)", subject, n.stream)
+		}
+		data = data[hdr:]
+	}
+	var ack natsPubAck
+	if err = json.Unmarshal(data, &ack); err != nil {
+		return "", fmt.Errorf("nats publish to stream %s was not acknowledged %s", n.stream, data)
+	}
+	if ack.Error != nil {
+		return "", fmt.Errorf("nats stream %s refused the publish %d %s", n.stream, ack.Error.Code, ack.Error.Description)
+	}
+	if ack.Duplicate {
+		return fmt.Sprintf("stream %s sequence %d (duplicate)", ack.Stream, ack.Sequence), nil
+	}
+	return fmt.Sprintf("stream %s sequence %d", ack.Stream, ack.Sequence), nil
+}
@@ -0,0 +1,87 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// RABBITMQEXCHANGE - the default (direct) exchange as named by the RabbitMQ management api
+const RABBITMQEXCHANGE string = "amq.default"
+
+// ErrNotRouted - the broker accepted the message but no queue is bound for its routing key
+var ErrNotRouted = errors.New("rabbitmq message was not routed to any queue")
+
+// rabbitmq - private struct, publishes to an exchange through the RabbitMQ management http api (the amqp sink speaks AMQP)
+// messages are persistent and the broker reports whether a queue received them, but the api has no publisher
+// confirms, a routed message can still be lost if the broker fails before writing it to disk
+type rabbitmq struct {
+	api      *api
+	exchange string
+	vhost    string
+}
+
+// rabbitmqPublish - private struct, the publish request
+type rabbitmqPublish struct {
+	Properties      rabbitmqProperties `json:"properties"`
+	RoutingKey      string             `json:"routing_key"`
+	Payload         []byte             `json:"payload"`
+	PayloadEncoding string             `json:"payload_encoding"`
+}
+
+type rabbitmqProperties struct {
+	MessageID    string            `json:"message_id,omitempty"`
+	ContentType  string            `json:"content_type,omitempty"`
+	DeliveryMode int               `json:"delivery_mode"`
+	Headers      map[string]string `json:"headers,omitempty"`
+}
+
+// Publish - publishes the message with the subject as routing key, an unrouted message is an error
+func (a *rabbitmq) Publish(ctx context.Context, msg *Message) (string, error) {
+	exchange, vhost := a.exchange, a.vhost
+	if exchange == "" {
+		exchange = RABBITMQEXCHANGE
+	}
+	if vhost == "" {
+		vhost = "/"
+	}
+	publish := rabbitmqPublish{
+		Properties:      rabbitmqProperties{MessageID: msg.ID, ContentType: msg.Headers["Content-Type"], DeliveryMode: 2, Headers: msg.Headers},
+		RoutingKey:      msg.Subject,
+		Payload:         msg.Body,
+		PayloadEncoding: "base64",
+	}
+	data, _ := json.Marshal(publish)
+	path := "/api/exchanges/" + url.PathEscape(vhost) + "/" + url.PathEscape(exchange) + "/publish"
+	req, err := http.NewRequestWithContext(ctx, "POST", a.api.base+path, bytes.NewBuffer(data))
+	if err != nil {
+		return "", fmt.Errorf("rabbitmq publish %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	a.api.authorize(req)
+	a.api.con.Info("Function rabbitmq Publish %s %s", exchange, msg.Subject)
+	resp, err := a.api.con.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("rabbitmq publish %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return "", fmt.Errorf("rabbitmq publish to %s failed with %d %s", exchange, resp.StatusCode, body)
+	}
+	var result struct {
+		Routed bool `json:"routed"`
+	}
+	if err = json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("rabbitmq publish to %s was not acknowledged %s", exchange, body)
+	}
+	if !result.Routed {
+		return "", ErrNotRouted
+	}
+	return "exchange " + exchange + " routing key " + msg.Subject, nil
+}
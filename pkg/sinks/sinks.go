@@ -0,0 +1,98 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+)
+
+// Message - a normalised event as published to a broker
+// Subject is the NATS subject, Kafka topic or RabbitMQ routing key and Key the Kafka record key
+type Message struct {
+	ID      string
+	Subject string
+	Key     string
+	Body    []byte
+	Headers map[string]string
+}
+
+// Sink - publishes messages to a broker or triggers a build, Publish returns once the broker (build system)
+// acknowledged the message and describes where it went (the Kafka partition and offset, the queued Jenkins build ...)
+type Sink interface {
+	Publish(ctx context.Context, msg *Message) (string, error)
+}
+
+// Types - the supported sink types
+var Types = []string{config.NATS, config.KAFKA, config.AMQP, config.RABBITMQHTTP, config.JENKINS, config.ARGO, config.GITHUB}
+
+// New - returns the sink of the type for the broker (or build system) url, sink is the route sink with its templates executed
+// the http based sinks (all but nats, amqp and kafka:// brokers) go through connectors.Clients so that they can be faked in tests
+func New(brokerURL string, sink *config.Sink, con connectors.Clients) (Sink, error) {
+	if brokerURL == "" && sink.Type == config.GITHUB {
+		brokerURL = GITHUBAPI
+	}
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return nil, fmt.Errorf("sink url %v", err)
+	}
+	switch sink.Type {
+	case config.NATS:
+		if u.Scheme != "nats" {
+			return nil, fmt.Errorf("nats sink url %q should be nats:// (tls is not supported)", brokerURL)
+		}
+		return newNATS(u, sink.Stream), nil
+	case config.KAFKA:
+		if u.Scheme == "kafka" {
+			return newKafkaBroker(u), nil
+		}
+		return &kafka{api: newAPI(u, con)}, nil
+	case config.AMQP:
+		if u.Scheme != "amqp" {
+			return nil, fmt.Errorf("amqp sink url %q should be amqp:// (tls is not supported)", brokerURL)
+		}
+		return newAMQP(u, sink.Exchange, sink.VHost), nil
+	case config.RABBITMQHTTP:
+		return &rabbitmq{api: newAPI(u, con), exchange: sink.Exchange, vhost: sink.VHost}, nil
+	case config.JENKINS:
+		return &jenkins{api: newAPI(u, con), job: sink.Job, token: sink.Token, params: sink.Params}, nil
+	case config.ARGO:
+		return &argo{api: newAPI(u, con), template: sink.Template, namespace: sink.Namespace, token: sink.Token, params: sink.Params}, nil
+	case config.GITHUB:
+		return &github{api: newAPI(u, con), token: sink.Token, repository: sink.Repository, workflow: sink.Workflow,
+			eventType: sink.Subject, ref: sink.Ref, params: sink.Params}, nil
+	}
+	return nil, fmt.Errorf("sink type %q should be one of %s", sink.Type, strings.Join(Types, ", "))
+}
+
+// api - private struct, an http api with the credentials taken out of its url
+type api struct {
+	base     string
+	user     string
+	password string
+	con      connectors.Clients
+}
+
+// newAPI - private utility function, the user info is sent as basic auth instead of in the url
+func newAPI(u *url.URL, con connectors.Clients) *api {
+	a := &api{con: con}
+	if u.User != nil {
+		a.user = u.User.Username()
+		a.password, _ = u.User.Password()
+	}
+	base := *u
+	base.User = nil
+	a.base = strings.TrimSuffix(base.String(), "/")
+	return a
+}
+
+// authorize - private function, sets the basic auth header when the url carried credentials
+func (a *api) authorize(req *http.Request) {
+	if a.user != "" {
+		req.SetBasicAuth(a.user, a.password)
+	}
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// AuditEntry - a recorded decision on a held or forwarded event
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Tenant string    `json:"tenant"`
+	Route  string    `json:"route"`
+	ID     string    `json:"id"`
+	Action string    `json:"action"`
+	Actor  string    `json:"actor,omitempty"`
+	Detail string    `json:"detail"`
+}
+
+// Audit - bounded in memory audit trail, the oldest entries are dropped once max is reached
+type Audit struct {
+	mutex   sync.Mutex
+	max     int
+	entries []AuditEntry
+}
+
+// NewAudit - returns an empty audit trail
+func NewAudit(max int) *Audit {
+	return &Audit{max: max}
+}
+
+// Add - records the entry
+func (a *Audit) Add(entry AuditEntry) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	a.entries = append(a.entries, entry)
+	if len(a.entries) > a.max {
+		a.entries = a.entries[len(a.entries)-a.max:]
+	}
+}
+
+// List - returns the entries, of all tenants when tenant is empty, oldest first
+func (a *Audit) List(tenant string) []AuditEntry {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	list := []AuditEntry{}
+	for _, e := range a.entries {
+		if tenant == "" || e.Tenant == tenant {
+			list = append(list, e)
+		}
+	}
+	return list
+}
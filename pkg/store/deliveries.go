@@ -0,0 +1,110 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+)
+
+// Delivery - a forwarded event, kept so that pipeline callbacks can be tied
+// back to the webhook delivery that started the run
+type Delivery struct {
+	ID        string             `json:"id"`
+	WebhookID string             `json:"webhookid"`
+	Tenant    string             `json:"tenant"`
+	Provider  string             `json:"provider"`
+	Event     string             `json:"event"`
+	Repo      string             `json:"repo"`
+	Sha       string             `json:"sha"`
+	PRNumber  int                `json:"prnumber"`
+	Route     string             `json:"route"`
+	URL       string             `json:"url"`
+	CheckRun  int64              `json:"checkrun,omitempty"`
+	Binding   *schema.MapBinding `json:"binding"`
+	// Body and Headers hold the rendered route template, the binding is posted when Body is empty
+	Body    []byte            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Sink is the route sink with its subject and key rendered, the event is published instead of posted
+	Sink *config.Sink `json:"sink,omitempty"`
+	// Tekton routes create the run held in Body, Run is the name of the run last created
+	Tekton  *config.Tekton `json:"tekton,omitempty"`
+	Run     string         `json:"run,omitempty"`
+	Created time.Time      `json:"created"`
+}
+
+// Deliveries - bounded in memory delivery store, entries expire after ttl
+// and the oldest entries of a tenant are evicted once it has max entries
+type Deliveries struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[string]*Delivery
+}
+
+// NewDeliveries - returns an empty store
+func NewDeliveries(ttl time.Duration, max int) *Deliveries {
+	return &Deliveries{ttl: ttl, max: max, entries: make(map[string]*Delivery)}
+}
+
+// Put - adds or replaces the delivery, a copy is stored
+func (d *Deliveries) Put(delivery *Delivery) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if delivery.Created.IsZero() {
+		delivery.Created = time.Now()
+	}
+	entry := *delivery
+	d.entries[delivery.ID] = &entry
+	d.expire(delivery.Tenant)
+}
+
+// Get - returns a copy of the delivery or nil when unknown or expired
+// changes are only kept once the copy is Put back
+func (d *Deliveries) Get(id string) *Delivery {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delivery, ok := d.entries[id]
+	if !ok || time.Since(delivery.Created) > d.ttl {
+		return nil
+	}
+	entry := *delivery
+	return &entry
+}
+
+// FindBySha - returns copies of the tenant deliveries made for the repo commit, oldest first
+func (d *Deliveries) FindBySha(tenant string, repo string, sha string) []*Delivery {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	var list []*Delivery
+	for _, delivery := range d.entries {
+		if delivery.Tenant == tenant && delivery.Repo == repo && delivery.Sha == sha && time.Since(delivery.Created) <= d.ttl {
+			entry := *delivery
+			list = append(list, &entry)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list
+}
+
+// expire - private function, drops the expired entries and evicts the oldest of the tenant
+// over max, must be called with the lock held
+func (d *Deliveries) expire(tenant string) {
+	var list []*Delivery
+	for id, delivery := range d.entries {
+		if time.Since(delivery.Created) > d.ttl {
+			delete(d.entries, id)
+		} else if delivery.Tenant == tenant {
+			list = append(list, delivery)
+		}
+	}
+	if len(list) <= d.max {
+		return
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	for _, delivery := range list[:len(list)-d.max] {
+		delete(d.entries, delivery.ID)
+	}
+}
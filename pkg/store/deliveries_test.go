@@ -0,0 +1,48 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDeliveries(t *testing.T) {
+
+	t.Run("Get : should pass", func(t *testing.T) {
+		d := NewDeliveries(time.Hour, 10)
+		d.Put(&Delivery{ID: "abc-pr-opened", WebhookID: "abc"})
+		delivery := d.Get("abc-pr-opened")
+		if delivery == nil || delivery.WebhookID != "abc" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect delivery - got (%v) wanted (%s)", "Get", delivery, "abc"))
+		}
+	})
+
+	t.Run("Get : should fail (expired)", func(t *testing.T) {
+		d := NewDeliveries(time.Minute, 10)
+		d.Put(&Delivery{ID: "old", Created: time.Now().Add(-time.Hour)})
+		if delivery := d.Get("old"); delivery != nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned expired delivery - got (%v) wanted (%v)", "Get", delivery, nil))
+		}
+	})
+
+	t.Run("Put : should evict the oldest", func(t *testing.T) {
+		d := NewDeliveries(time.Hour, 2)
+		d.Put(&Delivery{ID: "1", Created: time.Now().Add(-3 * time.Minute)})
+		d.Put(&Delivery{ID: "2", Created: time.Now().Add(-2 * time.Minute)})
+		d.Put(&Delivery{ID: "3"})
+		if d.Get("1") != nil || d.Get("2") == nil || d.Get("3") == nil {
+			t.Errorf(fmt.Sprintf("Handler %s did not evict the oldest delivery", "Put"))
+		}
+	})
+
+	t.Run("Put : should pass (other tenants are not evicted)", func(t *testing.T) {
+		d := NewDeliveries(time.Hour, 2)
+		d.Put(&Delivery{ID: "a-1", Tenant: "team-a", Created: time.Now().Add(-time.Hour / 2)})
+		for x := 0; x < 5; x++ {
+			d.Put(&Delivery{ID: fmt.Sprintf("b-%d", x), Tenant: "team-b"})
+		}
+		if d.Get("a-1") == nil || d.Get("b-4") == nil || d.Get("b-0") != nil {
+			t.Errorf(fmt.Sprintf("Handler %s evicted the deliveries of another tenant", "Put"))
+		}
+	})
+}
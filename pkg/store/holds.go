@@ -0,0 +1,67 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// hold - private struct, the user that held the pull request and when
+type hold struct {
+	user    string
+	created time.Time
+}
+
+// Holds - pull requests whose deliveries are paused (chatops /hold), keyed by HoldKey, entries expire ttl after they were set
+type Holds struct {
+	mutex sync.Mutex
+	ttl   time.Duration
+	held  map[string]*hold
+}
+
+// NewHolds - returns an empty hold list
+func NewHolds(ttl time.Duration) *Holds {
+	return &Holds{ttl: ttl, held: make(map[string]*hold)}
+}
+
+// HoldKey - the key of a tenant pull request
+func HoldKey(tenant string, repo string, number int) string {
+	return fmt.Sprintf("%s/%s#%d", tenant, repo, number)
+}
+
+// TrustKey - the key of a tenant pull request head commit, trust given to a pull request only covers that commit
+func TrustKey(tenant string, repo string, number int, sha string) string {
+	return fmt.Sprintf("%s@%s", HoldKey(tenant, repo, number), sha)
+}
+
+// Hold - pauses deliveries, user is kept for reporting, the expired holds are dropped
+func (h *Holds) Hold(key string, user string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.held[key] = &hold{user: user, created: time.Now()}
+	for k, entry := range h.held {
+		if time.Since(entry.created) > h.ttl {
+			delete(h.held, k)
+		}
+	}
+}
+
+// Release - resumes deliveries, false is returned when nothing was held
+func (h *Holds) Release(key string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	entry, ok := h.held[key]
+	delete(h.held, key)
+	return ok && time.Since(entry.created) <= h.ttl
+}
+
+// Held - returns the user that held the pull request, expired holds are not reported
+func (h *Holds) Held(key string) (string, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	entry, ok := h.held[key]
+	if !ok || time.Since(entry.created) > h.ttl {
+		return "", false
+	}
+	return entry.user, true
+}
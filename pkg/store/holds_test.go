@@ -0,0 +1,39 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHolds(t *testing.T) {
+
+	t.Run("Hold : should pass (held until released)", func(t *testing.T) {
+		h := NewHolds(time.Hour)
+		key := HoldKey("default", "owner/repo", 1)
+		h.Hold(key, "octocat")
+		if user, ok := h.Held(key); !ok || user != "octocat" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect hold - got (%s %t)", "Held", user, ok))
+		}
+		if !h.Release(key) || h.Release(key) {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect results", "Release"))
+		}
+		if _, ok := h.Held(key); ok {
+			t.Errorf(fmt.Sprintf("Handler %s reported a released hold", "Held"))
+		}
+	})
+
+	t.Run("Hold : should pass (expired holds are forgotten)", func(t *testing.T) {
+		h := NewHolds(10 * time.Millisecond)
+		old, key := HoldKey("default", "owner/repo", 2), HoldKey("default", "owner/repo", 3)
+		h.Hold(old, "octocat")
+		time.Sleep(20 * time.Millisecond)
+		if _, ok := h.Held(old); ok {
+			t.Errorf(fmt.Sprintf("Handler %s reported an expired hold", "Held"))
+		}
+		h.Hold(key, "octocat")
+		if len(h.held) != 1 || h.Release(old) {
+			t.Errorf(fmt.Sprintf("Handler %s did not evict the expired hold - got (%d)", "Hold", len(h.held)))
+		}
+	})
+}
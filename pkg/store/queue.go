@@ -0,0 +1,94 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+)
+
+// Pending - an event held back from a route (until it is approved or a freeze window ends)
+// ID is the delivery id the event gets once it is forwarded
+type Pending struct {
+	ID      string             `json:"id"`
+	Tenant  string             `json:"tenant"`
+	Route   string             `json:"route"`
+	Repo    string             `json:"repo"`
+	Tag     string             `json:"tag"`
+	Author  string             `json:"author"`
+	Reason  string             `json:"reason"`
+	Event   *schema.Event      `json:"-"`
+	Binding *schema.MapBinding `json:"binding"`
+	Until   time.Time          `json:"until,omitempty"`
+	// Attempts counts the failed forwards of a deferred event
+	Attempts int       `json:"attempts,omitempty"`
+	Created  time.Time `json:"created"`
+	// Undo puts back the release state routing the event changed, called when it is rejected or expires
+	Undo func() `json:"-"`
+}
+
+// Queue - held events by id, entries expire after ttl
+type Queue struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries map[string]*Pending
+}
+
+// NewQueue - returns an empty queue
+func NewQueue(ttl time.Duration) *Queue {
+	return &Queue{ttl: ttl, entries: make(map[string]*Pending)}
+}
+
+// Put - queues the event, a redelivered event replaces the queued one
+func (a *Queue) Put(pending *Pending) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if pending.Created.IsZero() {
+		pending.Created = time.Now()
+	}
+	a.entries[pending.ID] = pending
+}
+
+// Take - removes and returns the pending event, nil when unknown or expired (expired events are left to Expire)
+// taking it makes sure an event is only forwarded (or rejected) once
+func (a *Queue) Take(id string) *Pending {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	pending, ok := a.entries[id]
+	if !ok || time.Since(pending.Created) >= a.ttl {
+		return nil
+	}
+	delete(a.entries, id)
+	return pending
+}
+
+// Expire - removes and returns the pending event once it has expired, nil when it is unknown (already taken)
+// or not expired yet (a redelivery replaced it), so that an expiry is only reported once
+func (a *Queue) Expire(id string) *Pending {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	pending, ok := a.entries[id]
+	if !ok || time.Since(pending.Created) < a.ttl {
+		return nil
+	}
+	delete(a.entries, id)
+	return pending
+}
+
+// List - returns the pending events that have not expired, of all tenants when tenant is empty, oldest first
+func (a *Queue) List(tenant string) []*Pending {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	var list []*Pending
+	for _, pending := range a.entries {
+		if time.Since(pending.Created) >= a.ttl {
+			continue
+		}
+		if tenant == "" || pending.Tenant == tenant {
+			list = append(list, pending)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list
+}
@@ -0,0 +1,25 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+
+	t.Run("Expire : should pass (expired events are reported once)", func(t *testing.T) {
+		q := NewQueue(10 * time.Millisecond)
+		q.Put(&Pending{ID: "rel-1-released", Tenant: "default"})
+		if q.Expire("rel-1-released") != nil {
+			t.Errorf(fmt.Sprintf("Handler %s expired an event before its time", "Expire"))
+		}
+		time.Sleep(20 * time.Millisecond)
+		if q.Take("rel-1-released") != nil || len(q.List("")) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s returned an expired event", "Take"))
+		}
+		if q.Expire("rel-1-released") == nil || q.Expire("rel-1-released") != nil {
+			t.Errorf(fmt.Sprintf("Handler %s did not report the expired event once", "Expire"))
+		}
+	})
+}
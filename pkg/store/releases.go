@@ -0,0 +1,105 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// release states, a release only ever moves forward (prereleased to released)
+const (
+	PRERELEASED string = "prereleased"
+	RELEASED    string = "released"
+)
+
+// release - private struct, the routed state of a release and when it last changed
+type release struct {
+	state   string
+	updated time.Time
+}
+
+// Releases - the last routed state of each release, keyed by ReleaseKey, entries expire ttl after their last change
+// used so that the duplicate events providers send for one transition are routed once
+type Releases struct {
+	mutex  sync.Mutex
+	ttl    time.Duration
+	states map[string]*release
+}
+
+// NewReleases - returns an empty release list
+func NewReleases(ttl time.Duration) *Releases {
+	return &Releases{ttl: ttl, states: make(map[string]*release)}
+}
+
+// ReleaseKey - the key of a tenant release
+func ReleaseKey(tenant string, repo string, id int) string {
+	return fmt.Sprintf("%s/%s@%d", tenant, repo, id)
+}
+
+// Advance - moves the release to the state, false is returned when the release
+// is already in that state or a later one
+func (r *Releases) Advance(key string, state string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	current := r.get(key)
+	if current == state || current == RELEASED {
+		return false
+	}
+	r.set(key, state)
+	return true
+}
+
+// Promote - moves a prereleased release to released, false is returned for any other state
+func (r *Releases) Promote(key string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.get(key) != PRERELEASED {
+		return false
+	}
+	r.set(key, RELEASED)
+	return true
+}
+
+// State - returns the routed state of the release, empty when unknown or expired
+func (r *Releases) State(key string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.get(key)
+}
+
+// Set - puts the release back in the state, used to undo a transition that could not be routed
+func (r *Releases) Set(key string, state string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if state == "" {
+		delete(r.states, key)
+		return
+	}
+	r.set(key, state)
+}
+
+// Delete - forgets the release
+func (r *Releases) Delete(key string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.states, key)
+}
+
+// get - private function, the state of the release, must be called with the lock held
+func (r *Releases) get(key string) string {
+	entry, ok := r.states[key]
+	if !ok || time.Since(entry.updated) > r.ttl {
+		return ""
+	}
+	return entry.state
+}
+
+// set - private function, records the state and drops the expired releases, must be called with the lock held
+func (r *Releases) set(key string, state string) {
+	r.states[key] = &release{state: state, updated: time.Now()}
+	for k, entry := range r.states {
+		if time.Since(entry.updated) > r.ttl {
+			delete(r.states, k)
+		}
+	}
+}
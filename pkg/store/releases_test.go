@@ -0,0 +1,50 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestReleases(t *testing.T) {
+
+	t.Run("Advance : should pass (each state once, never backwards)", func(t *testing.T) {
+		r := NewReleases(time.Hour)
+		key := ReleaseKey("default", "owner/repo", 1)
+		got := []bool{r.Advance(key, PRERELEASED), r.Advance(key, PRERELEASED), r.Advance(key, RELEASED), r.Advance(key, RELEASED), r.Advance(key, PRERELEASED)}
+		want := []bool{true, false, true, false, false}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect transitions - got (%v) wanted (%v)", "Advance", got, want))
+		}
+	})
+
+	t.Run("Promote : should pass (prereleased only)", func(t *testing.T) {
+		r := NewReleases(time.Hour)
+		key := ReleaseKey("default", "owner/repo", 2)
+		if r.Promote(key) {
+			t.Errorf(fmt.Sprintf("Handler %s promoted an unknown release", "Promote"))
+		}
+		r.Advance(key, PRERELEASED)
+		if !r.Promote(key) || r.Promote(key) || r.State(key) != RELEASED {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect state - got (%s) wanted (%s)", "Promote", r.State(key), RELEASED))
+		}
+		r.Delete(key)
+		if r.State(key) != "" {
+			t.Errorf(fmt.Sprintf("Handler %s did not forget the release", "Delete"))
+		}
+	})
+
+	t.Run("Advance : should pass (expired releases are forgotten)", func(t *testing.T) {
+		r := NewReleases(10 * time.Millisecond)
+		old, key := ReleaseKey("default", "owner/repo", 3), ReleaseKey("default", "owner/repo", 4)
+		r.Advance(old, RELEASED)
+		time.Sleep(20 * time.Millisecond)
+		if r.State(old) != "" {
+			t.Errorf(fmt.Sprintf("Handler %s returned an expired state - got (%s)", "State", r.State(old)))
+		}
+		r.Advance(key, PRERELEASED)
+		if len(r.states) != 1 || r.State(key) != PRERELEASED {
+			t.Errorf(fmt.Sprintf("Handler %s did not evict the expired release - got (%d)", "Advance", len(r.states)))
+		}
+	})
+}
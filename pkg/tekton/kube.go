@@ -0,0 +1,203 @@
+package tekton
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/connectors"
+)
+
+// SERVICEACCOUNTTOKEN - the token of the in-cluster service account
+const SERVICEACCOUNTTOKEN string = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// SERVICEACCOUNTCA - the ca bundle of the in-cluster api server
+const SERVICEACCOUNTCA string = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+
+// kubeconfig - private struct, the fields of a json kubeconfig the client uses
+type kubeconfig struct {
+	CurrentContext string `json:"current-context"`
+	Clusters       []struct {
+		Name    string `json:"name"`
+		Cluster struct {
+			Server                   string `json:"server"`
+			CertificateAuthority     string `json:"certificate-authority"`
+			CertificateAuthorityData string `json:"certificate-authority-data"`
+		} `json:"cluster"`
+	} `json:"clusters"`
+	Users []struct {
+		Name string `json:"name"`
+		User struct {
+			Token     string `json:"token"`
+			TokenFile string `json:"tokenFile"`
+			Username  string `json:"username"`
+			Password  string `json:"password"`
+		} `json:"user"`
+	} `json:"users"`
+	Contexts []struct {
+		Name    string `json:"name"`
+		Context struct {
+			Cluster string `json:"cluster"`
+			User    string `json:"user"`
+		} `json:"context"`
+	} `json:"contexts"`
+}
+
+// rest - private struct, the dynamic client over the api server rest api
+// requests carry credentials, they go through a client of their own that verifies the api server
+// certificate against the cluster ca and never through the connectors transport; con is used for logging
+type rest struct {
+	server   string
+	token    string
+	username string
+	password string
+	client   *http.Client
+	con      connectors.Clients
+}
+
+// newClient - private function, the http client of the api server, verified against the pem ca bundle
+// (the system roots when the bundle is empty)
+func newClient(ca []byte) (*http.Client, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(ca) > 0 {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in the cluster ca")
+		}
+	}
+	return &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: config}}, nil
+}
+
+// NewDynamic - returns a client for the api server of the kubeconfig (the current context)
+// or, when path is empty, of the cluster the service runs in (the service account token is read on each call
+// so that rotated tokens are picked up)
+func NewDynamic(path string, con connectors.Clients) (Dynamic, error) {
+	if path == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("not running in a cluster (KUBERNETES_SERVICE_HOST is not set) and no kubeconfig given")
+		}
+		token, err := ioutil.ReadFile(SERVICEACCOUNTTOKEN)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the service account token %v", err)
+		}
+		ca, err := ioutil.ReadFile(SERVICEACCOUNTCA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the service account ca %v", err)
+		}
+		client, err := newClient(ca)
+		if err != nil {
+			return nil, err
+		}
+		return &rest{server: "https://" + net.JoinHostPort(host, port), token: strings.TrimSpace(string(token)), client: client, con: con}, nil
+	}
+	var cfg kubeconfig
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read kubeconfig %s (json expected) %v", path, err)
+	}
+	return cfg.client(con)
+}
+
+// client - private function, the client of the current context (or of the only context)
+func (k *kubeconfig) client(con connectors.Clients) (Dynamic, error) {
+	c := &rest{con: con}
+	var cluster, user string
+	var ca []byte
+	for _, ctx := range k.Contexts {
+		if ctx.Name == k.CurrentContext || len(k.Contexts) == 1 {
+			cluster, user = ctx.Context.Cluster, ctx.Context.User
+		}
+	}
+	for _, cl := range k.Clusters {
+		if cl.Name != cluster {
+			continue
+		}
+		c.server = strings.TrimSuffix(cl.Cluster.Server, "/")
+		var err error
+		if cl.Cluster.CertificateAuthorityData != "" {
+			ca, err = base64.StdEncoding.DecodeString(cl.Cluster.CertificateAuthorityData)
+		} else if cl.Cluster.CertificateAuthority != "" {
+			ca, err = ioutil.ReadFile(cl.Cluster.CertificateAuthority)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read kubeconfig cluster ca %v", err)
+		}
+	}
+	if c.server == "" {
+		return nil, fmt.Errorf("kubeconfig has no cluster for context %q", k.CurrentContext)
+	}
+	client, err := newClient(ca)
+	if err != nil {
+		return nil, err
+	}
+	c.client = client
+	for _, u := range k.Users {
+		if u.Name != user {
+			continue
+		}
+		c.token, c.username, c.password = u.User.Token, u.User.Username, u.User.Password
+		if u.User.TokenFile != "" {
+			token, err := ioutil.ReadFile(u.User.TokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("could not read kubeconfig token file %v", err)
+			}
+			c.token = strings.TrimSpace(string(token))
+		}
+	}
+	if c.token == "" && c.username == "" {
+		return nil, fmt.Errorf("kubeconfig user %q has no token (client certificates are not supported)", user)
+	}
+	return c, nil
+}
+
+// Create - posts the object to the collection of the resource in the namespace
+// a failure carries the message of the api server status
+func (c *rest) Create(ctx context.Context, resource Resource, namespace string, obj map[string]interface{}) (map[string]interface{}, error) {
+	path := "/apis/" + resource.Group + "/" + resource.Version
+	if resource.Group == "" {
+		path = "/api/" + resource.Version
+	}
+	path += "/namespaces/" + namespace + "/" + resource.Resource
+	data, _ := json.Marshal(obj)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.server+path, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("create %s %v", resource.Resource, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	c.con.Info("Function Create %s", path)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("create %s %v", resource.Resource, err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	var created map[string]interface{}
+	json.Unmarshal(body, &created)
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := created["message"].(string)
+		if message == "" {
+			message = string(body)
+		}
+		return nil, fmt.Errorf("create %s failed with %d %s", resource.Resource, resp.StatusCode, message)
+	}
+	return created, nil
+}
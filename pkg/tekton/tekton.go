@@ -0,0 +1,180 @@
+package tekton
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+)
+
+// defaults of a tekton route
+const (
+	APIVERSION  string = "tekton.dev/v1beta1"
+	PIPELINERUN string = "PipelineRun"
+	TASKRUN     string = "TaskRun"
+)
+
+// labels set on every run, the delivery label is the owner label used to find the runs of a delivery
+// (label values are limited to 63 characters, the full delivery id is kept in an annotation of the same name)
+const (
+	LABELDELIVERY string = "gitwebhook.dev/delivery-id"
+	LABELROUTE    string = "gitwebhook.dev/route"
+	LABELMANAGED  string = "app.kubernetes.io/managed-by"
+	MANAGEDBY     string = "golang-gitwebhook-service"
+)
+
+// Resource - a group, version and resource (pipelineruns) as used in the api paths
+type Resource struct {
+	Group    string
+	Version  string
+	Resource string
+}
+
+// Dynamic - creates unstructured objects, the subset of the Kubernetes dynamic client the routes need
+// the object as stored by the api server (with its generated name) is returned
+type Dynamic interface {
+	Create(ctx context.Context, resource Resource, namespace string, obj map[string]interface{}) (map[string]interface{}, error)
+}
+
+// ResourceFor - the resource of an apiVersion and kind (tekton.dev/v1beta1 PipelineRun is tekton.dev v1beta1 pipelineruns)
+func ResourceFor(apiVersion string, kind string) Resource {
+	r := Resource{Version: apiVersion, Resource: strings.ToLower(kind) + "s"}
+	if x := strings.LastIndex(apiVersion, "/"); x >= 0 {
+		r.Group, r.Version = apiVersion[:x], apiVersion[x+1:]
+	}
+	return r
+}
+
+// NewRun - builds the run of a route, rendered is the executed route template (empty to reference the pipeline)
+// the namespace, owner labels and the params taken from the binding are set on it,
+// a run without a name gets the route name as generateName
+func NewRun(t *config.Tekton, route string, deliveryID string, rendered []byte, binding *schema.MapBinding) (map[string]interface{}, error) {
+	kind, apiVersion := t.Kind, t.APIVersion
+	if kind == "" {
+		kind = PIPELINERUN
+	}
+	if apiVersion == "" {
+		apiVersion = APIVERSION
+	}
+	run := map[string]interface{}{}
+	if len(rendered) > 0 {
+		if err := json.Unmarshal(rendered, &run); err != nil {
+			return nil, fmt.Errorf("rendered %s is not a json object %v", kind, err)
+		}
+	} else {
+		ref := map[string]interface{}{"name": t.Pipeline}
+		spec := map[string]interface{}{}
+		if kind == TASKRUN {
+			spec["taskRef"] = ref
+		} else {
+			spec["pipelineRef"] = ref
+		}
+		run["spec"] = spec
+	}
+	if run["apiVersion"] == nil {
+		run["apiVersion"] = apiVersion
+	}
+	if run["kind"] == nil {
+		run["kind"] = kind
+	}
+	metadata := object(run, "metadata")
+	if t.Namespace != "" {
+		metadata["namespace"] = t.Namespace
+	}
+	if metadata["name"] == nil && metadata["generateName"] == nil {
+		metadata["generateName"] = route + "-"
+	}
+	labels := object(metadata, "labels")
+	labels[LABELDELIVERY] = LabelValue(deliveryID)
+	labels[LABELROUTE] = LabelValue(route)
+	labels[LABELMANAGED] = MANAGEDBY
+	object(metadata, "annotations")[LABELDELIVERY] = deliveryID
+
+	spec := object(run, "spec")
+	if t.ServiceAccount != "" {
+		if run["apiVersion"] == "tekton.dev/v1" && run["kind"] == PIPELINERUN {
+			object(spec, "taskRunTemplate")["serviceAccountName"] = t.ServiceAccount
+		} else {
+			spec["serviceAccountName"] = t.ServiceAccount
+		}
+	}
+	if len(t.Params) > 0 {
+		setParams(spec, t.Params, binding)
+	}
+	return run, nil
+}
+
+// Name - the name of a created run
+func Name(run map[string]interface{}) string {
+	metadata, _ := run["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	return name
+}
+
+// setParams - private function, sets the params to the binding fields (by json name)
+// params already in the spec are replaced, lists (labels) are passed as array params
+func setParams(spec map[string]interface{}, params map[string]string, binding *schema.MapBinding) {
+	var fields map[string]interface{}
+	data, _ := json.Marshal(binding)
+	json.Unmarshal(data, &fields)
+	var list []interface{}
+	if existing, ok := spec["params"].([]interface{}); ok {
+		for _, p := range existing {
+			if m, ok := p.(map[string]interface{}); ok {
+				if _, replaced := params[fmt.Sprint(m["name"])]; replaced {
+					continue
+				}
+			}
+			list = append(list, p)
+		}
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, ok := fields[params[name]]
+		if !ok {
+			value = ""
+		}
+		switch v := value.(type) {
+		case string, []interface{}:
+		case map[string]interface{}:
+			// semver, passed as its json
+			b, _ := json.Marshal(v)
+			value = string(b)
+		default:
+			value = fmt.Sprint(v)
+		}
+		list = append(list, map[string]interface{}{"name": name, "value": value})
+	}
+	spec["params"] = list
+}
+
+// object - private utility function, returns the nested object of the key, creating it when missing
+func object(parent map[string]interface{}, key string) map[string]interface{} {
+	child, ok := parent[key].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		parent[key] = child
+	}
+	return child
+}
+
+var invalidLabel = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// LabelValue - a valid label value: other characters are replaced by "-", it is cut to 63 characters
+// and starts and ends with an alphanumeric character
+func LabelValue(value string) string {
+	value = invalidLabel.ReplaceAllString(value, "-")
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.Trim(value, "._-")
+}
@@ -0,0 +1,148 @@
+package tekton
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/schema"
+)
+
+// fakeClients - records the requests and answers with the given status code and response
+type fakeClients struct {
+	code     int
+	response string
+	requests []*http.Request
+	bodies   []string
+}
+
+func (f *fakeClients) Error(string, ...interface{}) {}
+func (f *fakeClients) Info(string, ...interface{})  {}
+func (f *fakeClients) Debug(string, ...interface{}) {}
+func (f *fakeClients) Trace(string, ...interface{}) {}
+
+func (f *fakeClients) Do(req *http.Request) (*http.Response, error) {
+	body, _ := ioutil.ReadAll(req.Body)
+	f.requests = append(f.requests, req)
+	f.bodies = append(f.bodies, string(body))
+	return &http.Response{StatusCode: f.code, Body: ioutil.NopCloser(bytes.NewBufferString(f.response)), Header: make(http.Header)}, nil
+}
+
+func TestTekton(t *testing.T) {
+	binding := &schema.MapBinding{RepoUrl: "https://github.com/org/app.git", RepoHash: "6183473b", Labels: []string{"run-e2e"}}
+
+	t.Run("NewRun : should pass (pipeline reference)", func(t *testing.T) {
+		tk := &config.Tekton{Namespace: "ci", Pipeline: "build", ServiceAccount: "pipeline", Params: map[string]string{"revision": "hash", "git-url": "url", "labels": "labels"}}
+		run, err := NewRun(tk, "build", "72d3162e-cc78-11e3-81ab-4c9367dc0958-build", nil, binding)
+		data, _ := json.Marshal(run)
+		want := `{"apiVersion":"tekton.dev/v1beta1","kind":"PipelineRun","metadata":{"annotations":{"gitwebhook.dev/delivery-id":"72d3162e-cc78-11e3-81ab-4c9367dc0958-build"},` +
+			`"generateName":"build-","labels":{"app.kubernetes.io/managed-by":"golang-gitwebhook-service","gitwebhook.dev/delivery-id":"72d3162e-cc78-11e3-81ab-4c9367dc0958-build",` +
+			`"gitwebhook.dev/route":"build"},"namespace":"ci"},"spec":{"params":[{"name":"git-url","value":"https://github.com/org/app.git"},{"name":"labels","value":["run-e2e"]},` +
+			`{"name":"revision","value":"6183473b"}],"pipelineRef":{"name":"build"},"serviceAccountName":"pipeline"}}`
+		if err != nil || string(data) != want {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect run - got (%s %v) wanted (%s)", "NewRun", data, err, want))
+		}
+	})
+
+	t.Run("NewRun : should pass (rendered task run)", func(t *testing.T) {
+		tk := &config.Tekton{Kind: TASKRUN, APIVersion: "tekton.dev/v1", Namespace: "ci", Params: map[string]string{"revision": "hash"}}
+		rendered := []byte(`{"metadata":{"name":"lint-6183473b","labels":{"team":"a"}},"spec":{"taskRef":{"name":"lint"},"params":[{"name":"revision","value":"main"},{"name":"mode","value":"strict"}]}}`)
+		run, err := NewRun(tk, "lint", "abc-lint", rendered, binding)
+		data, _ := json.Marshal(run)
+		want := `{"apiVersion":"tekton.dev/v1","kind":"TaskRun","metadata":{"annotations":{"gitwebhook.dev/delivery-id":"abc-lint"},"labels":{"app.kubernetes.io/managed-by":"golang-gitwebhook-service",` +
+			`"gitwebhook.dev/delivery-id":"abc-lint","gitwebhook.dev/route":"lint","team":"a"},"name":"lint-6183473b","namespace":"ci"},` +
+			`"spec":{"params":[{"name":"mode","value":"strict"},{"name":"revision","value":"6183473b"}],"taskRef":{"name":"lint"}}}`
+		if err != nil || string(data) != want {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect run - got (%s %v) wanted (%s)", "NewRun", data, err, want))
+		}
+		if _, err = NewRun(tk, "lint", "abc-lint", []byte(`[]`), binding); err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned no error - got (%v) wanted (%v)", "NewRun", err, "error"))
+		}
+	})
+
+	t.Run("LabelValue : should pass", func(t *testing.T) {
+		tests := map[string]string{
+			"abc-pr-opened": "abc-pr-opened",
+			"org/app@main":  "org-app-main",
+			"-1234567890123456789012345678901234567890123456789012345678901234567890": "12345678901234567890123456789012345678901234567890123456789012",
+		}
+		for in, want := range tests {
+			if got := LabelValue(in); got != want {
+				t.Errorf(fmt.Sprintf("Handler %s returned incorrect value - got (%s) wanted (%s)", "LabelValue", got, want))
+			}
+		}
+	})
+
+	var requests []*http.Request
+	var code int
+	var answer string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		w.WriteHeader(code)
+		w.Write([]byte(answer))
+	}))
+	defer server.Close()
+	// kubeconfig - the test kubeconfig pointed at the tls server, with its certificate as the cluster ca when trust is set
+	kubeconfig := func(trust bool) string {
+		var cfg map[string]interface{}
+		data, _ := ioutil.ReadFile("../../tests/kubeconfig.json")
+		json.Unmarshal(data, &cfg)
+		cluster := cfg["clusters"].([]interface{})[0].(map[string]interface{})["cluster"].(map[string]interface{})
+		cluster["server"] = server.URL
+		if trust {
+			ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+			cluster["certificate-authority-data"] = base64.StdEncoding.EncodeToString(ca)
+		}
+		data, _ = json.Marshal(cfg)
+		path := filepath.Join(t.TempDir(), "kubeconfig.json")
+		ioutil.WriteFile(path, data, 0600)
+		return path
+	}
+
+	t.Run("Create : should pass (kubeconfig)", func(t *testing.T) {
+		requests, code, answer = nil, 201, `{"kind":"PipelineRun","metadata":{"name":"build-x7k2p","namespace":"ci"}}`
+		client, err := NewDynamic(kubeconfig(true), &fakeClients{})
+		if err != nil {
+			t.Fatalf(fmt.Sprintf("Handler %s returned with error - got (%v) wanted (%v)", "NewDynamic", err, nil))
+		}
+		created, err := client.Create(context.Background(), ResourceFor(APIVERSION, PIPELINERUN), "ci", map[string]interface{}{"kind": "PipelineRun"})
+		if err != nil || len(requests) != 1 || Name(created) != "build-x7k2p" || requests[0].URL.Path != "/apis/tekton.dev/v1beta1/namespaces/ci/pipelineruns" ||
+			requests[0].Header.Get("Authorization") != "Bearer ci-token-0123" {
+			t.Errorf(fmt.Sprintf("Handler %s sent incorrect request - got (%v %v)", "Create", err, requests))
+		}
+	})
+
+	t.Run("Create : should fail (forbidden)", func(t *testing.T) {
+		requests, code, answer = nil, 403, `{"kind":"Status","status":"Failure","message":"pipelineruns.tekton.dev is forbidden","code":403}`
+		client, _ := NewDynamic(kubeconfig(true), &fakeClients{})
+		if _, err := client.Create(context.Background(), ResourceFor(APIVERSION, PIPELINERUN), "ci", map[string]interface{}{}); err == nil ||
+			err.Error() != "create pipelineruns failed with 403 pipelineruns.tekton.dev is forbidden" {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect error - got (%v)", "Create", err))
+		}
+	})
+
+	t.Run("Create : should fail (api server certificate not signed by the cluster ca)", func(t *testing.T) {
+		requests, code, answer = nil, 201, "{}"
+		client, _ := NewDynamic(kubeconfig(false), &fakeClients{})
+		if _, err := client.Create(context.Background(), ResourceFor(APIVERSION, PIPELINERUN), "ci", map[string]interface{}{}); err == nil || len(requests) != 0 {
+			t.Errorf(fmt.Sprintf("Handler %s sent the token to an unverified server - got (%v %d)", "Create", err, len(requests)))
+		}
+	})
+
+	t.Run("NewDynamic : should fail (not in cluster)", func(t *testing.T) {
+		os.Unsetenv("KUBERNETES_SERVICE_HOST")
+		if _, err := NewDynamic("", &fakeClients{}); err == nil {
+			t.Errorf(fmt.Sprintf("Handler %s returned no error - got (%v) wanted (%v)", "NewDynamic", err, "error"))
+		}
+	})
+}
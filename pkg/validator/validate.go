@@ -1,46 +1,633 @@
 package validator
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"text/template"
 
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/cloudevents"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/config"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/freeze"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/glob"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/notify"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/payload"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/sinks"
+	"github.com/luigizuccarelli/golang-gitwebhook-service/pkg/tekton"
 	"github.com/microlib/simple"
 )
 
-// checkEnvars - private function, iterates through each item and checks the required field
+const (
+	// MINSECRETLENGTH - secrets shorter than this are flagged as weak
+	MINSECRETLENGTH int = 16
+)
+
+// ValidationErrors - collects every problem found so that they can be reported at once
+type ValidationErrors []string
+
+func (v ValidationErrors) Error() string {
+	return fmt.Sprintf("%d configuration error(s): %s", len(v), strings.Join(v, "; "))
+}
+
+// items - each entry is of the form name,required[,kind]
+var items = []string{
+	"LOG_LEVEL,true,level",
+	"WEBHOOK_SECRET,false,secret",
+	"REPO_MAPPING,false",
+	"TENANT_CONFIG,false",
+	"PROVIDERS,false,providers",
+	"PR_OPENED_URL,false,url",
+	"PR_OPENED_ACTIONS,false",
+	"SKIP_DRAFT_PRS,false",
+	"PR_OPENED_DEBOUNCE,false,seconds",
+	"PR_MERGED_URL,false,url",
+	"PRERELEASED_URL,false,url",
+	"RELEASED_URL,false,url",
+	"TAG_PUSHED_URL,false,url",
+	"BRANCH_DELETED_URL,false,url",
+	"ENVIRONMENTS,false",
+	"RELEASE_APPROVERS,false",
+	"RELEASE_APPROVER_TEAMS,false",
+	"ADMIN_TOKEN,false,secret",
+	"FREEZE_CONFIG,false",
+	"ALLOW_SENDERS,false",
+	"DENY_SENDERS,false",
+	"ALLOW_AUTHORS,false",
+	"DENY_AUTHORS,false",
+	"ALLOW_ASSOCIATIONS,false",
+	"ALLOW_OWNERS,false",
+	"DENY_OWNERS,false",
+	"ALLOW_VISIBILITY,false",
+	"FORK_PRS,false",
+	"CLOUDEVENTS_MODE,false",
+	"FORGE_PROVIDER,false,providers",
+	"FORGE_API_URL,false,url",
+	"FORGE_TOKEN,false",
+	"FORGE_CHECKS,false",
+	"CALLBACK_TOKEN,false,secret",
+	"NOTIFY_SLACK_URL,false,url",
+	"NOTIFY_TEAMS_URL,false,url",
+	"NOTIFY_ON,false",
+}
+
+// eventUrls - the envars that route events to eventlisteners
+var eventUrls = []string{"PR_OPENED_URL", "PR_MERGED_URL", "PRERELEASED_URL", "RELEASED_URL", "TAG_PUSHED_URL", "BRANCH_DELETED_URL"}
+
+// Actions - the (normalised) actions a route can list for each event type
+var Actions = map[string][]string{
+	"pull_request":        {"opened", "reopened", "synchronize", "ready_for_review", "labeled", "unlabeled", "merged", "closed"},
+	"pull_request_review": {"approved"},
+	"release":             {"prereleased", "released", "edited", "deleted"},
+	"push":                {"tag", "branch"},
+	"create":              {"tag", "branch"},
+	"delete":              {"tag", "branch"},
+}
+
+// Providers - the git providers this service knows how to handle
+var Providers = []string{"github", "gitea", "gitlab"}
+
+// checkEnvar - private function, parses the item and checks the required field and value
 func checkEnvar(item string, logger *simple.Logger) error {
-	name := strings.Split(item, ",")[0]
-	required, _ := strconv.ParseBool(strings.Split(item, ",")[1])
-	logger.Trace(fmt.Sprintf("name %s : required %t", name, required))
-	if os.Getenv(name) == "" {
+	fields := strings.Split(item, ",")
+	if len(fields) < 2 || fields[0] == "" {
+		return fmt.Errorf("%s envar entry is malformed (expected name,required[,kind])", item)
+	}
+	name := fields[0]
+	required, err := strconv.ParseBool(fields[1])
+	if err != nil {
+		return fmt.Errorf("%s envar entry has an invalid required flag %s", name, fields[1])
+	}
+	kind := ""
+	if len(fields) > 2 {
+		kind = fields[2]
+	}
+	logger.Trace(fmt.Sprintf("name %s : required %t : kind %s", name, required, kind))
+
+	value := os.Getenv(name)
+	if value == "" {
 		if required {
-			logger.Error(fmt.Sprintf("%s envar is mandatory please set it", name))
-			return fmt.Errorf(fmt.Sprintf("%s envar is mandatory please set it", name))
+			return fmt.Errorf("%s envar is mandatory please set it", name)
 		}
-
 		logger.Warn(fmt.Sprintf("%s envar is empty please set it", name))
+		return nil
+	}
+
+	switch kind {
+	case "url":
+		return CheckUrl(name+" envar", value)
+	case "level":
+		return checkLevel(name, value)
+	case "providers":
+		return checkProviders(name, value)
+	case "seconds":
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return fmt.Errorf("%s envar %q should be a number of seconds", name, value)
+		}
+	case "secret":
+		if len(value) < MINSECRETLENGTH {
+			logger.Warn(fmt.Sprintf("%s envar is weak (less than %d characters)", name, MINSECRETLENGTH))
+		}
 	}
 	return nil
 }
 
+// CheckUrl - verifies the value parses as an absolute http(s) url, name is used in the error
+func CheckUrl(name, value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid url %v", name, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%s has unsupported scheme %q (expected http or https)", name, u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%s has no host", name)
+	}
+	return nil
+}
+
+// checkLevel - verifies the log level is one the logger understands
+func checkLevel(name, value string) error {
+	switch value {
+	case simple.TRACE, simple.DEBUG, simple.INFO, simple.WARN, simple.ERROR:
+		return nil
+	}
+	return fmt.Errorf("%s envar has unknown level %q", name, value)
+}
+
+// checkProviders - verifies each entry in the comma separated list is supported
+func checkProviders(name, value string) error {
+	for _, p := range strings.Split(value, ",") {
+		if !contains(Providers, strings.TrimSpace(p)) {
+			return fmt.Errorf("%s envar has unsupported provider %q", name, p)
+		}
+	}
+	return nil
+}
+
+// checkCrossFields - validations that depend on more than one envar
+func checkCrossFields() []string {
+	var errs []string
+	if strings.TrimSpace(os.Getenv("PROVIDERS")) == "" {
+		for _, name := range eventUrls {
+			if os.Getenv(name) != "" {
+				errs = append(errs, "event urls are set but no provider is enabled (set PROVIDERS)")
+				break
+			}
+		}
+	}
+	errs = append(errs, checkChatOps(config.FromEnv(), "CHATOPS envars: ")...)
+	errs = append(errs, checkEnvironments(config.FromEnv(), "ENVIRONMENTS: ")...)
+	errs = append(errs, checkApprovals(config.FromEnv(), "RELEASE_APPROVERS: ")...)
+	errs = append(errs, checkPolicy(config.FromEnv(), "policy envars: ")...)
+	errs = append(errs, checkNotifiers(config.FromEnv(), "NOTIFY envars: ")...)
+	if m := os.Getenv("CLOUDEVENTS_MODE"); m != "" && m != cloudevents.STRUCTURED && m != cloudevents.BINARY {
+		errs = append(errs, fmt.Sprintf("CLOUDEVENTS_MODE %q should be structured or binary", m))
+	}
+	if path := os.Getenv("FREEZE_CONFIG"); path != "" {
+		var f *config.Freeze
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &f)
+		}
+		if err == nil && f != nil {
+			_, err = freeze.Parse(f)
+		}
+		if err != nil || f == nil {
+			errs = append(errs, fmt.Sprintf("FREEZE_CONFIG %s is not a valid freeze calendar %v", path, err))
+		}
+	}
+	for _, e := range strings.Split(os.Getenv("ENVIRONMENTS"), ",") {
+		e = strings.TrimSpace(e)
+		if kv := strings.SplitN(e, "=", 2); e != "" {
+			if len(kv) != 2 {
+				errs = append(errs, fmt.Sprintf("ENVIRONMENTS entry %q should be of the form name=url", e))
+			} else if err := CheckUrl("ENVIRONMENTS "+kv[0], kv[1]); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if r := config.FromEnv().Route("pr-opened"); r != nil {
+		errs = append(errs, checkActions(r, "PR_OPENED_ACTIONS: ")...)
+	}
+	if os.Getenv("FORGE_CHECKS") == "true" && os.Getenv("FORGE_PROVIDER") != "github" {
+		errs = append(errs, "FORGE_CHECKS is only supported for the github provider")
+	}
+	if os.Getenv("FORGE_PROVIDER") != "" && os.Getenv("FORGE_TOKEN") == "" {
+		errs = append(errs, "FORGE_PROVIDER is set but FORGE_TOKEN is empty")
+	}
+	// delivery ids are sent to pipelines and shown on the forge, the token keeps anyone else from setting statuses
+	if os.Getenv("FORGE_PROVIDER") != "" && os.Getenv("CALLBACK_TOKEN") == "" {
+		errs = append(errs, "FORGE_PROVIDER is set but CALLBACK_TOKEN is empty (pipeline callbacks update the commit statuses and check runs)")
+	}
+	if os.Getenv("FORGE_PROVIDER") != "" && os.Getenv("FORGE_PROVIDER") != "github" && os.Getenv("FORGE_API_URL") == "" {
+		errs = append(errs, "FORGE_API_URL is mandatory for "+os.Getenv("FORGE_PROVIDER"))
+	}
+	return errs
+}
+
+// checkActions - every action of the route must be known for its event type
+// events without an entry in Actions are not checked
+func checkActions(r *config.Route, prefix string) []string {
+	var errs []string
+	known, ok := Actions[r.Event]
+	if !ok {
+		return errs
+	}
+	for _, a := range r.Actions {
+		if !contains(known, a) && a != "*" {
+			errs = append(errs, fmt.Sprintf("%sroute %s has unknown %s action %q", prefix, r.Name, r.Event, a))
+		}
+	}
+	return errs
+}
+
+// checkEnvironments - environment names must be unique, patterns must compile
+// and environment routes must refer to a known environment
+func checkEnvironments(t *config.Tenant, prefix string) []string {
+	var errs []string
+	names := map[string]bool{}
+	for _, e := range t.Environments {
+		if e.Name == "" || names[e.Name] {
+			errs = append(errs, fmt.Sprintf("%senvironment name %q is empty or duplicated", prefix, e.Name))
+		}
+		names[e.Name] = true
+		if _, err := regexp.Compile(e.Pattern); err != nil {
+			errs = append(errs, fmt.Sprintf("%senvironment %s pattern %v", prefix, e.Name, err))
+		}
+	}
+	for _, r := range t.Routes {
+		if r.Environment != "" && !names[r.Environment] {
+			errs = append(errs, fmt.Sprintf("%sroute %s refers to unknown environment %s", prefix, r.Name, r.Environment))
+		}
+	}
+	return errs
+}
+
+// checkApprovals - approval markers must compile and approver teams need a forge to check membership
+func checkApprovals(t *config.Tenant, prefix string) []string {
+	var errs []string
+	for _, r := range t.Routes {
+		if r.Approval == nil {
+			continue
+		}
+		if _, err := regexp.Compile(r.Approval.Marker); err != nil {
+			errs = append(errs, fmt.Sprintf("%sroute %s approval marker %v", prefix, r.Name, err))
+		}
+		if len(r.Approval.Teams) > 0 && len(t.Forges) == 0 {
+			errs = append(errs, fmt.Sprintf("%sroute %s approval teams need a forge to be configured", prefix, r.Name))
+		}
+	}
+	return errs
+}
+
+// checkFreezes - freeze calendars must parse
+func checkFreezes(t *config.Tenant, prefix string) []string {
+	var errs []string
+	for _, r := range t.Routes {
+		if r.Freeze == nil {
+			continue
+		}
+		if _, err := freeze.Parse(r.Freeze); err != nil {
+			errs = append(errs, fmt.Sprintf("%sroute %s freeze %v", prefix, r.Name, err))
+		}
+	}
+	return errs
+}
+
+// checkOutput - a route posts the binding in at most one alternative format
+func checkOutput(r *config.Route, prefix string) []string {
+	var errs []string
+	if r.CloudEvents != "" && r.CloudEvents != cloudevents.STRUCTURED && r.CloudEvents != cloudevents.BINARY {
+		errs = append(errs, fmt.Sprintf("%sroute %s cloudevents mode %q should be structured or binary", prefix, r.Name, r.CloudEvents))
+	}
+	formats := 0
+	for _, set := range []bool{r.Passthrough, r.Template != nil, r.CloudEvents != ""} {
+		if set {
+			formats++
+		}
+	}
+	if formats > 1 {
+		errs = append(errs, fmt.Sprintf("%sroute %s can only set one of passthrough, template and cloudevents", prefix, r.Name))
+	}
+	if r.Tekton != nil && (formats > 0 || r.Sink != nil) {
+		errs = append(errs, fmt.Sprintf("%sroute %s creates tekton runs, passthrough, template, cloudevents and sink do not apply", prefix, r.Name))
+	}
+	return errs
+}
+
+// checkSink - the sink type must be known, nats and amqp sinks need a plain nats:// or amqp:// url, kafka sinks a kafka://
+// broker list or the REST proxy and the others an http api
+// (github defaults to api.github.com), brokers need a subject, jenkins a job, argo a template and namespace
+// and github a workflow or an event type (the subject); every template must parse
+func checkSink(r *config.Route, prefix string) []string {
+	var errs []string
+	name := prefix + "route " + r.Name
+	sink := r.Sink
+	switch sink.Type {
+	case config.NATS:
+		// the sink speaks plain nats, tls:// (or a server requiring tls) is not supported
+		if u, err := url.Parse(r.URL); err != nil || u.Scheme != "nats" || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("%s nats sink url %q should be of the form nats://host:4222 (tls is not supported)", name, r.URL))
+		}
+	case config.AMQP:
+		if u, err := url.Parse(r.URL); err != nil || u.Scheme != "amqp" || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("%s amqp sink url %q should be of the form amqp://host:5672 (tls is not supported)", name, r.URL))
+		}
+	case config.KAFKA, config.RABBITMQHTTP, config.JENKINS, config.ARGO, config.GITHUB:
+		if r.URL == "" && sink.Type == config.GITHUB {
+			break
+		}
+		if u, err := url.Parse(r.URL); err == nil && u.Scheme == "kafka" && sink.Type == config.KAFKA {
+			if u.Host == "" {
+				errs = append(errs, fmt.Sprintf("%s kafka sink url %q should be of the form kafka://host:9092[,host:9092] or the REST proxy url", name, r.URL))
+			}
+			break
+		}
+		if err := CheckUrl(name+" "+sink.Type+" sink", r.URL); err != nil {
+			errs = append(errs, err.Error())
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("%s sink type %q should be one of %s", name, sink.Type, strings.Join(sinks.Types, ", ")))
+	}
+	if sink.Stream != "" && sink.Type != config.NATS {
+		errs = append(errs, name+" sink stream only applies to nats sinks")
+	}
+	switch sink.Type {
+	case config.NATS, config.KAFKA, config.AMQP, config.RABBITMQHTTP:
+		if sink.Subject == "" {
+			errs = append(errs, name+" sink subject is mandatory")
+		}
+	case config.JENKINS:
+		if sink.Job == "" {
+			errs = append(errs, name+" jenkins sink job is mandatory")
+		}
+	case config.ARGO:
+		if sink.Template == "" || sink.Namespace == "" {
+			errs = append(errs, name+" argo sink template and namespace are mandatory")
+		}
+	case config.GITHUB:
+		if sink.Workflow == "" && sink.Subject == "" {
+			errs = append(errs, name+" github sink needs a workflow or a repository_dispatch event type (subject)")
+		}
+		if sink.Workflow == "" && len(sink.Params) > sinks.MAXCLIENTPAYLOAD {
+			errs = append(errs, fmt.Sprintf("%s github sink client payload has more than %d params", name, sinks.MAXCLIENTPAYLOAD))
+		}
+	}
+	texts := []string{sink.Subject, sink.Key, sink.Repository, sink.Ref}
+	for _, text := range sink.Params {
+		texts = append(texts, text)
+	}
+	for _, text := range texts {
+		if _, err := template.New("text").Funcs(payload.Funcs).Parse(text); err != nil {
+			errs = append(errs, fmt.Sprintf("%s sink template %v", name, err))
+		}
+	}
+	return errs
+}
+
+// checkTekton - the run kind must be known, the namespace is mandatory, the run needs a pipeline or a template
+// that parses and a kubeconfig must be a readable json kubeconfig
+func checkTekton(r *config.Route, prefix string) []string {
+	var errs []string
+	name := prefix + "route " + r.Name
+	tk := r.Tekton
+	if tk.Kind != "" && tk.Kind != tekton.PIPELINERUN && tk.Kind != tekton.TASKRUN {
+		errs = append(errs, fmt.Sprintf("%s tekton kind %q should be PipelineRun or TaskRun", name, tk.Kind))
+	}
+	if tk.Namespace == "" {
+		errs = append(errs, name+" tekton namespace is mandatory")
+	}
+	if tk.Template != nil {
+		if _, err := payload.Parse(tk.Template); err != nil {
+			errs = append(errs, fmt.Sprintf("%s tekton template %v", name, err))
+		}
+	} else if tk.Pipeline == "" {
+		errs = append(errs, name+" tekton needs a pipeline (or task) name or a template")
+	}
+	if tk.Kubeconfig != "" {
+		if _, err := tekton.NewDynamic(tk.Kubeconfig, nil); err != nil {
+			errs = append(errs, fmt.Sprintf("%s tekton %v", name, err))
+		}
+	}
+	return errs
+}
+
+// checkPolicy - the fork policy and the repository visibilities must be known
+func checkPolicy(t *config.Tenant, prefix string) []string {
+	var errs []string
+	if t.Policy == nil {
+		return errs
+	}
+	if !contains([]string{"", config.ALLOW, config.DENY, config.OKTOTEST}, t.Policy.Forks) {
+		errs = append(errs, fmt.Sprintf("%sforks policy %q should be allow, deny or ok-to-test", prefix, t.Policy.Forks))
+	}
+	for _, v := range t.Policy.Visibility {
+		if !contains([]string{"public", "private", "internal"}, strings.ToLower(v)) {
+			errs = append(errs, fmt.Sprintf("%sunknown repository visibility %q", prefix, v))
+		}
+	}
+	return errs
+}
+
+// checkNotifiers - the notifier type and conditions must be known, the url must suit the type,
+// release environments must exist and the message template must parse
+func checkNotifiers(t *config.Tenant, prefix string) []string {
+	var errs []string
+	names := map[string]bool{}
+	for _, e := range t.Environments {
+		names[e.Name] = true
+	}
+	for x := range t.Notifiers {
+		n := &t.Notifiers[x]
+		name := prefix + "notifier " + n.Name
+		if !contains(notify.Types, n.Type) {
+			errs = append(errs, fmt.Sprintf("%s type %q should be one of %s", name, n.Type, strings.Join(notify.Types, ", ")))
+		} else if n.Type == "email" {
+			// the smtp url and the addresses are checked when the notifier is created
+			if _, err := notify.New(n, nil); err != nil {
+				errs = append(errs, fmt.Sprintf("%s %v", name, err))
+			}
+		} else if err := CheckUrl(name, n.URL); err != nil {
+			errs = append(errs, err.Error())
+		}
+		for _, c := range n.On {
+			if !contains([]string{config.DELIVERYFAILED, config.RELEASEFORWARDED, config.POLICYBLOCKED, config.APPROVALEXPIRED}, c) {
+				errs = append(errs, fmt.Sprintf("%s unknown condition %q", name, c))
+			}
+		}
+		for _, e := range n.Environments {
+			if !names[e] {
+				errs = append(errs, fmt.Sprintf("%s refers to unknown environment %s", name, e))
+			}
+		}
+		if _, err := notify.Parse(n); err != nil {
+			errs = append(errs, fmt.Sprintf("%s template %v", name, err))
+		}
+	}
+	return errs
+}
+
+// checkChatOps - chatops needs a forge to read pull requests and every deploy target must be a route
+func checkChatOps(t *config.Tenant, prefix string) []string {
+	var errs []string
+	if t.ChatOps == nil {
+		return errs
+	}
+	if len(t.Forges) == 0 {
+		errs = append(errs, prefix+"chatops needs a forge to be configured")
+	}
+	for env, name := range t.ChatOps.Deploy {
+		if t.Route(name) == nil {
+			errs = append(errs, fmt.Sprintf("%sdeploy %s refers to unknown route %s", prefix, env, name))
+		}
+	}
+	return errs
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // ValidateEnvars : public call that groups all envar validations
 // These envars are set via the openshift template
+// All problems are logged and returned together as ValidationErrors
 func ValidateEnvars(logger *simple.Logger) error {
-	items := []string{
-		"LOG_LEVEL,true",
-		"WEBHOOK_SECRET,false",
-		"REPO_MAPPING,false",
-		"PR_OPENED_URL,false",
-		"PR_MERGED_URL,false",
-		"PRERELEASED_URL,false",
-		"RELEASED_URL,false",
-	}
+	var errs ValidationErrors
 	for x := range items {
 		if err := checkEnvar(items[x], logger); err != nil {
-			return err
+			errs = append(errs, err.Error())
 		}
 	}
+	errs = append(errs, checkCrossFields()...)
+	for _, e := range errs {
+		logger.Error(e)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
+
+// checkTenant - private function, collects every problem with a single tenant
+func checkTenant(t *config.Tenant, logger *simple.Logger) []string {
+	var errs []string
+	prefix := "tenant " + t.Name + ": "
+	if t.Name == "" || strings.ContainsAny(t.Name, "/?#") {
+		errs = append(errs, fmt.Sprintf("tenant name %q is empty or not url safe", t.Name))
+	}
+	if t.Name == config.DEFAULTTENANT {
+		errs = append(errs, fmt.Sprintf("tenant name %q is reserved for the legacy endpoint", t.Name))
+	}
+	if t.Secret == "" {
+		errs = append(errs, prefix+"secret is mandatory")
+	} else if len(t.Secret) < MINSECRETLENGTH {
+		logger.Warn(fmt.Sprintf("%ssecret is weak (less than %d characters)", prefix, MINSECRETLENGTH))
+	}
+	for _, p := range t.Providers {
+		if !contains(Providers, p) {
+			errs = append(errs, fmt.Sprintf("%sunsupported provider %q", prefix, p))
+		}
+	}
+	if len(t.Routes) > 0 && len(t.Providers) == 0 {
+		errs = append(errs, prefix+"routes are set but no provider is enabled")
+	}
+	for _, r := range t.Routes {
+		if r.Event == "" || len(r.Actions) == 0 {
+			errs = append(errs, fmt.Sprintf("%sroute %s needs an event and at least one action", prefix, r.Name))
+		}
+		errs = append(errs, checkActions(&r, prefix)...)
+		if r.Debounce < 0 {
+			errs = append(errs, fmt.Sprintf("%sroute %s debounce must not be negative", prefix, r.Name))
+		}
+		if r.Tekton != nil {
+			errs = append(errs, checkTekton(&r, prefix)...)
+		} else if r.Sink != nil {
+			errs = append(errs, checkSink(&r, prefix)...)
+		} else if err := CheckUrl(prefix+"route "+r.Name, r.URL); err != nil {
+			errs = append(errs, err.Error())
+		}
+		for _, p := range append(append([]string{}, r.IncludePaths...), r.ExcludePaths...) {
+			if err := glob.Valid(p); err != nil {
+				errs = append(errs, fmt.Sprintf("%sroute %s path %q %v", prefix, r.Name, p, err))
+			}
+		}
+		errs = append(errs, checkOutput(&r, prefix)...)
+		if r.Template != nil {
+			if _, err := payload.Parse(r.Template); err != nil {
+				errs = append(errs, fmt.Sprintf("%sroute %s template %v", prefix, r.Name, err))
+			}
+		}
+	}
+	for _, f := range t.Forges {
+		if !contains(Providers, f.Provider) {
+			errs = append(errs, fmt.Sprintf("%sforge has unsupported provider %q", prefix, f.Provider))
+		}
+		if f.Token == "" {
+			errs = append(errs, fmt.Sprintf("%sforge %s token is mandatory", prefix, f.Provider))
+		}
+		if f.Checks && f.Provider != "github" {
+			errs = append(errs, fmt.Sprintf("%sforge %s does not support checks", prefix, f.Provider))
+		}
+		if f.APIURL != "" {
+			if err := CheckUrl(prefix+"forge "+f.Provider, f.APIURL); err != nil {
+				errs = append(errs, err.Error())
+			}
+		} else if f.Provider != "github" {
+			errs = append(errs, fmt.Sprintf("%sforge %s apiurl is mandatory", prefix, f.Provider))
+		}
+	}
+	if len(t.Forges) > 0 && t.CallbackToken == "" {
+		errs = append(errs, prefix+"callbacktoken is mandatory with forges (pipeline callbacks update the commit statuses and check runs)")
+	}
+	errs = append(errs, checkChatOps(t, prefix)...)
+	errs = append(errs, checkEnvironments(t, prefix)...)
+	errs = append(errs, checkApprovals(t, prefix)...)
+	errs = append(errs, checkFreezes(t, prefix)...)
+	errs = append(errs, checkPolicy(t, prefix)...)
+	errs = append(errs, checkNotifiers(t, prefix)...)
+	if t.RateLimit < 0 || t.Burst < 0 || t.MaxInFlight < 0 || t.Timeout < 0 {
+		errs = append(errs, prefix+"ratelimit, burst, maxinflight and timeout must not be negative")
+	}
+	return errs
+}
+
+// ValidateTenants : validates each tenant on its own
+// The returned config only holds the valid tenants so that one team's misconfiguration
+// does not stop the others, all problems are returned together as ValidationErrors
+func ValidateTenants(cfg *config.Config, logger *simple.Logger) (*config.Config, error) {
+	var errs ValidationErrors
+	valid := &config.Config{}
+	seen := make(map[string]bool)
+	for x := range cfg.Tenants {
+		t := cfg.Tenants[x]
+		terrs := checkTenant(&t, logger)
+		if seen[t.Name] {
+			terrs = append(terrs, fmt.Sprintf("tenant %s is defined more than once", t.Name))
+		}
+		seen[t.Name] = true
+		if len(terrs) > 0 {
+			errs = append(errs, terrs...)
+			logger.Error(fmt.Sprintf("tenant %s is disabled", t.Name))
+			continue
+		}
+		valid.Tenants = append(valid.Tenants, t)
+	}
+	for _, e := range errs {
+		logger.Error(e)
+	}
+	if len(errs) > 0 {
+		return valid, errs
+	}
+	return valid, nil
+}